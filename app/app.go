@@ -2,11 +2,10 @@ package app
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"io"
 	"runtime/debug"
-	"strings"
+	"time"
 
 	conf "github.com/ad/telegram-delete-join-messages/config"
 	data "github.com/ad/telegram-delete-join-messages/data"
@@ -14,6 +13,62 @@ import (
 	sndr "github.com/ad/telegram-delete-join-messages/sender"
 )
 
+// CheckConfig prints the resolved config with secrets redacted and
+// returns an error describing every problem if it is invalid.
+func CheckConfig(w io.Writer, args []string) error {
+	return conf.CheckConfig(w, args)
+}
+
+// MigrateOnly opens the configured database, applies pending schema
+// migrations and reports the applied versions and the legacy votes left
+// for the next start without starting the bot.
+func MigrateOnly(w io.Writer, args []string) error {
+	config, errInitConfig := conf.InitConfig(args)
+	if errInitConfig != nil {
+		return errInitConfig
+	}
+
+	if config.DB_PATH == "" {
+		return fmt.Errorf("DB_PATH is not set, nothing to migrate")
+	}
+
+	store, errOpen := data.Open(config.DB_PATH)
+	if errOpen != nil {
+		return errOpen
+	}
+	defer store.Close()
+
+	sqlStore, ok := store.(*data.SQLStore)
+	if !ok {
+		return fmt.Errorf("DB_PATH %q is not an SQL database", config.DB_PATH)
+	}
+
+	applied, errApplied := sqlStore.AppliedMigrations()
+	if errApplied != nil {
+		return errApplied
+	}
+
+	fmt.Fprintf(w, "schema is at version %d, applied migrations: %v\n", data.LatestMigration(), applied)
+
+	// the votes are only assigned to the allowed groups when the bot starts
+	legacy, errLegacy := sqlStore.LegacyVotes()
+	if errLegacy != nil {
+		return errLegacy
+	}
+
+	if legacy > 0 {
+		fmt.Fprintf(w, "%d votes from before per-group verification will be assigned to %v on the next start\n", legacy, config.AllowedChatIDsList)
+	}
+
+	return nil
+}
+
+// shutdownTimeout bounds how long Run waits for queued requests to be sent
+// on shutdown.
+const shutdownTimeout = 30 * time.Second
+
+// Run starts the bot and blocks until ctx is done or the bot is stopped
+// with /exit, then shuts it down and closes the database.
 func Run(ctx context.Context, w io.Writer, args []string) error {
 	config, errInitConfig := conf.InitConfig(args)
 	if errInitConfig != nil {
@@ -29,40 +84,63 @@ func Run(ctx context.Context, w io.Writer, args []string) error {
 		}
 	}()
 
-	var db *sql.DB
-
 	lgr.Debug(fmt.Sprintf("DB_PATH: %s", config.DB_PATH))
 
-	if strings.HasSuffix(config.DB_PATH, ".db") {
-		dbSqlite, errInitSqliteDB := data.InitSqliteDB(config.DB_PATH)
-		if errInitSqliteDB != nil {
-			return errInitSqliteDB
-		}
-
-		db = dbSqlite
+	if config.DB_PATH == "" {
+		lgr.Warn("DB_PATH is not set, votes and settings are kept in memory and lost on restart")
 	}
 
-	if strings.HasPrefix(config.DB_PATH, "postgres://") {
-		dbPostgres, errInitPostgresDB := data.InitPostgresDB(config.DB_PATH)
-		if errInitPostgresDB != nil {
-			return errInitPostgresDB
-		}
+	store, errOpen := data.Open(config.DB_PATH)
+	if errOpen != nil {
+		return errOpen
+	}
 
-		db = dbPostgres
+	// users verified before votes were stored per group stay verified in every allowed group
+	if legacy, errAdopt := store.AdoptLegacyVotes(config.AllowedChatIDsList); errAdopt != nil {
+		lgr.Error(fmt.Sprintf("AdoptLegacyVotes error: %s", errAdopt.Error()))
+	} else if legacy > 0 {
+		lgr.Info(fmt.Sprintf("%d votes from before per-group verification are assigned to %v", legacy, config.AllowedChatIDsList))
 	}
 
-	sender, errInitSender := sndr.InitSender(lgr, config, db)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sender, errInitSender := sndr.InitSender(ctx, lgr, config, store)
 	if errInitSender != nil {
+		store.Close()
 		return errInitSender
 	}
 
-	if len(config.TelegramAdminIDsList) != 0 {
-		sender.MakeRequestDeferred(sndr.DeferredMessage{
-			Method: "sendMessage",
-			ChatID: config.TelegramAdminIDsList[0],
-			Text:   "Bot restarted",
-		}, sender.SendResult)
+	watcher := conf.NewWatcher(
+		conf.ConfigFileName,
+		args,
+		func(newConfig *conf.Config) {
+			sender.UpdateConfig(newConfig)
+			lgr.Info("config reloaded")
+		},
+		func(err error) {
+			lgr.Error(fmt.Sprintf("config reload failed, keeping previous config: %s", err.Error()))
+
+			sender.NotifyFirstAdmin("admin.config_reload_failed", err.Error())
+		},
+	)
+
+	go watcher.Run(ctx)
+
+	sender.NotifyFirstAdmin("admin.bot_restarted")
+
+	<-sender.Done()
+	cancel()
+
+	lgr.Info("shutting down")
+
+	sender.Shutdown(shutdownTimeout)
+
+	if errClose := store.Close(); errClose != nil {
+		lgr.Error(fmt.Sprintf("store close error: %s", errClose.Error()))
 	}
 
+	lgr.Info("stopped")
+
 	return nil
 }
@@ -0,0 +1,29 @@
+package app
+
+// Startup modes that are handled before the config flags are parsed.
+const (
+	CheckConfigFlag = "check-config"
+	MigrateOnlyFlag = "migrate-only"
+)
+
+// ExtractFlag removes a boolean flag (-name or --name) from args
+// and reports whether it was present.
+func ExtractFlag(args []string, name string) ([]string, bool) {
+	if len(args) == 0 {
+		return args, false
+	}
+
+	result := []string{args[0]}
+	found := false
+
+	for _, arg := range args[1:] {
+		if arg == "-"+name || arg == "--"+name {
+			found = true
+			continue
+		}
+
+		result = append(result, arg)
+	}
+
+	return result, found
+}
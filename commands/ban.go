@@ -11,18 +11,20 @@ import (
 
 // Ban user on /ban
 func (c *Commands) Ban(ctx context.Context, b *bot.Bot, update *models.Update) {
-	if !slices.Contains(c.config.AllowedChatIDsList, update.Message.Chat.ID) {
+	config := c.config.Load()
+
+	if !slices.Contains(config.AllowedChatIDsList, update.Message.Chat.ID) {
 		return
 	}
 
-	if slices.Contains(c.config.TelegramAdminIDsList, update.Message.From.ID) {
+	if slices.Contains(config.TelegramAdminIDsList, update.Message.From.ID) {
 		userID := update.Message.ReplyToMessage.From.ID
 		chatID := update.Message.Chat.ID
 
 		fmt.Println("baning", userID, "::", chatID, "by", update.Message.From.ID)
 
 		_, errBanChatMember := b.BanChatMember(
-			context.Background(),
+			ctx,
 			&bot.BanChatMemberParams{
 				ChatID: chatID,
 				UserID: userID,
@@ -37,7 +39,7 @@ func (c *Commands) Ban(ctx context.Context, b *bot.Bot, update *models.Update) {
 	}
 
 	_, err := b.DeleteMessage(
-		context.Background(),
+		ctx,
 		&bot.DeleteMessageParams{
 			ChatID:    update.Message.Chat.ID,
 			MessageID: update.Message.ID,
@@ -1,15 +1,32 @@
 package commands
 
 import (
+	"sync/atomic"
+
 	conf "github.com/ad/telegram-delete-join-messages/config"
+	"github.com/go-telegram/bot/models"
 )
 
+// Reply sends the reply of a command to the chat of message. The sender
+// deletes replies in groups after EPHEMERAL_MESSAGES_TTL.
+type Reply func(message *models.Message, text string, parseMode models.ParseMode)
+
 type Commands struct {
-	config *conf.Config
+	config atomic.Pointer[conf.Config]
+	reply  Reply
+	exit   func()
+}
+
+// InitCommands creates the command handlers. exit is called by /exit to
+// stop the bot.
+func InitCommands(config *conf.Config, reply Reply, exit func()) *Commands {
+	commands := &Commands{reply: reply, exit: exit}
+	commands.config.Store(config)
+
+	return commands
 }
 
-func InitCommands(config *conf.Config) *Commands {
-	return &Commands{
-		config: config,
-	}
+// UpdateConfig swaps the config used by all commands.
+func (c *Commands) UpdateConfig(config *conf.Config) {
+	c.config.Store(config)
 }
@@ -3,9 +3,7 @@ package commands
 import (
 	"context"
 	"fmt"
-	"os"
 	"slices"
-	"time"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
@@ -13,15 +11,17 @@ import (
 
 // Exit bot on /exit
 func (c *Commands) Exit(ctx context.Context, b *bot.Bot, update *models.Update) {
-	if !slices.Contains(c.config.AllowedChatIDsList, update.Message.Chat.ID) {
+	config := c.config.Load()
+
+	if !slices.Contains(config.AllowedChatIDsList, update.Message.Chat.ID) {
 		return
 	}
 
-	if slices.Contains(c.config.TelegramAdminIDsList, update.Message.From.ID) {
+	if slices.Contains(config.TelegramAdminIDsList, update.Message.From.ID) {
 		fmt.Println("exiting... by", update.Message.From.ID)
 		_, errSendMessage := b.SendMessage(ctx, &bot.SendMessageParams{
 			ChatID:    update.Message.Chat.ID,
-			Text:      "exiting...",
+			Text:      c.t(update.Message.From, "command.exit"),
 			ParseMode: models.ParseModeHTML,
 		})
 
@@ -29,8 +29,6 @@ func (c *Commands) Exit(ctx context.Context, b *bot.Bot, update *models.Update)
 			fmt.Println("errSendMessage (/exit): ", errSendMessage)
 		}
 
-		time.Sleep(1 * time.Second)
-
-		os.Exit(0)
+		c.exit()
 	}
 }
@@ -0,0 +1,18 @@
+package commands
+
+import (
+	"github.com/ad/telegram-delete-join-messages/translations"
+	"github.com/go-telegram/bot/models"
+)
+
+// t returns the catalog message for key in the locale of user.
+func (c *Commands) t(user *models.User, key string, args ...any) string {
+	languageCode := ""
+	if user != nil {
+		languageCode = user.LanguageCode
+	}
+
+	catalog := translations.Default()
+
+	return catalog.T(catalog.Resolve(languageCode, c.config.Load().DefaultLocale), key, args...)
+}
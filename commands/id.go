@@ -2,21 +2,12 @@ package commands
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
 )
 
 // Respond with the ID of the user who sent the message with /id
-func (c *Commands) Id(ctx context.Context, b *bot.Bot, update *models.Update) {
-	_, errSendMessage := b.SendMessage(ctx, &bot.SendMessageParams{
-		ChatID:    update.Message.Chat.ID,
-		Text:      fmt.Sprintf("Your ID is %d, chat id is %d", update.Message.From.ID, update.Message.Chat.ID),
-		ParseMode: models.ParseModeHTML,
-	})
-
-	if errSendMessage != nil {
-		fmt.Println("errSendMessage (/id): ", errSendMessage)
-	}
+func (c *Commands) Id(_ context.Context, _ *bot.Bot, update *models.Update) {
+	c.reply(update.Message, c.t(update.Message.From, "command.id", update.Message.From.ID, update.Message.Chat.ID), models.ParseModeHTML)
 }
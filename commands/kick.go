@@ -12,18 +12,20 @@ import (
 
 // Kick user on /kick
 func (c *Commands) Kick(ctx context.Context, b *bot.Bot, update *models.Update) {
-	if !slices.Contains(c.config.AllowedChatIDsList, update.Message.Chat.ID) {
+	config := c.config.Load()
+
+	if !slices.Contains(config.AllowedChatIDsList, update.Message.Chat.ID) {
 		return
 	}
 
-	if slices.Contains(c.config.TelegramAdminIDsList, update.Message.From.ID) {
+	if slices.Contains(config.TelegramAdminIDsList, update.Message.From.ID) {
 		userID := update.Message.ReplyToMessage.From.ID
 		chatID := update.Message.Chat.ID
 
 		fmt.Println("kicking", userID, "::", chatID, "by", update.Message.From.ID)
 
 		_, errRestrictChatMember := b.RestrictChatMember(
-			context.Background(),
+			ctx,
 			&bot.RestrictChatMemberParams{
 				ChatID: chatID,
 				UserID: userID,
@@ -41,7 +43,7 @@ func (c *Commands) Kick(ctx context.Context, b *bot.Bot, update *models.Update)
 		}
 
 		_, errBanChatMember := b.BanChatMember(
-			context.Background(),
+			ctx,
 			&bot.BanChatMemberParams{
 				ChatID: chatID,
 				UserID: userID,
@@ -55,7 +57,7 @@ func (c *Commands) Kick(ctx context.Context, b *bot.Bot, update *models.Update)
 		}
 
 		_, errUnbanChatMember := b.UnbanChatMember(
-			context.Background(),
+			ctx,
 			&bot.UnbanChatMemberParams{
 				ChatID: chatID,
 				UserID: userID,
@@ -70,7 +72,7 @@ func (c *Commands) Kick(ctx context.Context, b *bot.Bot, update *models.Update)
 	}
 
 	_, err := b.DeleteMessage(
-		context.Background(),
+		ctx,
 		&bot.DeleteMessageParams{
 			ChatID:    update.Message.Chat.ID,
 			MessageID: update.Message.ID,
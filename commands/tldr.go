@@ -20,11 +20,13 @@ import (
 
 // Send Yandex 300 response on link
 func (c *Commands) TLDR(ctx context.Context, b *bot.Bot, update *models.Update) {
-	if c.config.YandexToken == "" {
+	config := c.config.Load()
+
+	if config.YandexToken == "" {
 		return
 	}
 
-	if !slices.Contains(c.config.AllowedChatIDsList, update.Message.Chat.ID) {
+	if !slices.Contains(config.AllowedChatIDsList, update.Message.Chat.ID) {
 		return
 	}
 
@@ -32,15 +34,7 @@ func (c *Commands) TLDR(ctx context.Context, b *bot.Bot, update *models.Update)
 
 	link := rxStrict.FindString(update.Message.Text)
 	if link == "" {
-		_, errSendMessage := b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID:    update.Message.Chat.ID,
-			Text:      "Бот заберёт статью по ссылке и сделает её краткое описание.",
-			ParseMode: models.ParseModeHTML,
-		})
-
-		if errSendMessage != nil {
-			fmt.Println("errSendMessage (/tldr): ", errSendMessage)
-		}
+		c.reply(update.Message, c.t(update.Message.From, "command.tldr_usage"), models.ParseModeHTML)
 
 		return
 	}
@@ -52,7 +46,7 @@ func (c *Commands) TLDR(ctx context.Context, b *bot.Bot, update *models.Update)
 		return
 	}
 	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", "OAuth "+c.config.YandexToken)
+	req.Header.Add("Authorization", "OAuth "+config.YandexToken)
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -12,18 +12,20 @@ import (
 
 // // Unmute user on /unmute
 func (c *Commands) Unmute(ctx context.Context, b *bot.Bot, update *models.Update) {
-	if !slices.Contains(c.config.AllowedChatIDsList, update.Message.Chat.ID) {
+	config := c.config.Load()
+
+	if !slices.Contains(config.AllowedChatIDsList, update.Message.Chat.ID) {
 		return
 	}
 
-	if slices.Contains(c.config.TelegramAdminIDsList, update.Message.From.ID) {
+	if slices.Contains(config.TelegramAdminIDsList, update.Message.From.ID) {
 		userID := update.Message.ReplyToMessage.From.ID
 		chatID := update.Message.Chat.ID
 
 		fmt.Println("unmuting", userID, "::", chatID, "by", update.Message.From.ID)
 
 		_, errRestrictChatMember := b.RestrictChatMember(
-			context.Background(),
+			ctx,
 			&bot.RestrictChatMemberParams{
 				ChatID: chatID,
 				UserID: userID,
@@ -40,7 +42,7 @@ func (c *Commands) Unmute(ctx context.Context, b *bot.Bot, update *models.Update
 	}
 
 	_, err := b.DeleteMessage(
-		context.Background(),
+		ctx,
 		&bot.DeleteMessageParams{
 			ChatID:    update.Message.Chat.ID,
 			MessageID: update.Message.ID,
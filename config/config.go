@@ -23,12 +23,27 @@ type Config struct {
 	DeleteJoinMessages  bool `json:"DELETE_JOIN"`
 	DeleteLeaveMessages bool `json:"DELETE_LEAVE"`
 
+	DeleteServiceMessages    string          `json:"DELETE_SERVICE_MESSAGES"`
+	DeleteServiceMessagesSet ServiceMessages `json:"-"`
+	DeleteServiceDelay       int             `json:"DELETE_SERVICE_DELAY"`
+
 	RestictOnJoin      bool `json:"RESTRICT_ON_JOIN"`
 	RestrictOnJoinTime int  `json:"RESTRICT_ON_JOIN_TIME"`
 
+	Captcha        bool `json:"CAPTCHA"`
+	CaptchaTimeout int  `json:"CAPTCHA_TIMEOUT"`
+
+	ManualApproval bool `json:"MANUAL_APPROVAL"`
+
+	KeepJoinRequestsPending bool `json:"KEEP_JOIN_REQUESTS_PENDING"`
+	JoinRequestTimeout      int  `json:"JOIN_REQUEST_TIMEOUT"`
+
 	AllowedChatIDs     string  `json:"ALLOWED_CHAT_IDS"`
 	AllowedChatIDsList []int64 `json:"-"`
 
+	ChatPolicies    []ChatPolicy         `json:"CHAT_POLICIES"`
+	ChatPoliciesMap map[int64]ChatPolicy `json:"-"`
+
 	InviteLink string `json:"INVITE_LINK"`
 
 	YandexToken string `json:"YANDEX_TOKEN"`
@@ -39,17 +54,100 @@ type Config struct {
 
 	Debug bool `json:"DEBUG"`
 
+	AdminLocale   string `json:"ADMIN_LOCALE"`
+	DefaultLocale string `json:"DEFAULT_LOCALE"`
+
 	ConciergeMode bool `json:"CONCIERGE_MODE"`
+
+	MemberPermissions    string            `json:"MEMBER_PERMISSIONS"`
+	MemberPermissionsSet MemberPermissions `json:"-"`
+
+	OutboxQueueSize      int    `json:"OUTBOX_QUEUE_SIZE"`
+	OutboxOverflowPolicy string `json:"OUTBOX_OVERFLOW_POLICY"`
+
+	EphemeralMessagesTTL int `json:"EPHEMERAL_MESSAGES_TTL"`
+
+	WebhookURL    string `json:"WEBHOOK_URL"`
+	WebhookPath   string `json:"WEBHOOK_PATH"`
+	WebhookPort   int    `json:"WEBHOOK_PORT"`
+	WebhookSecret string `json:"WEBHOOK_SECRET"`
+
+	// fileError is why an existing options file was skipped for env and flags.
+	fileError error
 }
 
+// MaxEphemeralMessagesTTL is the longest EPHEMERAL_MESSAGES_TTL in seconds:
+// bots can only delete messages that are less than 48 hours old.
+const MaxEphemeralMessagesTTL = 48 * 60 * 60
+
+// CAPTCHA_TIMEOUT bounds in seconds.
+const (
+	MinCaptchaTimeout = 10
+	MaxCaptchaTimeout = 60 * 60
+)
+
+// JOIN_REQUEST_TIMEOUT bounds in seconds.
+const (
+	MinJoinRequestTimeout = 60
+	MaxJoinRequestTimeout = 7 * 24 * 60 * 60
+)
+
+// HealthPath is where the webhook listener answers health checks.
+const HealthPath = "/health"
+
+// Overflow policies of the outbox queue of a chat.
+const (
+	OverflowDropOldest = "drop_oldest"
+	OverflowDropNewest = "drop_newest"
+)
+
+// Keyboards a conversation stage can offer its variants with.
+const (
+	KeyboardReply  = "reply"
+	KeyboardInline = "inline"
+)
+
 type Conversation struct {
 	Question string `json:"question"`
 	Variants string `json:"variants"`
 	Answer   string `json:"answer"`
+	Keyboard string `json:"keyboard,omitempty"` // KeyboardReply, KeyboardInline or empty for free text only
+	ChatID   int64  `json:"chat_id,omitempty"`  // the group the stage is asked for, 0 for groups without their own questionnaire
 }
 
-func InitConfig(args []string) (*Config, error) {
-	var config = &Config{
+// ConversationsFor returns the questionnaire of a group: the stages with its
+// chat_id, or the stages without chat_id if it has none of its own.
+func (config *Config) ConversationsFor(chatID int64) []Conversation {
+	own := []Conversation{}
+	shared := []Conversation{}
+
+	for _, conversation := range config.Conversations {
+		if conversation.ChatID == 0 {
+			shared = append(shared, conversation)
+		} else if conversation.ChatID == chatID {
+			own = append(own, conversation)
+		}
+	}
+
+	if len(own) > 0 {
+		return own
+	}
+
+	return shared
+}
+
+// VariantList returns the trimmed variants in the order of Variants.
+func (c Conversation) VariantList() []string {
+	variants := strings.Split(c.Variants, ",")
+	for i := range variants {
+		variants[i] = strings.TrimSpace(variants[i])
+	}
+
+	return variants
+}
+
+func newDefaultConfig() *Config {
+	return &Config{
 		TelegramToken:        "",
 		TelegramAdminIDs:     "",
 		TelegramAdminIDsList: []int64{},
@@ -57,28 +155,79 @@ func InitConfig(args []string) (*Config, error) {
 		DeleteJoinMessages:  false,
 		DeleteLeaveMessages: false,
 
+		DeleteServiceMessages: "",
+		DeleteServiceDelay:    0,
+
 		RestictOnJoin:      true,
 		RestrictOnJoinTime: 120,
 
+		Captcha:        false,
+		CaptchaTimeout: 120,
+
+		ManualApproval: false,
+
+		KeepJoinRequestsPending: false,
+		JoinRequestTimeout:      24 * 60 * 60,
+
 		AllowedChatIDs:     "",
 		AllowedChatIDsList: []int64{},
 
+		ChatPolicies:    []ChatPolicy{},
+		ChatPoliciesMap: map[int64]ChatPolicy{},
+
 		YandexToken: "",
 
 		Debug: false,
+
+		AdminLocale:   "ru",
+		DefaultLocale: "ru",
+
+		MemberPermissions: DefaultMemberPermissions,
+
+		OutboxQueueSize:      100,
+		OutboxOverflowPolicy: OverflowDropOldest,
+
+		EphemeralMessagesTTL: 0,
+
+		WebhookURL:  "",
+		WebhookPath: "/webhook",
+		WebhookPort: 8080,
+	}
+}
+
+func InitConfig(args []string) (*Config, error) {
+	config, err := loadConfig(ConfigFileName, args)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := config.finalize(); err != nil {
+		return nil, err
 	}
 
+	return config, nil
+}
+
+// loadConfig reads the config from the options file at path, or from env
+// and flags when the file is missing or broken, without validating it.
+func loadConfig(path string, args []string) (*Config, error) {
+	var config = newDefaultConfig()
+
 	var initFromFile = false
 
-	if _, err := os.Stat(ConfigFileName); err == nil {
-		jsonFile, err := os.Open(ConfigFileName)
+	if _, err := os.Stat(path); err == nil {
+		jsonFile, err := os.Open(path)
 		if err == nil {
 			byteValue, _ := io.ReadAll(jsonFile)
+			jsonFile.Close()
 			if err = json.Unmarshal(byteValue, &config); err == nil {
 				initFromFile = true
 			} else {
 				fmt.Printf("error on unmarshal config from file %s\n", err.Error())
+				config.fileError = fmt.Errorf("error on unmarshal config from file %s: %w", path, err)
 			}
+		} else {
+			config.fileError = err
 		}
 	}
 
@@ -90,9 +239,20 @@ func InitConfig(args []string) (*Config, error) {
 		flags.BoolVar(&config.DeleteJoinMessages, "deleteJoin", lookupEnvOrBool("DELETE_JOIN", config.DeleteJoinMessages), "DELETE_JOIN")
 		flags.BoolVar(&config.DeleteLeaveMessages, "deleteLeave", lookupEnvOrBool("DELETE_LEAVE", config.DeleteLeaveMessages), "DELETE_LEAVE")
 
+		flags.StringVar(&config.DeleteServiceMessages, "deleteServiceMessages", lookupEnvOrString("DELETE_SERVICE_MESSAGES", config.DeleteServiceMessages), "DELETE_SERVICE_MESSAGES")
+		flags.IntVar(&config.DeleteServiceDelay, "deleteServiceDelay", lookupEnvOrInt("DELETE_SERVICE_DELAY", config.DeleteServiceDelay), "DELETE_SERVICE_DELAY")
+
 		flags.BoolVar(&config.RestictOnJoin, "restrictOnJoin", lookupEnvOrBool("RESTRICT_ON_JOIN", config.RestictOnJoin), "RESTRICT_ON_JOIN")
 		flags.IntVar(&config.RestrictOnJoinTime, "restrictOnJoinTime", lookupEnvOrInt("RESTRICT_ON_JOIN_TIME", config.RestrictOnJoinTime), "RESTRICT_ON_JOIN_TIME")
 
+		flags.BoolVar(&config.Captcha, "captcha", lookupEnvOrBool("CAPTCHA", config.Captcha), "CAPTCHA")
+		flags.IntVar(&config.CaptchaTimeout, "captchaTimeout", lookupEnvOrInt("CAPTCHA_TIMEOUT", config.CaptchaTimeout), "CAPTCHA_TIMEOUT")
+
+		flags.BoolVar(&config.ManualApproval, "manualApproval", lookupEnvOrBool("MANUAL_APPROVAL", config.ManualApproval), "MANUAL_APPROVAL")
+
+		flags.BoolVar(&config.KeepJoinRequestsPending, "keepJoinRequestsPending", lookupEnvOrBool("KEEP_JOIN_REQUESTS_PENDING", config.KeepJoinRequestsPending), "KEEP_JOIN_REQUESTS_PENDING")
+		flags.IntVar(&config.JoinRequestTimeout, "joinRequestTimeout", lookupEnvOrInt("JOIN_REQUEST_TIMEOUT", config.JoinRequestTimeout), "JOIN_REQUEST_TIMEOUT")
+
 		flags.StringVar(&config.AllowedChatIDs, "allowedChatIDs", lookupEnvOrString("ALLOWED_CHAT_IDS", config.AllowedChatIDs), "ALLOWED_CHAT_IDS")
 
 		flags.StringVar(&config.InviteLink, "InviteLink", lookupEnvOrString("INVITE_LINK", config.InviteLink), "INVITE_LINK")
@@ -103,44 +263,124 @@ func InitConfig(args []string) (*Config, error) {
 
 		flags.BoolVar(&config.Debug, "debug", lookupEnvOrBool("DEBUG", config.Debug), "Debug")
 
+		flags.StringVar(&config.AdminLocale, "adminLocale", lookupEnvOrString("ADMIN_LOCALE", config.AdminLocale), "ADMIN_LOCALE")
+		flags.StringVar(&config.DefaultLocale, "defaultLocale", lookupEnvOrString("DEFAULT_LOCALE", config.DefaultLocale), "DEFAULT_LOCALE")
+
 		flags.BoolVar(&config.ConciergeMode, "conciergeMode", lookupEnvOrBool("CONCIERGE_MODE", config.ConciergeMode), "CONCIERGE_MODE")
+		flags.StringVar(&config.MemberPermissions, "memberPermissions", lookupEnvOrString("MEMBER_PERMISSIONS", config.MemberPermissions), "MEMBER_PERMISSIONS")
+
+		flags.IntVar(&config.OutboxQueueSize, "outboxQueueSize", lookupEnvOrInt("OUTBOX_QUEUE_SIZE", config.OutboxQueueSize), "OUTBOX_QUEUE_SIZE")
+		flags.StringVar(&config.OutboxOverflowPolicy, "outboxOverflowPolicy", lookupEnvOrString("OUTBOX_OVERFLOW_POLICY", config.OutboxOverflowPolicy), "OUTBOX_OVERFLOW_POLICY")
+
+		flags.IntVar(&config.EphemeralMessagesTTL, "ephemeralMessagesTTL", lookupEnvOrInt("EPHEMERAL_MESSAGES_TTL", config.EphemeralMessagesTTL), "EPHEMERAL_MESSAGES_TTL")
+
+		flags.StringVar(&config.WebhookURL, "webhookURL", lookupEnvOrString("WEBHOOK_URL", config.WebhookURL), "WEBHOOK_URL")
+		flags.StringVar(&config.WebhookPath, "webhookPath", lookupEnvOrString("WEBHOOK_PATH", config.WebhookPath), "WEBHOOK_PATH")
+		flags.IntVar(&config.WebhookPort, "webhookPort", lookupEnvOrInt("WEBHOOK_PORT", config.WebhookPort), "WEBHOOK_PORT")
+		flags.StringVar(&config.WebhookSecret, "webhookSecret", lookupEnvOrString("WEBHOOK_SECRET", config.WebhookSecret), "WEBHOOK_SECRET")
+
+		// get conversations and chat policies as JSON from flags or env
+		var conversations, chatPolicies string
+		flags.StringVar(&conversations, "conversations", lookupEnvOrString("CONVERSATIONS", ""), "CONVERSATIONS")
+		flags.StringVar(&chatPolicies, "chatPolicies", lookupEnvOrString("CHAT_POLICIES", ""), "CHAT_POLICIES")
+
+		if err := flags.Parse(args[1:]); err != nil {
+			return nil, err
+		}
 
-		// get conversations from flags or env
-		var conversations string
-		flags.StringVar(&conversations, "conversations", "", "CONVERSATIONS")
-		conversations = lookupEnvOrString("CONVERSATIONS", conversations)
 		if conversations != "" {
 			if err := json.Unmarshal([]byte(conversations), &config.Conversations); err != nil {
 				return nil, err
 			}
 		}
 
-		if err := flags.Parse(args[1:]); err != nil {
-			return nil, err
+		if chatPolicies != "" {
+			if err := json.Unmarshal([]byte(chatPolicies), &config.ChatPolicies); err != nil {
+				return nil, err
+			}
 		}
 	}
 
-	if config.TelegramToken == "" {
-		return nil, fmt.Errorf("TELEGRAM_TOKEN is required")
+	return config, nil
+}
+
+// ReloadConfig resolves and validates the config again for a running bot,
+// from the options file at path or from env and flags like InitConfig.
+// Unlike at startup, an options file that can't be parsed is an error, so
+// the bot keeps its config instead of falling back to env.
+func ReloadConfig(path string, args []string) (*Config, error) {
+	config, err := loadConfig(path, args)
+	if err != nil {
+		return nil, err
 	}
 
-	if config.TelegramAdminIDs != "" {
-		chatIDS := strings.Split(config.TelegramAdminIDs, ",")
-		for _, chatID := range chatIDS {
-			if chatIDInt, err := strconv.ParseInt(strings.Trim(chatID, "\n\t "), 10, 64); err == nil {
-				config.TelegramAdminIDsList = append(config.TelegramAdminIDsList, chatIDInt)
-			}
-		}
+	if config.fileError != nil {
+		return nil, config.fileError
 	}
 
-	if config.AllowedChatIDs != "" {
-		chatIDS := strings.Split(config.AllowedChatIDs, ",")
-		for _, chatID := range chatIDS {
-			if chatIDInt, err := strconv.ParseInt(strings.Trim(chatID, "\n\t "), 10, 64); err == nil {
-				config.AllowedChatIDsList = append(config.AllowedChatIDsList, chatIDInt)
-			}
-		}
+	if err := config.finalize(); err != nil {
+		return nil, err
 	}
 
 	return config, nil
 }
+
+// finalize parses the list fields and validates the config,
+// reporting every problem found at once.
+func (config *Config) finalize() error {
+	problems := &ValidationError{}
+
+	config.TelegramAdminIDsList = parseIDList("TELEGRAM_ADMIN_IDS", config.TelegramAdminIDs, problems)
+	config.AllowedChatIDsList = parseIDList("ALLOWED_CHAT_IDS", config.AllowedChatIDs, problems)
+	config.ChatPoliciesMap = chatPoliciesByID(config.ChatPolicies)
+
+	if set, err := ParseServiceMessages(config.DeleteServiceMessages); err != nil {
+		problems.Add("DELETE_SERVICE_MESSAGES", err.Error())
+	} else {
+		config.DeleteServiceMessagesSet = set
+	}
+
+	if set, err := ParseMemberPermissions(config.MemberPermissions); err != nil {
+		problems.Add("MEMBER_PERMISSIONS", err.Error())
+	} else {
+		config.MemberPermissionsSet = set
+	}
+
+	config.validate(problems)
+
+	return problems.errOrNil()
+}
+
+func parseIDList(field, raw string, problems *ValidationError) []int64 {
+	result := []int64{}
+
+	if raw == "" {
+		return result
+	}
+
+	for _, chatID := range strings.Split(raw, ",") {
+		chatID = strings.Trim(chatID, "\n\t ")
+		if chatID == "" {
+			continue
+		}
+
+		chatIDInt, err := strconv.ParseInt(chatID, 10, 64)
+		if err != nil {
+			problems.Add(field, fmt.Sprintf("%q is not a valid ID", chatID))
+			continue
+		}
+
+		result = append(result, chatIDInt)
+	}
+
+	return result
+}
+
+func chatPoliciesByID(policies []ChatPolicy) map[int64]ChatPolicy {
+	result := make(map[int64]ChatPolicy, len(policies))
+	for _, policy := range policies {
+		result[policy.ChatID] = policy
+	}
+
+	return result
+}
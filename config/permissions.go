@@ -0,0 +1,103 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Permissions that MEMBER_PERMISSIONS can list.
+const (
+	PermissionMessages     = "messages"
+	PermissionAudios       = "audios"
+	PermissionDocuments    = "documents"
+	PermissionPhotos       = "photos"
+	PermissionVideos       = "videos"
+	PermissionVideoNotes   = "video_notes"
+	PermissionVoiceNotes   = "voice_notes"
+	PermissionPolls        = "polls"
+	PermissionOther        = "other"
+	PermissionLinkPreviews = "link_previews"
+	PermissionChangeInfo   = "change_info"
+	PermissionInvite       = "invite"
+	PermissionPin          = "pin"
+	PermissionTopics       = "topics"
+)
+
+// PermissionNames lists every member permission in a stable order.
+var PermissionNames = []string{
+	PermissionMessages,
+	PermissionAudios,
+	PermissionDocuments,
+	PermissionPhotos,
+	PermissionVideos,
+	PermissionVideoNotes,
+	PermissionVoiceNotes,
+	PermissionPolls,
+	PermissionOther,
+	PermissionLinkPreviews,
+	PermissionChangeInfo,
+	PermissionInvite,
+	PermissionPin,
+	PermissionTopics,
+}
+
+// DefaultMemberPermissions are granted to verified members unless
+// MEMBER_PERMISSIONS says otherwise.
+const DefaultMemberPermissions = "messages,documents,photos,videos,other,invite"
+
+// MemberPermissions is a set of permissions granted to verified members.
+type MemberPermissions uint16
+
+// ParseMemberPermissions parses a comma separated list of permissions;
+// "all" selects every permission.
+func ParseMemberPermissions(raw string) (MemberPermissions, error) {
+	var set MemberPermissions
+
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.Trim(name, "\n\t ")
+
+		switch {
+		case name == "":
+		case name == "all":
+			for _, name := range PermissionNames {
+				set = set.With(name)
+			}
+		case slices.Contains(PermissionNames, name):
+			set = set.With(name)
+		default:
+			return 0, fmt.Errorf("%q is not one of %s", name, strings.Join(PermissionNames, ", "))
+		}
+	}
+
+	return set, nil
+}
+
+// Has reports whether name is in the set.
+func (set MemberPermissions) Has(name string) bool {
+	index := slices.Index(PermissionNames, name)
+
+	return index >= 0 && set&(1<<index) != 0
+}
+
+// With returns the set with name added.
+func (set MemberPermissions) With(name string) MemberPermissions {
+	if index := slices.Index(PermissionNames, name); index >= 0 {
+		set |= 1 << index
+	}
+
+	return set
+}
+
+// String returns the set as a comma separated list of permissions.
+func (set MemberPermissions) String() string {
+	names := []string{}
+
+	for _, name := range PermissionNames {
+		if set.Has(name) {
+			names = append(names, name)
+		}
+	}
+
+	return strings.Join(names, ",")
+}
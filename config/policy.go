@@ -0,0 +1,171 @@
+package config
+
+import "strconv"
+
+// ChatPolicy overrides the global moderation options for a single chat.
+// Fields left empty fall back to the values from the top level of the config.
+type ChatPolicy struct {
+	ChatID int64 `json:"chat_id"`
+
+	DeleteJoinMessages  *bool `json:"delete_join,omitempty"`
+	DeleteLeaveMessages *bool `json:"delete_leave,omitempty"`
+
+	DeleteServiceMessages *string `json:"delete_service,omitempty"`
+	DeleteServiceDelay    *int    `json:"delete_service_delay,omitempty"`
+
+	RestictOnJoin      *bool `json:"restrict_on_join,omitempty"`
+	RestrictOnJoinTime *int  `json:"restrict_on_join_time,omitempty"`
+
+	Captcha        *bool `json:"captcha,omitempty"`
+	CaptchaTimeout *int  `json:"captcha_timeout,omitempty"`
+
+	ManualApproval *bool `json:"manual_approval,omitempty"`
+
+	MemberPermissions *string `json:"member_permissions,omitempty"`
+}
+
+// Policy is the effective set of moderation rules for a chat.
+type Policy struct {
+	DeleteJoinMessages  bool
+	DeleteLeaveMessages bool
+
+	DeleteServiceMessages ServiceMessages
+	DeleteServiceDelay    int
+
+	RestictOnJoin      bool
+	RestrictOnJoinTime int
+
+	Captcha        bool
+	CaptchaTimeout int
+
+	ManualApproval bool
+
+	MemberPermissions MemberPermissions
+}
+
+// GetPolicy returns the rules for chatID, merging its ChatPolicy over the global values.
+func (c *Config) GetPolicy(chatID int64) Policy {
+	policy := Policy{
+		DeleteJoinMessages:    c.DeleteJoinMessages,
+		DeleteLeaveMessages:   c.DeleteLeaveMessages,
+		DeleteServiceMessages: c.DeleteServiceMessagesSet,
+		DeleteServiceDelay:    c.DeleteServiceDelay,
+		RestictOnJoin:         c.RestictOnJoin,
+		RestrictOnJoinTime:    c.RestrictOnJoinTime,
+		Captcha:               c.Captcha,
+		CaptchaTimeout:        c.CaptchaTimeout,
+		ManualApproval:        c.ManualApproval,
+		MemberPermissions:     c.MemberPermissionsSet,
+	}
+
+	chatPolicy, ok := c.ChatPoliciesMap[chatID]
+	if !ok {
+		return policy
+	}
+
+	if chatPolicy.DeleteJoinMessages != nil {
+		policy.DeleteJoinMessages = *chatPolicy.DeleteJoinMessages
+	}
+
+	if chatPolicy.DeleteLeaveMessages != nil {
+		policy.DeleteLeaveMessages = *chatPolicy.DeleteLeaveMessages
+	}
+
+	if chatPolicy.DeleteServiceMessages != nil {
+		if set, err := ParseServiceMessages(*chatPolicy.DeleteServiceMessages); err == nil {
+			policy.DeleteServiceMessages = set
+		}
+	}
+
+	if chatPolicy.DeleteServiceDelay != nil {
+		policy.DeleteServiceDelay = *chatPolicy.DeleteServiceDelay
+	}
+
+	if chatPolicy.RestictOnJoin != nil {
+		policy.RestictOnJoin = *chatPolicy.RestictOnJoin
+	}
+
+	if chatPolicy.RestrictOnJoinTime != nil {
+		policy.RestrictOnJoinTime = *chatPolicy.RestrictOnJoinTime
+	}
+
+	if chatPolicy.Captcha != nil {
+		policy.Captcha = *chatPolicy.Captcha
+	}
+
+	if chatPolicy.CaptchaTimeout != nil {
+		policy.CaptchaTimeout = *chatPolicy.CaptchaTimeout
+	}
+
+	if chatPolicy.ManualApproval != nil {
+		policy.ManualApproval = *chatPolicy.ManualApproval
+	}
+
+	if chatPolicy.MemberPermissions != nil {
+		if set, err := ParseMemberPermissions(*chatPolicy.MemberPermissions); err == nil {
+			policy.MemberPermissions = set
+		}
+	}
+
+	return policy
+}
+
+// Keys of the runtime policy overrides, matching the ChatPolicy JSON fields.
+const (
+	SettingDeleteJoin         = "delete_join"
+	SettingDeleteLeave        = "delete_leave"
+	SettingDeleteService      = "delete_service"
+	SettingDeleteServiceDelay = "delete_service_delay"
+	SettingRestrictOnJoin     = "restrict_on_join"
+	SettingRestrictOnJoinTime = "restrict_on_join_time"
+	SettingCaptcha            = "captcha"
+	SettingCaptchaTimeout     = "captcha_timeout"
+	SettingManualApproval     = "manual_approval"
+)
+
+// WithOverrides returns the policy with runtime overrides applied on top.
+// Unknown keys and unparsable values are ignored.
+func (p Policy) WithOverrides(overrides map[string]string) Policy {
+	for key, value := range overrides {
+		switch key {
+		case SettingDeleteJoin:
+			if v, err := strconv.ParseBool(value); err == nil {
+				p.DeleteJoinMessages = v
+			}
+		case SettingDeleteLeave:
+			if v, err := strconv.ParseBool(value); err == nil {
+				p.DeleteLeaveMessages = v
+			}
+		case SettingDeleteService:
+			if v, err := ParseServiceMessages(value); err == nil {
+				p.DeleteServiceMessages = v
+			}
+		case SettingDeleteServiceDelay:
+			if v, err := strconv.Atoi(value); err == nil && v >= 0 && v <= MaxEphemeralMessagesTTL {
+				p.DeleteServiceDelay = v
+			}
+		case SettingRestrictOnJoin:
+			if v, err := strconv.ParseBool(value); err == nil {
+				p.RestictOnJoin = v
+			}
+		case SettingRestrictOnJoinTime:
+			if v, err := strconv.Atoi(value); err == nil && v >= 0 {
+				p.RestrictOnJoinTime = v
+			}
+		case SettingCaptcha:
+			if v, err := strconv.ParseBool(value); err == nil {
+				p.Captcha = v
+			}
+		case SettingCaptchaTimeout:
+			if v, err := strconv.Atoi(value); err == nil && v >= MinCaptchaTimeout && v <= MaxCaptchaTimeout {
+				p.CaptchaTimeout = v
+			}
+		case SettingManualApproval:
+			if v, err := strconv.ParseBool(value); err == nil {
+				p.ManualApproval = v
+			}
+		}
+	}
+
+	return p
+}
@@ -0,0 +1,221 @@
+package config
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGetPolicy(t *testing.T) {
+	var config = &Config{
+		DeleteJoinMessages:  true,
+		DeleteLeaveMessages: true,
+		RestictOnJoin:       false,
+		RestrictOnJoinTime:  120,
+	}
+
+	raw := `[
+		{"chat_id": -1001, "delete_join": false, "restrict_on_join": true},
+		{"chat_id": -1002, "restrict_on_join_time": 600}
+	]`
+
+	if err := json.Unmarshal([]byte(raw), &config.ChatPolicies); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	config.ChatPoliciesMap = chatPoliciesByID(config.ChatPolicies)
+
+	tests := []struct {
+		name   string
+		chatID int64
+		want   Policy
+	}{
+		{
+			name:   "chat without policy uses global values",
+			chatID: -1003,
+			want:   Policy{DeleteJoinMessages: true, DeleteLeaveMessages: true, RestictOnJoin: false, RestrictOnJoinTime: 120},
+		},
+		{
+			name:   "overridden flags",
+			chatID: -1001,
+			want:   Policy{DeleteJoinMessages: false, DeleteLeaveMessages: true, RestictOnJoin: true, RestrictOnJoinTime: 120},
+		},
+		{
+			name:   "overridden restrict time",
+			chatID: -1002,
+			want:   Policy{DeleteJoinMessages: true, DeleteLeaveMessages: true, RestictOnJoin: false, RestrictOnJoinTime: 600},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := config.GetPolicy(tt.chatID); got != tt.want {
+				t.Fatalf("GetPolicy(%d) = %+v, want %+v", tt.chatID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyWithOverrides(t *testing.T) {
+	policy := Policy{DeleteJoinMessages: true, DeleteLeaveMessages: true, RestictOnJoin: false, RestrictOnJoinTime: 120, CaptchaTimeout: 120}
+
+	got := policy.WithOverrides(map[string]string{
+		SettingDeleteJoin:         "false",
+		SettingRestrictOnJoin:     "true",
+		SettingRestrictOnJoinTime: "-5",
+		SettingCaptcha:            "true",
+		SettingCaptchaTimeout:     "5",
+		SettingManualApproval:     "yes",
+		"unknown":                 "1",
+	})
+
+	want := Policy{DeleteJoinMessages: false, DeleteLeaveMessages: true, RestictOnJoin: true, RestrictOnJoinTime: 120, Captcha: true, CaptchaTimeout: 120}
+	if got != want {
+		t.Fatalf("WithOverrides() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseServiceMessages(t *testing.T) {
+	set, err := ParseServiceMessages(" pinned, forum_topic ,, boost")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !set.Has(ServicePinned) || !set.Has(ServiceForumTopic) || set.Has(ServiceTitle) {
+		t.Fatalf("unexpected set %q", set)
+	}
+
+	if got := set.String(); got != "pinned,forum_topic,boost" {
+		t.Fatalf("String() = %q", got)
+	}
+
+	if got := set.Toggle(ServicePinned).Toggle(ServiceTitle).String(); got != "title,forum_topic,boost" {
+		t.Fatalf("Toggle() = %q", got)
+	}
+
+	if all, err := ParseServiceMessages("all"); err != nil || all.String() != strings.Join(ServiceKinds, ",") {
+		t.Fatalf("ParseServiceMessages(all) = %q, %v", all, err)
+	}
+
+	if _, err := ParseServiceMessages("pinned,join"); err == nil {
+		t.Fatal("expected an error for an unknown kind")
+	}
+}
+
+func TestGetPolicyServiceMessages(t *testing.T) {
+	pinned := "pinned"
+	delay := 30
+
+	config := newDefaultConfig()
+	config.TelegramToken = "token"
+	config.DeleteServiceMessages = "title,photo"
+	config.DeleteServiceDelay = 5
+	config.ChatPolicies = []ChatPolicy{{ChatID: -1001, DeleteServiceMessages: &pinned, DeleteServiceDelay: &delay}}
+
+	if err := config.finalize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if policy := config.GetPolicy(-1002); policy.DeleteServiceMessages.String() != "title,photo" || policy.DeleteServiceDelay != 5 {
+		t.Fatalf("unexpected global policy %+v", policy)
+	}
+
+	if policy := config.GetPolicy(-1001); policy.DeleteServiceMessages.String() != "pinned" || policy.DeleteServiceDelay != 30 {
+		t.Fatalf("unexpected chat policy %+v", policy)
+	}
+}
+
+func TestParseMemberPermissions(t *testing.T) {
+	set, err := ParseMemberPermissions(" messages, photos ,, invite")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !set.Has(PermissionMessages) || !set.Has(PermissionInvite) || set.Has(PermissionPolls) {
+		t.Fatalf("unexpected set %q", set)
+	}
+
+	if got := set.String(); got != "messages,photos,invite" {
+		t.Fatalf("String() = %q", got)
+	}
+
+	if all, err := ParseMemberPermissions("all"); err != nil || all.String() != strings.Join(PermissionNames, ",") {
+		t.Fatalf("ParseMemberPermissions(all) = %q, %v", all, err)
+	}
+
+	if _, err := ParseMemberPermissions("messages,stickers"); err == nil {
+		t.Fatal("expected an error for an unknown permission")
+	}
+}
+
+func TestGetPolicyMemberPermissions(t *testing.T) {
+	readOnly := "messages"
+
+	config := newDefaultConfig()
+	config.TelegramToken = "token"
+	config.ChatPolicies = []ChatPolicy{{ChatID: -1001, MemberPermissions: &readOnly}}
+
+	if err := config.finalize(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := config.GetPolicy(-1002).MemberPermissions.String(); got != DefaultMemberPermissions {
+		t.Fatalf("unexpected global permissions %q", got)
+	}
+
+	if got := config.GetPolicy(-1001).MemberPermissions.String(); got != "messages" {
+		t.Fatalf("unexpected chat permissions %q", got)
+	}
+}
+
+func TestConversationsFor(t *testing.T) {
+	config := &Config{Conversations: []Conversation{
+		{Question: "Tower?"},
+		{Question: "Flat?", ChatID: -1001},
+		{Question: "Room?"},
+		{Question: "Floor?", ChatID: -1001},
+	}}
+
+	questions := func(conversations []Conversation) string {
+		list := []string{}
+		for _, conversation := range conversations {
+			list = append(list, conversation.Question)
+		}
+
+		return strings.Join(list, ",")
+	}
+
+	if got := questions(config.ConversationsFor(-1001)); got != "Flat?,Floor?" {
+		t.Fatalf("ConversationsFor(-1001) = %q", got)
+	}
+
+	if got := questions(config.ConversationsFor(-1002)); got != "Tower?,Room?" {
+		t.Fatalf("ConversationsFor(-1002) = %q", got)
+	}
+
+	if got := questions(config.ConversationsFor(0)); got != "Tower?,Room?" {
+		t.Fatalf("ConversationsFor(0) = %q", got)
+	}
+}
+
+func TestChatPoliciesFlag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "options.json")
+
+	config, err := loadConfig(path, []string{"", "-chatPolicies", `[{"chat_id": -1001, "captcha": true}]`})
+	if err != nil {
+		t.Fatalf("loadConfig error: %v", err)
+	}
+
+	if len(config.ChatPolicies) != 1 || config.ChatPolicies[0].ChatID != -1001 {
+		t.Fatalf("Expected the policies from the flag, got %+v", config.ChatPolicies)
+	}
+
+	// the flag wins over env like every other option
+	t.Setenv("CHAT_POLICIES", `[{"chat_id": -1002}]`)
+
+	config, err = loadConfig(path, []string{"", "-chatPolicies", `[{"chat_id": -1001}]`})
+	if err != nil || len(config.ChatPolicies) != 1 || config.ChatPolicies[0].ChatID != -1001 {
+		t.Fatalf("Expected the flag to override env, got %+v, %v", config.ChatPolicies, err)
+	}
+}
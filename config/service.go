@@ -0,0 +1,97 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Kinds of service messages that DELETE_SERVICE_MESSAGES can list.
+// Join and leave messages have their own DELETE_JOIN and DELETE_LEAVE.
+const (
+	ServicePinned     = "pinned"
+	ServiceTitle      = "title"
+	ServicePhoto      = "photo"
+	ServiceVideoChat  = "video_chat"
+	ServiceForumTopic = "forum_topic"
+	ServiceBoost      = "boost"
+	ServiceAutoDelete = "auto_delete"
+	ServiceBackground = "background"
+)
+
+// ServiceKinds lists every service message kind in a stable order.
+var ServiceKinds = []string{
+	ServicePinned,
+	ServiceTitle,
+	ServicePhoto,
+	ServiceVideoChat,
+	ServiceForumTopic,
+	ServiceBoost,
+	ServiceAutoDelete,
+	ServiceBackground,
+}
+
+// ServiceMessages is a set of service message kinds.
+type ServiceMessages uint16
+
+// ParseServiceMessages parses a comma separated list of service message
+// kinds; "all" selects every kind.
+func ParseServiceMessages(raw string) (ServiceMessages, error) {
+	var set ServiceMessages
+
+	for _, kind := range strings.Split(raw, ",") {
+		kind = strings.Trim(kind, "\n\t ")
+
+		switch {
+		case kind == "":
+		case kind == "all":
+			for _, kind := range ServiceKinds {
+				set = set.With(kind)
+			}
+		case slices.Contains(ServiceKinds, kind):
+			set = set.With(kind)
+		default:
+			return 0, fmt.Errorf("%q is not one of %s", kind, strings.Join(ServiceKinds, ", "))
+		}
+	}
+
+	return set, nil
+}
+
+// Has reports whether kind is in the set.
+func (set ServiceMessages) Has(kind string) bool {
+	index := slices.Index(ServiceKinds, kind)
+
+	return index >= 0 && set&(1<<index) != 0
+}
+
+// With returns the set with kind added.
+func (set ServiceMessages) With(kind string) ServiceMessages {
+	if index := slices.Index(ServiceKinds, kind); index >= 0 {
+		set |= 1 << index
+	}
+
+	return set
+}
+
+// Toggle returns the set with kind added or removed.
+func (set ServiceMessages) Toggle(kind string) ServiceMessages {
+	if index := slices.Index(ServiceKinds, kind); index >= 0 {
+		set ^= 1 << index
+	}
+
+	return set
+}
+
+// String returns the set as a comma separated list of kinds.
+func (set ServiceMessages) String() string {
+	kinds := []string{}
+
+	for _, kind := range ServiceKinds {
+		if set.Has(kind) {
+			kinds = append(kinds, kind)
+		}
+	}
+
+	return strings.Join(kinds, ",")
+}
@@ -0,0 +1,261 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ad/telegram-delete-join-messages/translations"
+)
+
+const redacted = "***"
+
+// webhookSecretPattern is what Telegram accepts as the secret_token of a webhook.
+var webhookSecretPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{0,256}$`)
+
+// FieldProblem is a single problem with a config field.
+type FieldProblem struct {
+	Field   string
+	Message string
+}
+
+// ValidationError lists every problem found in a config.
+type ValidationError struct {
+	Problems []FieldProblem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Problems))
+	for _, problem := range e.Problems {
+		lines = append(lines, fmt.Sprintf("%s: %s", problem.Field, problem.Message))
+	}
+
+	return fmt.Sprintf("invalid config: %s", strings.Join(lines, "; "))
+}
+
+// Add records a problem with field.
+func (e *ValidationError) Add(field, message string) {
+	e.Problems = append(e.Problems, FieldProblem{Field: field, Message: message})
+}
+
+func (e *ValidationError) errOrNil() error {
+	if len(e.Problems) == 0 {
+		return nil
+	}
+
+	return e
+}
+
+func (config *Config) validate(problems *ValidationError) {
+	if config.TelegramToken == "" {
+		problems.Add("TELEGRAM_TOKEN", "is required")
+	}
+
+	if config.RestrictOnJoinTime < 0 {
+		problems.Add("RESTRICT_ON_JOIN_TIME", "must not be negative")
+	}
+
+	if config.CaptchaTimeout < MinCaptchaTimeout || config.CaptchaTimeout > MaxCaptchaTimeout {
+		problems.Add("CAPTCHA_TIMEOUT", fmt.Sprintf("must be between %d and %d seconds", MinCaptchaTimeout, MaxCaptchaTimeout))
+	}
+
+	if config.JoinRequestTimeout < MinJoinRequestTimeout || config.JoinRequestTimeout > MaxJoinRequestTimeout {
+		problems.Add("JOIN_REQUEST_TIMEOUT", fmt.Sprintf("must be between %d and %d seconds", MinJoinRequestTimeout, MaxJoinRequestTimeout))
+	}
+
+	if config.DB_PATH != "" && !strings.HasSuffix(config.DB_PATH, ".db") && !strings.HasPrefix(config.DB_PATH, "postgres://") {
+		problems.Add("DB_PATH", fmt.Sprintf("%q must end with .db or start with postgres://", config.DB_PATH))
+	}
+
+	catalog := translations.Default()
+
+	if !catalog.HasLocale(config.AdminLocale) {
+		problems.Add("ADMIN_LOCALE", fmt.Sprintf("%q is not one of %v", config.AdminLocale, catalog.Locales()))
+	}
+
+	if !catalog.HasLocale(config.DefaultLocale) {
+		problems.Add("DEFAULT_LOCALE", fmt.Sprintf("%q is not one of %v", config.DefaultLocale, catalog.Locales()))
+	}
+
+	if config.OutboxQueueSize < 1 {
+		problems.Add("OUTBOX_QUEUE_SIZE", "must be at least 1")
+	}
+
+	if config.OutboxOverflowPolicy != OverflowDropOldest && config.OutboxOverflowPolicy != OverflowDropNewest {
+		problems.Add("OUTBOX_OVERFLOW_POLICY", fmt.Sprintf("%q is not one of %s, %s", config.OutboxOverflowPolicy, OverflowDropOldest, OverflowDropNewest))
+	}
+
+	if config.EphemeralMessagesTTL < 0 || config.EphemeralMessagesTTL > MaxEphemeralMessagesTTL {
+		problems.Add("EPHEMERAL_MESSAGES_TTL", fmt.Sprintf("must be between 0 and %d seconds", MaxEphemeralMessagesTTL))
+	}
+
+	if config.DeleteServiceDelay < 0 || config.DeleteServiceDelay > MaxEphemeralMessagesTTL {
+		problems.Add("DELETE_SERVICE_DELAY", fmt.Sprintf("must be between 0 and %d seconds", MaxEphemeralMessagesTTL))
+	}
+
+	if config.WebhookURL != "" {
+		if webhookURL, err := url.Parse(config.WebhookURL); err != nil || webhookURL.Scheme != "https" || webhookURL.Host == "" {
+			problems.Add("WEBHOOK_URL", fmt.Sprintf("%q is not an https URL", config.WebhookURL))
+		}
+
+		if !strings.HasPrefix(config.WebhookPath, "/") || config.WebhookPath == HealthPath {
+			problems.Add("WEBHOOK_PATH", fmt.Sprintf("must start with / and differ from %s", HealthPath))
+		}
+
+		if config.WebhookPort < 1 || config.WebhookPort > 65535 {
+			problems.Add("WEBHOOK_PORT", "must be between 1 and 65535")
+		}
+	}
+
+	if !webhookSecretPattern.MatchString(config.WebhookSecret) {
+		problems.Add("WEBHOOK_SECRET", "may only contain up to 256 characters A-Z, a-z, 0-9, _ and -")
+	}
+
+	if config.ConciergeMode && len(config.Conversations) == 0 {
+		problems.Add("CONVERSATIONS", "at least one conversation is required when CONCIERGE_MODE is enabled")
+	} else if config.ConciergeMode {
+		for _, chatID := range config.AllowedChatIDsList {
+			if len(config.ConversationsFor(chatID)) == 0 {
+				problems.Add("CONVERSATIONS", fmt.Sprintf("no questionnaire for %d, add stages with its chat_id or without chat_id", chatID))
+			}
+		}
+	}
+
+	for index, conversation := range config.Conversations {
+		field := fmt.Sprintf("CONVERSATIONS[%d]", index)
+
+		if conversation.ChatID != 0 && !slices.Contains(config.AllowedChatIDsList, conversation.ChatID) {
+			problems.Add(field+".chat_id", fmt.Sprintf("%d is not in ALLOWED_CHAT_IDS", conversation.ChatID))
+		}
+
+		if strings.TrimSpace(conversation.Question) == "" {
+			problems.Add(field+".question", "is required")
+		}
+
+		if strings.Trim(conversation.Variants, ", \n\t") == "" {
+			problems.Add(field+".variants", "is required")
+		}
+
+		if conversation.Keyboard != "" && conversation.Keyboard != KeyboardReply && conversation.Keyboard != KeyboardInline {
+			problems.Add(field+".keyboard", fmt.Sprintf("%q is not one of %s, %s", conversation.Keyboard, KeyboardReply, KeyboardInline))
+		}
+	}
+
+	seenPolicies := map[int64]bool{}
+
+	for index, policy := range config.ChatPolicies {
+		field := fmt.Sprintf("CHAT_POLICIES[%d]", index)
+
+		if policy.ChatID == 0 {
+			problems.Add(field+".chat_id", "is required")
+		} else if seenPolicies[policy.ChatID] {
+			problems.Add(field+".chat_id", fmt.Sprintf("duplicate policy for chat %d", policy.ChatID))
+		}
+
+		seenPolicies[policy.ChatID] = true
+
+		if policy.RestrictOnJoinTime != nil && *policy.RestrictOnJoinTime < 0 {
+			problems.Add(field+".restrict_on_join_time", "must not be negative")
+		}
+
+		if policy.CaptchaTimeout != nil && (*policy.CaptchaTimeout < MinCaptchaTimeout || *policy.CaptchaTimeout > MaxCaptchaTimeout) {
+			problems.Add(field+".captcha_timeout", fmt.Sprintf("must be between %d and %d seconds", MinCaptchaTimeout, MaxCaptchaTimeout))
+		}
+
+		if policy.DeleteServiceMessages != nil {
+			if _, err := ParseServiceMessages(*policy.DeleteServiceMessages); err != nil {
+				problems.Add(field+".delete_service", err.Error())
+			}
+		}
+
+		if policy.MemberPermissions != nil {
+			if _, err := ParseMemberPermissions(*policy.MemberPermissions); err != nil {
+				problems.Add(field+".member_permissions", err.Error())
+			}
+		}
+
+		if policy.DeleteServiceDelay != nil && (*policy.DeleteServiceDelay < 0 || *policy.DeleteServiceDelay > MaxEphemeralMessagesTTL) {
+			problems.Add(field+".delete_service_delay", fmt.Sprintf("must be between 0 and %d seconds", MaxEphemeralMessagesTTL))
+		}
+	}
+}
+
+// Redacted returns a copy of the config with secrets masked, safe to print.
+func (config *Config) Redacted() Config {
+	result := *config
+
+	if result.TelegramToken != "" {
+		result.TelegramToken = redacted
+	}
+
+	if result.YandexToken != "" {
+		result.YandexToken = redacted
+	}
+
+	if result.WebhookSecret != "" {
+		result.WebhookSecret = redacted
+	}
+
+	if dsn, err := url.Parse(result.DB_PATH); err == nil && dsn.User != nil {
+		if _, hasPassword := dsn.User.Password(); hasPassword {
+			dsn.User = url.UserPassword(dsn.User.Username(), redacted)
+			result.DB_PATH = dsn.String()
+		}
+	}
+
+	return result
+}
+
+// CheckConfig resolves the config the same way InitConfig does, prints it
+// with secrets redacted together with every problem found, and returns
+// an error if the config is invalid.
+func CheckConfig(w io.Writer, args []string) error {
+	return checkConfig(w, ConfigFileName, args)
+}
+
+func checkConfig(w io.Writer, path string, args []string) error {
+	config, err := loadConfig(path, args)
+	if err != nil {
+		return err
+	}
+
+	errFinalize := config.finalize()
+
+	// the bot would start from env and flags, but the file was meant to be used
+	if config.fileError != nil {
+		problems, ok := errFinalize.(*ValidationError)
+		if !ok {
+			problems = &ValidationError{}
+		}
+
+		problems.Problems = append([]FieldProblem{{Field: path, Message: config.fileError.Error()}}, problems.Problems...)
+		errFinalize = problems
+	}
+
+	resolved, err := json.MarshalIndent(config.Redacted(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "%s\n", resolved)
+	fmt.Fprintf(w, "admin IDs: %v\nallowed chat IDs: %v\n", config.TelegramAdminIDsList, config.AllowedChatIDsList)
+
+	if errFinalize != nil {
+		if problems, ok := errFinalize.(*ValidationError); ok {
+			fmt.Fprintf(w, "\n%d problem(s) found:\n", len(problems.Problems))
+			for _, problem := range problems.Problems {
+				fmt.Fprintf(w, "  %s: %s\n", problem.Field, problem.Message)
+			}
+		}
+
+		return errFinalize
+	}
+
+	fmt.Fprintln(w, "\nconfig is valid")
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const watchInterval = 5 * time.Second
+
+// Watcher reloads the config file on SIGHUP or when the file is modified.
+type Watcher struct {
+	path     string
+	args     []string
+	interval time.Duration
+
+	onReload func(*Config)
+	onError  func(error)
+
+	modTime time.Time
+	size    int64
+}
+
+// NewWatcher returns a Watcher for path. The config is resolved with the
+// command line args like at startup. onReload receives every successfully
+// parsed config, onError receives every failed reload attempt.
+func NewWatcher(path string, args []string, onReload func(*Config), onError func(error)) *Watcher {
+	w := &Watcher{
+		path:     path,
+		args:     args,
+		interval: watchInterval,
+		onReload: onReload,
+		onError:  onError,
+	}
+
+	w.modTime, w.size = w.stat()
+
+	return w
+}
+
+// Run blocks until ctx is cancelled.
+func (w *Watcher) Run(ctx context.Context) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sighup:
+			w.modTime, w.size = w.stat()
+			w.reload()
+		case <-ticker.C:
+			if w.changed() {
+				w.reload()
+			}
+		}
+	}
+}
+
+func (w *Watcher) changed() bool {
+	modTime, size := w.stat()
+	if modTime.IsZero() {
+		return false
+	}
+
+	if modTime.Equal(w.modTime) && size == w.size {
+		return false
+	}
+
+	w.modTime, w.size = modTime, size
+
+	return true
+}
+
+func (w *Watcher) stat() (time.Time, int64) {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return time.Time{}, 0
+	}
+
+	return info.ModTime(), info.Size()
+}
+
+func (w *Watcher) reload() {
+	config, err := ReloadConfig(w.path, w.args)
+	if err != nil {
+		if w.onError != nil {
+			w.onError(err)
+		}
+
+		return
+	}
+
+	if w.onReload != nil {
+		w.onReload(config)
+	}
+}
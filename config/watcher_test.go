@@ -0,0 +1,79 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcherReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "options.json")
+
+	if err := os.WriteFile(path, []byte(`{"TELEGRAM_TOKEN": "token", "TELEGRAM_ADMIN_IDS": "1"}`), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var (
+		reloaded  *Config
+		reloadErr error
+	)
+
+	w := NewWatcher(path, []string{""}, func(c *Config) { reloaded = c }, func(err error) { reloadErr = err })
+
+	// Test case 1: unchanged file is not reloaded
+	if w.changed() {
+		t.Fatalf("Expected unchanged file")
+	}
+
+	// Test case 2: valid modification is reloaded
+	if err := os.WriteFile(path, []byte(`{"TELEGRAM_TOKEN": "token", "TELEGRAM_ADMIN_IDS": "1,2"}`), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+
+	if !w.changed() {
+		t.Fatalf("Expected changed file")
+	}
+
+	w.reload()
+
+	if reloaded == nil || len(reloaded.TelegramAdminIDsList) != 2 {
+		t.Fatalf("Expected reloaded config with 2 admins, got %+v", reloaded)
+	}
+
+	// Test case 3: invalid file reports an error and keeps the previous config
+	reloaded = nil
+
+	if err := os.WriteFile(path, []byte(`{"TELEGRAM_TOKEN": `), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	w.reload()
+
+	if reloadErr == nil {
+		t.Fatalf("Expected reload error")
+	}
+
+	if reloaded != nil {
+		t.Fatalf("Expected no reload on invalid file")
+	}
+}
+
+func TestWatcherReloadFromEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "options.json")
+
+	t.Setenv("TELEGRAM_TOKEN", "token")
+	t.Setenv("TELEGRAM_ADMIN_IDS", "5")
+
+	var reloaded *Config
+
+	w := NewWatcher(path, []string{"", "-telegramAdminIDs", "5,6"}, func(c *Config) { reloaded = c }, func(err error) { t.Fatalf("unexpected reload error: %v", err) })
+
+	// without an options file env and flags apply, as at startup
+	w.reload()
+
+	if reloaded == nil || reloaded.TelegramToken != "token" || len(reloaded.TelegramAdminIDsList) != 2 {
+		t.Fatalf("Expected the config from env and flags, got %+v", reloaded)
+	}
+}
@@ -0,0 +1,45 @@
+package data
+
+import (
+	"time"
+)
+
+// Answer is the accepted answer of a user to one questionnaire stage.
+type Answer struct {
+	UserID     int64
+	GroupID    int64
+	Stage      int
+	Question   string
+	Answer     string // as typed by the user
+	Normalized string // the matching variant from the config
+	AnsweredAt time.Time
+}
+
+func (s *SQLStore) SaveAnswer(answer Answer) error {
+	_, err := s.exec(`INSERT INTO verification_answers (user_id, group_id, stage, question, answer, normalized, timestamp_answered) VALUES (?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (user_id, group_id, stage) DO UPDATE SET question = excluded.question, answer = excluded.answer, normalized = excluded.normalized, timestamp_answered = excluded.timestamp_answered`,
+		answer.UserID, answer.GroupID, answer.Stage, answer.Question, answer.Answer, answer.Normalized, answer.AnsweredAt.UTC())
+
+	return err
+}
+
+func (s *SQLStore) ListAnswers(userId int64) ([]Answer, error) {
+	rows, err := s.query(`SELECT user_id, group_id, stage, question, answer, normalized, timestamp_answered FROM verification_answers WHERE user_id = ? ORDER BY group_id, stage`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	answers := []Answer{}
+
+	for rows.Next() {
+		var answer Answer
+		if err := rows.Scan(&answer.UserID, &answer.GroupID, &answer.Stage, &answer.Question, &answer.Answer, &answer.Normalized, &answer.AnsweredAt); err != nil {
+			return nil, err
+		}
+
+		answers = append(answers, answer)
+	}
+
+	return answers, rows.Err()
+}
@@ -0,0 +1,62 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnswers(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		userID := int64(5000000001)
+		answeredAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+		for _, answer := range []Answer{
+			{UserID: userID, GroupID: -200, Stage: 0, Question: "Tower?", Answer: "b", Normalized: "B", AnsweredAt: answeredAt},
+			{UserID: userID, GroupID: -100, Stage: 1, Question: "Room?", Answer: "12", Normalized: "12", AnsweredAt: answeredAt},
+			{UserID: userID, GroupID: -100, Stage: 0, Question: "Tower?", Answer: "a", Normalized: "A", AnsweredAt: answeredAt},
+			{UserID: 1, GroupID: -100, Stage: 0, Question: "Tower?", Answer: "c", Normalized: "C", AnsweredAt: answeredAt},
+		} {
+			if err := store.SaveAnswer(answer); err != nil {
+				t.Fatalf("SaveAnswer error: %v", err)
+			}
+		}
+
+		// Answering a stage again replaces the previous answer
+		if err := store.SaveAnswer(Answer{UserID: userID, GroupID: -100, Stage: 1, Question: "Room?", Answer: " 13 ", Normalized: "13", AnsweredAt: answeredAt}); err != nil {
+			t.Fatalf("SaveAnswer replace error: %v", err)
+		}
+
+		answers, err := store.ListAnswers(userID)
+		if err != nil {
+			t.Fatalf("ListAnswers error: %v", err)
+		}
+
+		want := []struct {
+			groupID    int64
+			stage      int
+			normalized string
+		}{
+			{-200, 0, "B"},
+			{-100, 0, "A"},
+			{-100, 1, "13"},
+		}
+
+		if len(answers) != len(want) {
+			t.Fatalf("Expected %d answers, got %+v", len(want), answers)
+		}
+
+		for i, w := range want {
+			if answers[i].GroupID != w.groupID || answers[i].Stage != w.stage || answers[i].Normalized != w.normalized {
+				t.Errorf("answers[%d] = %+v, want group %d stage %d %q", i, answers[i], w.groupID, w.stage, w.normalized)
+			}
+
+			if !answers[i].AnsweredAt.Equal(answeredAt) {
+				t.Errorf("answers[%d].AnsweredAt = %v, want %v", i, answers[i].AnsweredAt, answeredAt)
+			}
+		}
+
+		if answers[2].Answer != " 13 " || answers[2].Question != "Room?" {
+			t.Errorf("Expected raw answer and question to be kept, got %+v", answers[2])
+		}
+	})
+}
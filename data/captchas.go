@@ -0,0 +1,58 @@
+package data
+
+import (
+	"time"
+)
+
+// Captcha is the challenge a member has to solve after joining a group.
+type Captcha struct {
+	ChatID    int64
+	UserID    int64
+	MessageID int // the challenge posted in the group
+	Answer    string
+	Deadline  time.Time
+}
+
+func (s *SQLStore) SaveCaptcha(captcha Captcha) error {
+	_, err := s.exec(`INSERT INTO captchas (chat_id, user_id, message_id, answer, timestamp_deadline) VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (chat_id, user_id) DO UPDATE SET message_id = excluded.message_id, answer = excluded.answer, timestamp_deadline = excluded.timestamp_deadline`,
+		captcha.ChatID, captcha.UserID, captcha.MessageID, captcha.Answer, captcha.Deadline.UTC())
+
+	return err
+}
+
+func (s *SQLStore) GetCaptcha(chatId, userId int64) (Captcha, error) {
+	captcha := Captcha{ChatID: chatId, UserID: userId}
+
+	err := s.queryRow(`SELECT message_id, answer, timestamp_deadline FROM captchas WHERE chat_id = ? AND user_id = ?`, chatId, userId).
+		Scan(&captcha.MessageID, &captcha.Answer, &captcha.Deadline)
+
+	return captcha, notFound(err)
+}
+
+func (s *SQLStore) ListExpiredCaptchas(before time.Time) ([]Captcha, error) {
+	rows, err := s.query(`SELECT chat_id, user_id, message_id, answer, timestamp_deadline FROM captchas WHERE timestamp_deadline < ? ORDER BY timestamp_deadline, chat_id, user_id`, before.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	captchas := []Captcha{}
+
+	for rows.Next() {
+		var captcha Captcha
+		if err := rows.Scan(&captcha.ChatID, &captcha.UserID, &captcha.MessageID, &captcha.Answer, &captcha.Deadline); err != nil {
+			return nil, err
+		}
+
+		captchas = append(captchas, captcha)
+	}
+
+	return captchas, rows.Err()
+}
+
+func (s *SQLStore) DeleteCaptcha(chatId, userId int64) error {
+	_, err := s.exec(`DELETE FROM captchas WHERE chat_id = ? AND user_id = ?`, chatId, userId)
+
+	return err
+}
@@ -0,0 +1,57 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCaptchas(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		deadline := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+		if _, err := store.GetCaptcha(-100, 5000000001); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound before saving, got %v", err)
+		}
+
+		for _, captcha := range []Captcha{
+			{ChatID: -100, UserID: 5000000001, MessageID: 10, Answer: "🍎", Deadline: deadline},
+			{ChatID: -100, UserID: 5000000001, MessageID: 11, Answer: "🚗", Deadline: deadline.Add(time.Minute)},
+			{ChatID: -200, UserID: 5000000001, MessageID: 12, Answer: "🐶", Deadline: deadline},
+		} {
+			if err := store.SaveCaptcha(captcha); err != nil {
+				t.Fatalf("SaveCaptcha error: %v", err)
+			}
+		}
+
+		captcha, err := store.GetCaptcha(-100, 5000000001)
+		if err != nil {
+			t.Fatalf("GetCaptcha error: %v", err)
+		}
+
+		if captcha.MessageID != 11 || captcha.Answer != "🚗" || !captcha.Deadline.Equal(deadline.Add(time.Minute)) {
+			t.Errorf("Expected the latest captcha to replace the previous one, got %+v", captcha)
+		}
+
+		expired, err := store.ListExpiredCaptchas(deadline.Add(time.Second))
+		if err != nil {
+			t.Fatalf("ListExpiredCaptchas error: %v", err)
+		}
+
+		if len(expired) != 1 || expired[0].ChatID != -200 || expired[0].MessageID != 12 || !expired[0].Deadline.Equal(deadline) {
+			t.Errorf("Expected only the captcha past its deadline, got %+v", expired)
+		}
+
+		if err := store.DeleteCaptcha(-100, 5000000001); err != nil {
+			t.Fatalf("DeleteCaptcha error: %v", err)
+		}
+
+		if _, err := store.GetCaptcha(-100, 5000000001); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound after deleting, got %v", err)
+		}
+
+		if _, err := store.GetCaptcha(-200, 5000000001); err != nil {
+			t.Errorf("Expected the captcha in the other chat to remain, got %v", err)
+		}
+	})
+}
@@ -2,12 +2,36 @@ package data
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 
+	_ "github.com/lib/pq"
 	_ "modernc.org/sqlite"
 )
 
-func InitSqliteDB(path string) (*sql.DB, error) {
+// SQLStore is a Store backed by SQLite or Postgres.
+type SQLStore struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// Open returns the store for DB_PATH: SQLite for a *.db file, Postgres for
+// a postgres:// DSN and an in-memory store when the path is empty.
+func Open(path string) (Store, error) {
+	switch {
+	case strings.HasSuffix(path, ".db"):
+		return InitSqliteDB(path)
+	case strings.HasPrefix(path, "postgres://"):
+		return InitPostgresDB(path)
+	case path == "":
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unsupported DB_PATH %q", path)
+	}
+}
+
+func InitSqliteDB(path string) (*SQLStore, error) {
 	// fmt.Println(path)
 
 	db, err := sql.Open("sqlite", path)
@@ -17,15 +41,16 @@ func InitSqliteDB(path string) (*sql.DB, error) {
 
 	db.SetMaxOpenConns(1)
 
-	errInitVotes := initSqliteVotes(db)
-	if errInitVotes != nil {
-		return nil, errInitVotes
+	errMigrate := Migrate(db, DialectSqlite)
+	if errMigrate != nil {
+		db.Close()
+		return nil, errMigrate
 	}
 
-	return db, nil
+	return &SQLStore{db: db, dialect: DialectSqlite}, nil
 }
 
-func InitPostgresDB(dsn string) (*sql.DB, error) {
+func InitPostgresDB(dsn string) (*SQLStore, error) {
 	fmt.Println("InitPostgresDB")
 
 	db, err := sql.Open("postgres", dsn)
@@ -33,56 +58,123 @@ func InitPostgresDB(dsn string) (*sql.DB, error) {
 		return nil, err
 	}
 
-	errInitVotes := initPostgresVotes(db)
-	if errInitVotes != nil {
-		return nil, errInitVotes
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
 	}
 
-	return db, nil
+	errMigrate := Migrate(db, DialectPostgres)
+	if errMigrate != nil {
+		db.Close()
+		return nil, errMigrate
+	}
+
+	return &SQLStore{db: db, dialect: DialectPostgres}, nil
 }
 
-func initSqliteVotes(db *sql.DB) error {
-	_, err := db.Exec(`
-CREATE TABLE IF NOT EXISTS "votes"  (
-  "id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
-  "user_id" integer NOT NULL,
-  "group_id" integer NOT NULL DEFAULT 0,
-  "vote" integer NOT NULL DEFAULT 0,
-  "state" integer NOT NULL DEFAULT 0,
-  "user_data" TEXT NOT NULL DEFAULT '',
-  "timestamp_created" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-  CONSTRAINT "votes_uniq" UNIQUE ("user_id" ASC, "group_id" ASC)
-);
-`)
-	return err
+// AppliedMigrations returns the schema versions applied to the database.
+func (s *SQLStore) AppliedMigrations() ([]int, error) {
+	return AppliedMigrations(s.db)
 }
 
-func initPostgresVotes(db *sql.DB) error {
-	_, err := db.Exec(`
-CREATE TABLE IF NOT EXISTS votes (
-  id SERIAL PRIMARY KEY,
-  user_id integer NOT NULL,
-  group_id integer NOT NULL DEFAULT 0,
-  vote integer NOT NULL DEFAULT 0,
-  state integer NOT NULL DEFAULT 0,
-  user_data TEXT NOT NULL DEFAULT '',
-  timestamp_created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-  CONSTRAINT votes_uniq UNIQUE (user_id, group_id)
-);
-`)
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
 
-	return err
+func (s *SQLStore) exec(statement string, args ...any) (sql.Result, error) {
+	return s.db.Exec(rebind(s.dialect, statement), args...)
 }
 
-func AddVote(db *sql.DB, userId, groupId int64, vote, user_data string) error {
-	_, err := db.Exec(`INSERT INTO votes (user_id, group_id, vote, user_data, state) VALUES (?, ?, ?, ?, 1)`, userId, groupId, vote, user_data)
+func (s *SQLStore) query(statement string, args ...any) (*sql.Rows, error) {
+	return s.db.Query(rebind(s.dialect, statement), args...)
+}
+
+func (s *SQLStore) queryRow(statement string, args ...any) *sql.Row {
+	return s.db.QueryRow(rebind(s.dialect, statement), args...)
+}
+
+func (s *SQLStore) AddVote(userId, groupId int64, vote, user_data string) error {
+	_, err := s.exec(`INSERT INTO votes (user_id, group_id, vote, user_data, state) VALUES (?, ?, ?, ?, 1)`, userId, groupId, vote, user_data)
 
 	return err
 }
 
-func CheckVote(db *sql.DB, userId, groupId int64) (int, error) {
-	var vote int
-	err := db.QueryRow(`SELECT vote FROM votes WHERE user_id = ? AND group_id = ? AND state = 1`, userId, groupId).Scan(&vote)
+func (s *SQLStore) CheckVote(userId, groupId int64) (string, error) {
+	var vote string
+	err := s.queryRow(`SELECT vote FROM votes WHERE user_id = ? AND group_id = ? AND state = 1`, userId, groupId).Scan(&vote)
+
+	return vote, notFound(err)
+}
+
+func (s *SQLStore) ListVotes(userId int64) (map[int64]string, error) {
+	rows, err := s.query(`SELECT group_id, vote FROM votes WHERE user_id = ? AND state = 1`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	votes := map[int64]string{}
+
+	for rows.Next() {
+		var (
+			groupId int64
+			vote    string
+		)
+
+		if err := rows.Scan(&groupId, &vote); err != nil {
+			return nil, err
+		}
+
+		votes[groupId] = vote
+	}
+
+	return votes, rows.Err()
+}
+
+// LegacyVotes returns the number of votes stored before verification was
+// per group, AdoptLegacyVotes assigns them to the allowed groups.
+func (s *SQLStore) LegacyVotes() (int64, error) {
+	var legacy int64
+	err := s.queryRow(`SELECT COUNT(*) FROM votes WHERE group_id = user_id`).Scan(&legacy)
+
+	return legacy, err
+}
+
+func (s *SQLStore) AdoptLegacyVotes(groupIds []int64) (int64, error) {
+	legacy, err := s.LegacyVotes()
+	if err != nil || legacy == 0 || len(groupIds) == 0 {
+		return 0, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	for _, groupId := range groupIds {
+		_, err := tx.Exec(rebind(s.dialect, `
+INSERT INTO votes (user_id, group_id, vote, state, user_data, timestamp_created)
+SELECT user_id, ?, vote, state, user_data, timestamp_created FROM votes legacy
+WHERE legacy.group_id = legacy.user_id
+  AND NOT EXISTS (SELECT 1 FROM votes adopted WHERE adopted.user_id = legacy.user_id AND adopted.group_id = ?)`), groupId, groupId)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM votes WHERE group_id = user_id`); err != nil {
+		return 0, err
+	}
+
+	return legacy, tx.Commit()
+}
+
+// notFound maps sql.ErrNoRows to ErrNotFound.
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
 
-	return vote, err
+	return err
 }
@@ -0,0 +1,125 @@
+package data
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVotes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		userID := int64(5000000001)
+		groupID := int64(-1001234567890)
+
+		if _, err := store.CheckVote(userID, groupID); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound before voting, got %v", err)
+		}
+
+		if err := store.AddVote(userID, groupID, "42", "id 5000000001 Test"); err != nil {
+			t.Fatalf("AddVote error: %v", err)
+		}
+
+		vote, err := store.CheckVote(userID, groupID)
+		if err != nil {
+			t.Fatalf("CheckVote error: %v", err)
+		}
+
+		if vote != "42" {
+			t.Fatalf("Expected vote 42, got %q", vote)
+		}
+
+		if _, err := store.CheckVote(userID, -100); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound for another group, got %v", err)
+		}
+
+		if err := store.AddVote(userID, groupID, "43", ""); err == nil {
+			t.Fatalf("Expected an error on second vote")
+		}
+
+		if err := store.AddVote(userID, -100, "Seven", ""); err != nil {
+			t.Fatalf("AddVote for another group error: %v", err)
+		}
+
+		votes, err := store.ListVotes(userID)
+		if err != nil {
+			t.Fatalf("ListVotes error: %v", err)
+		}
+
+		if len(votes) != 2 || votes[groupID] != "42" || votes[-100] != "Seven" {
+			t.Fatalf("Unexpected votes: %v", votes)
+		}
+
+		if votes, err := store.ListVotes(1); err != nil || len(votes) != 0 {
+			t.Fatalf("Expected no votes for another user, got %v, %v", votes, err)
+		}
+	})
+}
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		query   string
+		want    string
+	}{
+		{DialectSqlite, `SELECT 1 WHERE a = ? AND b = ?`, `SELECT 1 WHERE a = ? AND b = ?`},
+		{DialectPostgres, `SELECT 1 WHERE a = ? AND b = ?`, `SELECT 1 WHERE a = $1 AND b = $2`},
+		{DialectPostgres, `SELECT '?' WHERE a = ?`, `SELECT '?' WHERE a = $1`},
+		{DialectPostgres, `SELECT 1`, `SELECT 1`},
+	}
+
+	for _, tt := range tests {
+		if got := rebind(tt.dialect, tt.query); got != tt.want {
+			t.Errorf("rebind(%s, %q) = %q, want %q", tt.dialect, tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestAdoptLegacyVotes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		for _, vote := range []struct {
+			userID, groupID int64
+			vote            string
+		}{
+			{100, 100, "1"},
+			{200, 200, "2"},
+			{200, -1001, "Seven"},
+		} {
+			if err := store.AddVote(vote.userID, vote.groupID, vote.vote, ""); err != nil {
+				t.Fatalf("AddVote error: %v", err)
+			}
+		}
+
+		if legacy, err := store.AdoptLegacyVotes(nil); err != nil || legacy != 0 {
+			t.Fatalf("Expected nothing adopted without groups, got %d, %v", legacy, err)
+		}
+
+		sqlStore, isSQL := store.(*SQLStore)
+		if isSQL {
+			if legacy, err := sqlStore.LegacyVotes(); err != nil || legacy != 2 {
+				t.Fatalf("Expected 2 legacy votes before adopting, got %d, %v", legacy, err)
+			}
+		}
+
+		legacy, err := store.AdoptLegacyVotes([]int64{-1001, -1002})
+		if err != nil || legacy != 2 {
+			t.Fatalf("Expected 2 legacy votes, got %d, %v", legacy, err)
+		}
+
+		if votes, err := store.ListVotes(100); err != nil || len(votes) != 2 || votes[-1001] != "1" || votes[-1002] != "1" {
+			t.Errorf("Unexpected votes of 100: %v, %v", votes, err)
+		}
+
+		if votes, err := store.ListVotes(200); err != nil || len(votes) != 2 || votes[-1001] != "Seven" || votes[-1002] != "2" {
+			t.Errorf("Unexpected votes of 200: %v, %v", votes, err)
+		}
+
+		if legacy, err := store.AdoptLegacyVotes([]int64{-1001}); err != nil || legacy != 0 {
+			t.Errorf("Expected no legacy votes left, got %d, %v", legacy, err)
+		}
+
+		if isSQL {
+			if legacy, err := sqlStore.LegacyVotes(); err != nil || legacy != 0 {
+				t.Errorf("Expected no legacy votes counted after adopting, got %d, %v", legacy, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package data
+
+import (
+	"time"
+)
+
+// ConversationState is the questionnaire progress of a user.
+type ConversationState struct {
+	UserID         int64
+	GroupID        int64 // the group the user is being verified for
+	Stage          int
+	StageUpdatedAt time.Time
+}
+
+func (s *SQLStore) SaveConversation(state ConversationState) error {
+	_, err := s.exec(`INSERT INTO conversations (user_id, group_id, stage, timestamp_stage_updated) VALUES (?, ?, ?, ?)
+ON CONFLICT (user_id) DO UPDATE SET group_id = excluded.group_id, stage = excluded.stage, timestamp_stage_updated = excluded.timestamp_stage_updated`,
+		state.UserID, state.GroupID, state.Stage, state.StageUpdatedAt.UTC())
+
+	return err
+}
+
+func (s *SQLStore) DeleteConversation(userId int64) error {
+	_, err := s.exec(`DELETE FROM conversations WHERE user_id = ?`, userId)
+
+	return err
+}
+
+func (s *SQLStore) ListConversations() ([]ConversationState, error) {
+	rows, err := s.query(`SELECT user_id, group_id, stage, timestamp_stage_updated FROM conversations ORDER BY user_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	states := []ConversationState{}
+
+	for rows.Next() {
+		var state ConversationState
+		if err := rows.Scan(&state.UserID, &state.GroupID, &state.Stage, &state.StageUpdatedAt); err != nil {
+			return nil, err
+		}
+
+		states = append(states, state)
+	}
+
+	return states, rows.Err()
+}
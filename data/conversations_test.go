@@ -0,0 +1,48 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConversations(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		updatedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+		for _, state := range []ConversationState{
+			{UserID: 5000000002, GroupID: -100, Stage: 0, StageUpdatedAt: updatedAt},
+			{UserID: 5000000001, GroupID: -200, Stage: 0, StageUpdatedAt: updatedAt},
+			{UserID: 5000000001, GroupID: -200, Stage: 2, StageUpdatedAt: updatedAt.Add(time.Minute)},
+		} {
+			if err := store.SaveConversation(state); err != nil {
+				t.Fatalf("SaveConversation error: %v", err)
+			}
+		}
+
+		states, err := store.ListConversations()
+		if err != nil {
+			t.Fatalf("ListConversations error: %v", err)
+		}
+
+		if len(states) != 2 {
+			t.Fatalf("Expected 2 conversations, got %+v", states)
+		}
+
+		if states[0].UserID != 5000000001 || states[0].GroupID != -200 || states[0].Stage != 2 || !states[0].StageUpdatedAt.Equal(updatedAt.Add(time.Minute)) {
+			t.Errorf("Expected the latest stage to replace the previous one, got %+v", states[0])
+		}
+
+		if err := store.DeleteConversation(5000000001); err != nil {
+			t.Fatalf("DeleteConversation error: %v", err)
+		}
+
+		states, err = store.ListConversations()
+		if err != nil {
+			t.Fatalf("ListConversations error: %v", err)
+		}
+
+		if len(states) != 1 || states[0].UserID != 5000000002 {
+			t.Fatalf("Expected only the other conversation to remain, got %+v", states)
+		}
+	})
+}
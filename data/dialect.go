@@ -0,0 +1,38 @@
+package data
+
+import (
+	"strconv"
+	"strings"
+)
+
+// rebind rewrites the "?" placeholders of query into the form used by dialect.
+// Queries are written with "?" and converted to "$1, $2, ..." for Postgres.
+func rebind(dialect Dialect, statement string) string {
+	if dialect != DialectPostgres || !strings.Contains(statement, "?") {
+		return statement
+	}
+
+	var (
+		result  strings.Builder
+		index   int
+		inQuote bool
+	)
+
+	result.Grow(len(statement) + 8)
+
+	for _, ch := range statement {
+		switch {
+		case ch == '\'':
+			inQuote = !inQuote
+			result.WriteRune(ch)
+		case ch == '?' && !inQuote:
+			index++
+			result.WriteByte('$')
+			result.WriteString(strconv.Itoa(index))
+		default:
+			result.WriteRune(ch)
+		}
+	}
+
+	return result.String()
+}
@@ -0,0 +1,57 @@
+package data
+
+import (
+	"time"
+)
+
+// PendingJoinRequest is a join request left pending while the user answers
+// the questionnaire, it is declined at the deadline.
+type PendingJoinRequest struct {
+	ChatID   int64
+	UserID   int64
+	Deadline time.Time
+}
+
+func (s *SQLStore) SavePendingJoinRequest(request PendingJoinRequest) error {
+	_, err := s.exec(`INSERT INTO pending_join_requests (chat_id, user_id, timestamp_deadline) VALUES (?, ?, ?)
+ON CONFLICT (chat_id, user_id) DO UPDATE SET timestamp_deadline = excluded.timestamp_deadline`,
+		request.ChatID, request.UserID, request.Deadline.UTC())
+
+	return err
+}
+
+func (s *SQLStore) GetPendingJoinRequest(chatId, userId int64) (PendingJoinRequest, error) {
+	request := PendingJoinRequest{ChatID: chatId, UserID: userId}
+
+	err := s.queryRow(`SELECT timestamp_deadline FROM pending_join_requests WHERE chat_id = ? AND user_id = ?`, chatId, userId).
+		Scan(&request.Deadline)
+
+	return request, notFound(err)
+}
+
+func (s *SQLStore) ListExpiredPendingJoinRequests(before time.Time) ([]PendingJoinRequest, error) {
+	rows, err := s.query(`SELECT chat_id, user_id, timestamp_deadline FROM pending_join_requests WHERE timestamp_deadline < ? ORDER BY timestamp_deadline, chat_id, user_id`, before.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []PendingJoinRequest{}
+
+	for rows.Next() {
+		var request PendingJoinRequest
+		if err := rows.Scan(&request.ChatID, &request.UserID, &request.Deadline); err != nil {
+			return nil, err
+		}
+
+		requests = append(requests, request)
+	}
+
+	return requests, rows.Err()
+}
+
+func (s *SQLStore) DeletePendingJoinRequest(chatId, userId int64) error {
+	_, err := s.exec(`DELETE FROM pending_join_requests WHERE chat_id = ? AND user_id = ?`, chatId, userId)
+
+	return err
+}
@@ -0,0 +1,57 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPendingJoinRequests(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		deadline := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+		if _, err := store.GetPendingJoinRequest(-100, 5000000001); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound before saving, got %v", err)
+		}
+
+		for _, request := range []PendingJoinRequest{
+			{ChatID: -100, UserID: 5000000001, Deadline: deadline},
+			{ChatID: -100, UserID: 5000000001, Deadline: deadline.Add(time.Hour)},
+			{ChatID: -200, UserID: 5000000001, Deadline: deadline},
+		} {
+			if err := store.SavePendingJoinRequest(request); err != nil {
+				t.Fatalf("SavePendingJoinRequest error: %v", err)
+			}
+		}
+
+		request, err := store.GetPendingJoinRequest(-100, 5000000001)
+		if err != nil {
+			t.Fatalf("GetPendingJoinRequest error: %v", err)
+		}
+
+		if !request.Deadline.Equal(deadline.Add(time.Hour)) {
+			t.Errorf("Expected the latest deadline, got %+v", request)
+		}
+
+		expired, err := store.ListExpiredPendingJoinRequests(deadline.Add(time.Second))
+		if err != nil {
+			t.Fatalf("ListExpiredPendingJoinRequests error: %v", err)
+		}
+
+		if len(expired) != 1 || expired[0].ChatID != -200 || expired[0].UserID != 5000000001 || !expired[0].Deadline.Equal(deadline) {
+			t.Errorf("Expected only the request past its deadline, got %+v", expired)
+		}
+
+		if err := store.DeletePendingJoinRequest(-100, 5000000001); err != nil {
+			t.Fatalf("DeletePendingJoinRequest error: %v", err)
+		}
+
+		if _, err := store.GetPendingJoinRequest(-100, 5000000001); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound after deleting, got %v", err)
+		}
+
+		if _, err := store.GetPendingJoinRequest(-200, 5000000001); err != nil {
+			t.Errorf("Expected the request to the other group to remain, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,437 @@
+package data
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+type memoryKey struct {
+	userId  int64
+	groupId int64
+}
+
+type memoryAnswerKey struct {
+	memoryKey
+	stage int
+}
+
+// MemoryStore is a Store that keeps everything in process memory.
+// It is used when DB_PATH is empty and in tests; data is lost on restart.
+type MemoryStore struct {
+	mu            sync.RWMutex
+	votes         map[memoryKey]string
+	answers       map[memoryAnswerKey]Answer
+	conversations map[int64]ConversationState
+	outbox        []OutboxMessage
+	outboxID      int64
+	settings      map[int64]map[string]string
+	captchas      map[memoryKey]Captcha
+	notifications map[memoryKey][]JoinRequestNotification
+	joinRequests  map[memoryKey]PendingJoinRequest
+	decisions     map[memoryKey]JoinRequestDecision
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		votes:         make(map[memoryKey]string),
+		answers:       make(map[memoryAnswerKey]Answer),
+		conversations: make(map[int64]ConversationState),
+		settings:      make(map[int64]map[string]string),
+		captchas:      make(map[memoryKey]Captcha),
+		notifications: make(map[memoryKey][]JoinRequestNotification),
+		joinRequests:  make(map[memoryKey]PendingJoinRequest),
+		decisions:     make(map[memoryKey]JoinRequestDecision),
+	}
+}
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+func (m *MemoryStore) AddVote(userId, groupId int64, vote, _ string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := memoryKey{userId: userId, groupId: groupId}
+	if _, ok := m.votes[key]; ok {
+		return fmt.Errorf("vote of user %d for group %d already exists", userId, groupId)
+	}
+
+	m.votes[key] = vote
+
+	return nil
+}
+
+func (m *MemoryStore) CheckVote(userId, groupId int64) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	vote, ok := m.votes[memoryKey{userId: userId, groupId: groupId}]
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	return vote, nil
+}
+
+func (m *MemoryStore) ListVotes(userId int64) (map[int64]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	votes := map[int64]string{}
+
+	for key, vote := range m.votes {
+		if key.userId == userId {
+			votes[key.groupId] = vote
+		}
+	}
+
+	return votes, nil
+}
+
+func (m *MemoryStore) AdoptLegacyVotes(groupIds []int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(groupIds) == 0 {
+		return 0, nil
+	}
+
+	var legacy int64
+
+	for key, vote := range m.votes {
+		if key.groupId != key.userId {
+			continue
+		}
+
+		for _, groupId := range groupIds {
+			adopted := memoryKey{userId: key.userId, groupId: groupId}
+			if _, ok := m.votes[adopted]; !ok {
+				m.votes[adopted] = vote
+			}
+		}
+
+		delete(m.votes, key)
+		legacy++
+	}
+
+	return legacy, nil
+}
+
+func (m *MemoryStore) SaveAnswer(answer Answer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := memoryAnswerKey{memoryKey: memoryKey{userId: answer.UserID, groupId: answer.GroupID}, stage: answer.Stage}
+	m.answers[key] = answer
+
+	return nil
+}
+
+func (m *MemoryStore) ListAnswers(userId int64) ([]Answer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	answers := []Answer{}
+
+	for key, answer := range m.answers {
+		if key.userId == userId {
+			answers = append(answers, answer)
+		}
+	}
+
+	slices.SortFunc(answers, func(a, b Answer) int {
+		if c := cmp.Compare(a.GroupID, b.GroupID); c != 0 {
+			return c
+		}
+
+		return cmp.Compare(a.Stage, b.Stage)
+	})
+
+	return answers, nil
+}
+
+func (m *MemoryStore) SaveConversation(state ConversationState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.conversations[state.UserID] = state
+
+	return nil
+}
+
+func (m *MemoryStore) DeleteConversation(userId int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.conversations, userId)
+
+	return nil
+}
+
+func (m *MemoryStore) ListConversations() ([]ConversationState, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	states := slices.Collect(maps.Values(m.conversations))
+	slices.SortFunc(states, func(a, b ConversationState) int {
+		return cmp.Compare(a.UserID, b.UserID)
+	})
+
+	return states, nil
+}
+
+func (m *MemoryStore) AddOutbox(message OutboxMessage) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.outboxID++
+
+	message.ID = m.outboxID
+	message.Status = OutboxPending
+	message.CreatedAt = time.Now()
+	message.UpdatedAt = message.CreatedAt
+
+	m.outbox = append(m.outbox, message)
+
+	return message.ID, nil
+}
+
+func (m *MemoryStore) UpdateOutbox(message OutboxMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.outbox {
+		if m.outbox[i].ID == message.ID {
+			m.outbox[i].Status = message.Status
+			m.outbox[i].Attempts = message.Attempts
+			m.outbox[i].LastError = message.LastError
+			m.outbox[i].UpdatedAt = time.Now()
+		}
+	}
+
+	return nil
+}
+
+func (m *MemoryStore) ListOutbox(status OutboxStatus) ([]OutboxMessage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	messages := []OutboxMessage{}
+
+	for _, message := range m.outbox {
+		if message.Status == status {
+			messages = append(messages, message)
+		}
+	}
+
+	return messages, nil
+}
+
+func (m *MemoryStore) PruneOutbox(before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := len(m.outbox)
+
+	m.outbox = slices.DeleteFunc(m.outbox, func(message OutboxMessage) bool {
+		return (message.Status == OutboxSent || message.Status == OutboxDropped) && message.UpdatedAt.Before(before)
+	})
+
+	return int64(count - len(m.outbox)), nil
+}
+
+func (m *MemoryStore) SaveCaptcha(captcha Captcha) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.captchas[memoryKey{userId: captcha.UserID, groupId: captcha.ChatID}] = captcha
+
+	return nil
+}
+
+func (m *MemoryStore) GetCaptcha(chatId, userId int64) (Captcha, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	captcha, ok := m.captchas[memoryKey{userId: userId, groupId: chatId}]
+	if !ok {
+		return Captcha{}, ErrNotFound
+	}
+
+	return captcha, nil
+}
+
+func (m *MemoryStore) ListExpiredCaptchas(before time.Time) ([]Captcha, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	captchas := []Captcha{}
+
+	for _, captcha := range m.captchas {
+		if captcha.Deadline.Before(before) {
+			captchas = append(captchas, captcha)
+		}
+	}
+
+	slices.SortFunc(captchas, func(a, b Captcha) int {
+		return cmp.Or(a.Deadline.Compare(b.Deadline), cmp.Compare(a.ChatID, b.ChatID), cmp.Compare(a.UserID, b.UserID))
+	})
+
+	return captchas, nil
+}
+
+func (m *MemoryStore) DeleteCaptcha(chatId, userId int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.captchas, memoryKey{userId: userId, groupId: chatId})
+
+	return nil
+}
+
+func (m *MemoryStore) AddJoinRequestNotification(notification JoinRequestNotification) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := memoryKey{userId: notification.UserID, groupId: notification.ChatID}
+
+	notifications := slices.DeleteFunc(m.notifications[key], func(n JoinRequestNotification) bool {
+		return n.AdminID == notification.AdminID
+	})
+
+	m.notifications[key] = append(notifications, notification)
+
+	return nil
+}
+
+func (m *MemoryStore) ListJoinRequestNotifications(chatId, userId int64) ([]JoinRequestNotification, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	notifications := slices.Clone(m.notifications[memoryKey{userId: userId, groupId: chatId}])
+	if notifications == nil {
+		notifications = []JoinRequestNotification{}
+	}
+
+	slices.SortFunc(notifications, func(a, b JoinRequestNotification) int {
+		return cmp.Compare(a.AdminID, b.AdminID)
+	})
+
+	return notifications, nil
+}
+
+func (m *MemoryStore) DeleteJoinRequestNotifications(chatId, userId int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.notifications, memoryKey{userId: userId, groupId: chatId})
+
+	return nil
+}
+
+func (m *MemoryStore) SaveJoinRequestDecision(decision JoinRequestDecision) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.decisions[memoryKey{userId: decision.UserID, groupId: decision.ChatID}] = decision
+
+	return nil
+}
+
+func (m *MemoryStore) GetJoinRequestDecision(chatId, userId int64) (JoinRequestDecision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	decision, ok := m.decisions[memoryKey{userId: userId, groupId: chatId}]
+	if !ok {
+		return JoinRequestDecision{}, ErrNotFound
+	}
+
+	return decision, nil
+}
+
+func (m *MemoryStore) SavePendingJoinRequest(request PendingJoinRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.joinRequests[memoryKey{userId: request.UserID, groupId: request.ChatID}] = request
+
+	return nil
+}
+
+func (m *MemoryStore) GetPendingJoinRequest(chatId, userId int64) (PendingJoinRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	request, ok := m.joinRequests[memoryKey{userId: userId, groupId: chatId}]
+	if !ok {
+		return PendingJoinRequest{}, ErrNotFound
+	}
+
+	return request, nil
+}
+
+func (m *MemoryStore) ListExpiredPendingJoinRequests(before time.Time) ([]PendingJoinRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	requests := []PendingJoinRequest{}
+
+	for _, request := range m.joinRequests {
+		if request.Deadline.Before(before) {
+			requests = append(requests, request)
+		}
+	}
+
+	slices.SortFunc(requests, func(a, b PendingJoinRequest) int {
+		return cmp.Or(a.Deadline.Compare(b.Deadline), cmp.Compare(a.ChatID, b.ChatID), cmp.Compare(a.UserID, b.UserID))
+	})
+
+	return requests, nil
+}
+
+func (m *MemoryStore) DeletePendingJoinRequest(chatId, userId int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.joinRequests, memoryKey{userId: userId, groupId: chatId})
+
+	return nil
+}
+
+func (m *MemoryStore) SetSetting(groupId int64, key, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.settings[groupId]; !ok {
+		m.settings[groupId] = make(map[string]string)
+	}
+
+	m.settings[groupId][key] = value
+
+	return nil
+}
+
+func (m *MemoryStore) GetSettings(groupId int64) (map[string]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	settings := make(map[string]string, len(m.settings[groupId]))
+	maps.Copy(settings, m.settings[groupId])
+
+	return settings, nil
+}
+
+func (m *MemoryStore) DeleteSettings(groupId int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.settings, groupId)
+
+	return nil
+}
@@ -0,0 +1,371 @@
+package data
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Dialect is the SQL flavour of a database connection.
+type Dialect string
+
+const (
+	DialectSqlite   Dialect = "sqlite"
+	DialectPostgres Dialect = "postgres"
+)
+
+// migration is a single schema change, written for every dialect.
+// An empty statement means the change is not needed for that dialect,
+// but the version is still recorded as applied.
+type migration struct {
+	version  int
+	name     string
+	sqlite   string
+	postgres string
+}
+
+// migrations are applied in order and must never be edited once released,
+// add a new one instead.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create votes",
+		sqlite: `
+CREATE TABLE IF NOT EXISTS "votes"  (
+  "id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  "user_id" integer NOT NULL,
+  "group_id" integer NOT NULL DEFAULT 0,
+  "vote" integer NOT NULL DEFAULT 0,
+  "state" integer NOT NULL DEFAULT 0,
+  "user_data" TEXT NOT NULL DEFAULT '',
+  "timestamp_created" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT "votes_uniq" UNIQUE ("user_id" ASC, "group_id" ASC)
+);
+`,
+		postgres: `
+CREATE TABLE IF NOT EXISTS votes (
+  id SERIAL PRIMARY KEY,
+  user_id integer NOT NULL,
+  group_id integer NOT NULL DEFAULT 0,
+  vote integer NOT NULL DEFAULT 0,
+  state integer NOT NULL DEFAULT 0,
+  user_data TEXT NOT NULL DEFAULT '',
+  timestamp_created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT votes_uniq UNIQUE (user_id, group_id)
+);
+`,
+	},
+	{
+		version: 2,
+		name:    "create settings",
+		sqlite: `
+CREATE TABLE IF NOT EXISTS "settings"  (
+  "id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  "group_id" integer NOT NULL DEFAULT 0,
+  "key" TEXT NOT NULL,
+  "value" TEXT NOT NULL DEFAULT '',
+  "timestamp_updated" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT "settings_uniq" UNIQUE ("group_id" ASC, "key" ASC)
+);
+`,
+		postgres: `
+CREATE TABLE IF NOT EXISTS settings (
+  id SERIAL PRIMARY KEY,
+  group_id bigint NOT NULL DEFAULT 0,
+  key TEXT NOT NULL,
+  value TEXT NOT NULL DEFAULT '',
+  timestamp_updated TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT settings_uniq UNIQUE (group_id, key)
+);
+`,
+	},
+	{
+		// Telegram user and supergroup IDs do not fit into a 32-bit integer.
+		// SQLite integers are always 64-bit, so only Postgres needs the change.
+		version: 3,
+		name:    "widen votes ids to bigint",
+		postgres: `
+ALTER TABLE votes ALTER COLUMN user_id TYPE bigint;
+ALTER TABLE votes ALTER COLUMN group_id TYPE bigint;
+`,
+	},
+	{
+		version:  4,
+		name:     "index votes by user",
+		sqlite:   `CREATE INDEX IF NOT EXISTS "votes_user_id_idx" ON "votes" ("user_id");`,
+		postgres: `CREATE INDEX IF NOT EXISTS votes_user_id_idx ON votes (user_id);`,
+	},
+	{
+		// Votes hold the raw answer to the last stage, which is not always a number.
+		// SQLite keeps non-numeric values of an integer column as text already.
+		version:  5,
+		name:     "store votes as text",
+		postgres: `ALTER TABLE votes ALTER COLUMN vote TYPE TEXT USING vote::TEXT, ALTER COLUMN vote SET DEFAULT '';`,
+	},
+	{
+		version: 6,
+		name:    "create verification answers",
+		sqlite: `
+CREATE TABLE IF NOT EXISTS "verification_answers"  (
+  "id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  "user_id" integer NOT NULL,
+  "group_id" integer NOT NULL DEFAULT 0,
+  "stage" integer NOT NULL DEFAULT 0,
+  "question" TEXT NOT NULL DEFAULT '',
+  "answer" TEXT NOT NULL DEFAULT '',
+  "normalized" TEXT NOT NULL DEFAULT '',
+  "timestamp_answered" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT "verification_answers_uniq" UNIQUE ("user_id" ASC, "group_id" ASC, "stage" ASC)
+);
+`,
+		postgres: `
+CREATE TABLE IF NOT EXISTS verification_answers (
+  id SERIAL PRIMARY KEY,
+  user_id bigint NOT NULL,
+  group_id bigint NOT NULL DEFAULT 0,
+  stage integer NOT NULL DEFAULT 0,
+  question TEXT NOT NULL DEFAULT '',
+  answer TEXT NOT NULL DEFAULT '',
+  normalized TEXT NOT NULL DEFAULT '',
+  timestamp_answered TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT verification_answers_uniq UNIQUE (user_id, group_id, stage)
+);
+`,
+	},
+	{
+		version: 7,
+		name:    "create conversations",
+		sqlite: `
+CREATE TABLE IF NOT EXISTS "conversations"  (
+  "user_id" integer NOT NULL PRIMARY KEY,
+  "group_id" integer NOT NULL DEFAULT 0,
+  "stage" integer NOT NULL DEFAULT 0,
+  "timestamp_stage_updated" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+`,
+		postgres: `
+CREATE TABLE IF NOT EXISTS conversations (
+  user_id bigint PRIMARY KEY,
+  group_id bigint NOT NULL DEFAULT 0,
+  stage integer NOT NULL DEFAULT 0,
+  timestamp_stage_updated TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+`,
+	},
+	{
+		version: 8,
+		name:    "create outbox",
+		sqlite: `
+CREATE TABLE IF NOT EXISTS "outbox"  (
+  "id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  "chat_id" integer NOT NULL,
+  "payload" TEXT NOT NULL DEFAULT '',
+  "status" TEXT NOT NULL DEFAULT 'pending',
+  "attempts" integer NOT NULL DEFAULT 0,
+  "last_error" TEXT NOT NULL DEFAULT '',
+  "timestamp_created" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "timestamp_updated" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS "outbox_status_idx" ON "outbox" ("status", "id");
+`,
+		postgres: `
+CREATE TABLE IF NOT EXISTS outbox (
+  id BIGSERIAL PRIMARY KEY,
+  chat_id bigint NOT NULL,
+  payload TEXT NOT NULL DEFAULT '',
+  status TEXT NOT NULL DEFAULT 'pending',
+  attempts integer NOT NULL DEFAULT 0,
+  last_error TEXT NOT NULL DEFAULT '',
+  timestamp_created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  timestamp_updated TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS outbox_status_idx ON outbox (status, id);
+`,
+	},
+	{
+		version: 9,
+		name:    "create captchas",
+		sqlite: `
+CREATE TABLE IF NOT EXISTS "captchas"  (
+  "chat_id" integer NOT NULL,
+  "user_id" integer NOT NULL,
+  "message_id" integer NOT NULL DEFAULT 0,
+  "answer" TEXT NOT NULL DEFAULT '',
+  "timestamp_deadline" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY ("chat_id", "user_id")
+);
+`,
+		postgres: `
+CREATE TABLE IF NOT EXISTS captchas (
+  chat_id bigint NOT NULL,
+  user_id bigint NOT NULL,
+  message_id bigint NOT NULL DEFAULT 0,
+  answer TEXT NOT NULL DEFAULT '',
+  timestamp_deadline TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (chat_id, user_id)
+);
+`,
+	},
+	{
+		version: 10,
+		name:    "create join request notifications",
+		sqlite: `
+CREATE TABLE IF NOT EXISTS "join_request_notifications"  (
+  "chat_id" integer NOT NULL,
+  "user_id" integer NOT NULL,
+  "admin_id" integer NOT NULL,
+  "message_id" integer NOT NULL DEFAULT 0,
+  PRIMARY KEY ("chat_id", "user_id", "admin_id")
+);
+`,
+		postgres: `
+CREATE TABLE IF NOT EXISTS join_request_notifications (
+  chat_id bigint NOT NULL,
+  user_id bigint NOT NULL,
+  admin_id bigint NOT NULL,
+  message_id bigint NOT NULL DEFAULT 0,
+  PRIMARY KEY (chat_id, user_id, admin_id)
+);
+`,
+	},
+	{
+		version: 11,
+		name:    "create pending join requests",
+		sqlite: `
+CREATE TABLE IF NOT EXISTS "pending_join_requests"  (
+  "chat_id" integer NOT NULL,
+  "user_id" integer NOT NULL,
+  "timestamp_deadline" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY ("chat_id", "user_id")
+);
+`,
+		postgres: `
+CREATE TABLE IF NOT EXISTS pending_join_requests (
+  chat_id bigint NOT NULL,
+  user_id bigint NOT NULL,
+  timestamp_deadline TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (chat_id, user_id)
+);
+`,
+	},
+	{
+		version: 12,
+		name:    "create join request decisions",
+		sqlite: `
+CREATE TABLE IF NOT EXISTS "join_request_decisions"  (
+  "chat_id" integer NOT NULL,
+  "user_id" integer NOT NULL,
+  "decision" TEXT NOT NULL DEFAULT '',
+  "decided_by" TEXT NOT NULL DEFAULT '',
+  PRIMARY KEY ("chat_id", "user_id")
+);
+`,
+		postgres: `
+CREATE TABLE IF NOT EXISTS join_request_decisions (
+  chat_id bigint NOT NULL,
+  user_id bigint NOT NULL,
+  decision TEXT NOT NULL DEFAULT '',
+  decided_by TEXT NOT NULL DEFAULT '',
+  PRIMARY KEY (chat_id, user_id)
+);
+`,
+	},
+}
+
+func (m migration) statement(dialect Dialect) string {
+	if dialect == DialectPostgres {
+		return m.postgres
+	}
+
+	return m.sqlite
+}
+
+// Migrate creates the schema_migrations table and applies every migration
+// that has not been applied yet, each in its own transaction.
+func Migrate(db *sql.DB, dialect Dialect) error {
+	if dialect != DialectSqlite && dialect != DialectPostgres {
+		return fmt.Errorf("unknown dialect %q", dialect)
+	}
+
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS schema_migrations (
+  version integer NOT NULL PRIMARY KEY,
+  name TEXT NOT NULL DEFAULT '',
+  timestamp_applied TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	applied, err := AppliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	done := make(map[int]bool, len(applied))
+	for _, version := range applied {
+		done[version] = true
+	}
+
+	for _, m := range migrations {
+		if done[m.version] {
+			continue
+		}
+
+		if err := applyMigration(db, dialect, m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+	}
+
+	return nil
+}
+
+func applyMigration(db *sql.DB, dialect Dialect, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if statement := m.statement(dialect); statement != "" {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(rebind(dialect, `INSERT INTO schema_migrations (version, name) VALUES (?, ?)`), m.version, m.name); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AppliedMigrations returns the versions recorded in schema_migrations in ascending order.
+func AppliedMigrations(db *sql.DB) ([]int, error) {
+	rows, err := db.Query(`SELECT version FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []int{}
+
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+
+		versions = append(versions, version)
+	}
+
+	return versions, rows.Err()
+}
+
+// LatestMigration returns the version of the newest known migration.
+func LatestMigration() int {
+	return migrations[len(migrations)-1].version
+}
@@ -0,0 +1,101 @@
+package data
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestMigrate(t *testing.T) {
+	forEachSQLStore(t, func(t *testing.T, store *SQLStore) {
+		applied, err := store.AppliedMigrations()
+		if err != nil {
+			t.Fatalf("AppliedMigrations error: %v", err)
+		}
+
+		if len(applied) != len(migrations) || applied[len(applied)-1] != LatestMigration() {
+			t.Fatalf("Expected all %d migrations to be applied, got %v", len(migrations), applied)
+		}
+
+		// Running again must be a no-op
+		if err := Migrate(store.db, store.dialect); err != nil {
+			t.Fatalf("second Migrate error: %v", err)
+		}
+	})
+}
+
+func TestMigrateSqliteReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	store, err := InitSqliteDB(path)
+	if err != nil {
+		t.Fatalf("InitSqliteDB error: %v", err)
+	}
+
+	applied, err := store.AppliedMigrations()
+	if err != nil {
+		t.Fatalf("AppliedMigrations error: %v", err)
+	}
+
+	if len(applied) != len(migrations) || applied[len(applied)-1] != LatestMigration() {
+		t.Fatalf("Expected all %d migrations to be applied, got %v", len(migrations), applied)
+	}
+
+	// Running again must be a no-op
+	store.Close()
+
+	// Reopening does not re-apply migrations
+	store, err = InitSqliteDB(path)
+	if err != nil {
+		t.Fatalf("reopen InitSqliteDB error: %v", err)
+	}
+	defer store.Close()
+
+	applied, err = store.AppliedMigrations()
+	if err != nil {
+		t.Fatalf("AppliedMigrations error: %v", err)
+	}
+
+	if len(applied) != len(migrations) {
+		t.Fatalf("Expected %d applied migrations after reopen, got %v", len(migrations), applied)
+	}
+}
+
+func TestMigrateLegacySqlite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+
+	// A database created before migrations existed already has the votes table
+	legacy, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("sql.Open error: %v", err)
+	}
+
+	if _, err := legacy.Exec(migrations[0].sqlite); err != nil {
+		t.Fatalf("create legacy votes error: %v", err)
+	}
+
+	if _, err := legacy.Exec(`INSERT INTO votes (user_id, group_id, vote, user_data, state) VALUES (1, 1, 5, '', 1)`); err != nil {
+		t.Fatalf("insert legacy vote error: %v", err)
+	}
+
+	legacy.Close()
+
+	store, err := InitSqliteDB(path)
+	if err != nil {
+		t.Fatalf("InitSqliteDB on legacy database error: %v", err)
+	}
+	defer store.Close()
+
+	vote, err := store.CheckVote(1, 1)
+	if err != nil || vote != "5" {
+		t.Fatalf("Expected legacy vote to survive migration, got %q, %v", vote, err)
+	}
+}
+
+func TestMigrateUnknownDialect(t *testing.T) {
+	if err := Migrate(nil, Dialect("mysql")); err == nil {
+		t.Fatalf("Expected error for unknown dialect")
+	}
+}
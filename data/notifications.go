@@ -0,0 +1,71 @@
+package data
+
+// JoinRequestNotification is the message an admin got about a join request
+// waiting for their decision.
+type JoinRequestNotification struct {
+	ChatID    int64
+	UserID    int64
+	AdminID   int64
+	MessageID int
+}
+
+// JoinRequestDecision is the admins' decision on a join request in
+// MANUAL_APPROVAL mode, Decision is empty until an admin decides.
+type JoinRequestDecision struct {
+	ChatID    int64
+	UserID    int64
+	Decision  string
+	DecidedBy string
+}
+
+func (s *SQLStore) SaveJoinRequestDecision(decision JoinRequestDecision) error {
+	_, err := s.exec(`INSERT INTO join_request_decisions (chat_id, user_id, decision, decided_by) VALUES (?, ?, ?, ?)
+ON CONFLICT (chat_id, user_id) DO UPDATE SET decision = excluded.decision, decided_by = excluded.decided_by`,
+		decision.ChatID, decision.UserID, decision.Decision, decision.DecidedBy)
+
+	return err
+}
+
+func (s *SQLStore) GetJoinRequestDecision(chatId, userId int64) (JoinRequestDecision, error) {
+	decision := JoinRequestDecision{ChatID: chatId, UserID: userId}
+
+	err := s.queryRow(`SELECT decision, decided_by FROM join_request_decisions WHERE chat_id = ? AND user_id = ?`, chatId, userId).
+		Scan(&decision.Decision, &decision.DecidedBy)
+
+	return decision, notFound(err)
+}
+
+func (s *SQLStore) AddJoinRequestNotification(notification JoinRequestNotification) error {
+	_, err := s.exec(`INSERT INTO join_request_notifications (chat_id, user_id, admin_id, message_id) VALUES (?, ?, ?, ?)
+ON CONFLICT (chat_id, user_id, admin_id) DO UPDATE SET message_id = excluded.message_id`,
+		notification.ChatID, notification.UserID, notification.AdminID, notification.MessageID)
+
+	return err
+}
+
+func (s *SQLStore) ListJoinRequestNotifications(chatId, userId int64) ([]JoinRequestNotification, error) {
+	rows, err := s.query(`SELECT admin_id, message_id FROM join_request_notifications WHERE chat_id = ? AND user_id = ? ORDER BY admin_id`, chatId, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []JoinRequestNotification{}
+
+	for rows.Next() {
+		notification := JoinRequestNotification{ChatID: chatId, UserID: userId}
+		if err := rows.Scan(&notification.AdminID, &notification.MessageID); err != nil {
+			return nil, err
+		}
+
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, rows.Err()
+}
+
+func (s *SQLStore) DeleteJoinRequestNotifications(chatId, userId int64) error {
+	_, err := s.exec(`DELETE FROM join_request_notifications WHERE chat_id = ? AND user_id = ?`, chatId, userId)
+
+	return err
+}
@@ -0,0 +1,71 @@
+package data
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestJoinRequestNotifications(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		for _, notification := range []JoinRequestNotification{
+			{ChatID: -100, UserID: 5000000001, AdminID: 2, MessageID: 20},
+			{ChatID: -100, UserID: 5000000001, AdminID: 1, MessageID: 10},
+			{ChatID: -100, UserID: 5000000001, AdminID: 1, MessageID: 11},
+			{ChatID: -200, UserID: 5000000001, AdminID: 1, MessageID: 30},
+		} {
+			if err := store.AddJoinRequestNotification(notification); err != nil {
+				t.Fatalf("AddJoinRequestNotification error: %v", err)
+			}
+		}
+
+		notifications, err := store.ListJoinRequestNotifications(-100, 5000000001)
+		if err != nil {
+			t.Fatalf("ListJoinRequestNotifications error: %v", err)
+		}
+
+		if len(notifications) != 2 || notifications[0].AdminID != 1 || notifications[0].MessageID != 11 || notifications[1].MessageID != 20 {
+			t.Fatalf("Expected the notifications of both admins with the latest message, got %+v", notifications)
+		}
+
+		if err := store.DeleteJoinRequestNotifications(-100, 5000000001); err != nil {
+			t.Fatalf("DeleteJoinRequestNotifications error: %v", err)
+		}
+
+		if notifications, err := store.ListJoinRequestNotifications(-100, 5000000001); err != nil || len(notifications) != 0 {
+			t.Errorf("Expected no notifications after deleting, got %+v, %v", notifications, err)
+		}
+
+		if notifications, err := store.ListJoinRequestNotifications(-200, 5000000001); err != nil || len(notifications) != 1 {
+			t.Errorf("Expected the notification about the other chat to remain, got %+v, %v", notifications, err)
+		}
+	})
+}
+
+func TestJoinRequestDecisions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		if _, err := store.GetJoinRequestDecision(-100, 5000000001); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound before the request, got %v", err)
+		}
+
+		if err := store.SaveJoinRequestDecision(JoinRequestDecision{ChatID: -100, UserID: 5000000001}); err != nil {
+			t.Fatalf("SaveJoinRequestDecision error: %v", err)
+		}
+
+		if decision, err := store.GetJoinRequestDecision(-100, 5000000001); err != nil || decision.Decision != "" {
+			t.Fatalf("Expected an undecided request, got %+v, %v", decision, err)
+		}
+
+		if err := store.SaveJoinRequestDecision(JoinRequestDecision{ChatID: -100, UserID: 5000000001, Decision: "ban", DecidedBy: "@boss"}); err != nil {
+			t.Fatalf("SaveJoinRequestDecision error: %v", err)
+		}
+
+		decision, err := store.GetJoinRequestDecision(-100, 5000000001)
+		if err != nil || decision.Decision != "ban" || decision.DecidedBy != "@boss" {
+			t.Fatalf("Expected the ban by @boss, got %+v, %v", decision, err)
+		}
+
+		if _, err := store.GetJoinRequestDecision(-200, 5000000001); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound for another group, got %v", err)
+		}
+	})
+}
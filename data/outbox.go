@@ -0,0 +1,74 @@
+package data
+
+import (
+	"time"
+)
+
+// OutboxStatus is the delivery status of an outgoing request.
+type OutboxStatus string
+
+const (
+	OutboxPending OutboxStatus = "pending" // waiting to be sent, replayed on startup
+	OutboxSent    OutboxStatus = "sent"
+	OutboxFailed  OutboxStatus = "failed"
+	OutboxDropped OutboxStatus = "dropped" // discarded by the overflow policy
+)
+
+// OutboxMessage is an outgoing Telegram request persisted until it is delivered.
+type OutboxMessage struct {
+	ID        int64
+	ChatID    int64
+	Payload   string // the request encoded by the sender
+	Status    OutboxStatus
+	Attempts  int
+	LastError string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (s *SQLStore) AddOutbox(message OutboxMessage) (int64, error) {
+	now := time.Now().UTC()
+
+	var id int64
+	err := s.queryRow(`INSERT INTO outbox (chat_id, payload, status, timestamp_created, timestamp_updated) VALUES (?, ?, ?, ?, ?) RETURNING id`,
+		message.ChatID, message.Payload, OutboxPending, now, now).Scan(&id)
+
+	return id, err
+}
+
+func (s *SQLStore) UpdateOutbox(message OutboxMessage) error {
+	_, err := s.exec(`UPDATE outbox SET status = ?, attempts = ?, last_error = ?, timestamp_updated = ? WHERE id = ?`,
+		message.Status, message.Attempts, message.LastError, time.Now().UTC(), message.ID)
+
+	return err
+}
+
+func (s *SQLStore) ListOutbox(status OutboxStatus) ([]OutboxMessage, error) {
+	rows, err := s.query(`SELECT id, chat_id, payload, status, attempts, last_error, timestamp_created, timestamp_updated FROM outbox WHERE status = ? ORDER BY id`, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []OutboxMessage{}
+
+	for rows.Next() {
+		var message OutboxMessage
+		if err := rows.Scan(&message.ID, &message.ChatID, &message.Payload, &message.Status, &message.Attempts, &message.LastError, &message.CreatedAt, &message.UpdatedAt); err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, message)
+	}
+
+	return messages, rows.Err()
+}
+
+func (s *SQLStore) PruneOutbox(before time.Time) (int64, error) {
+	result, err := s.exec(`DELETE FROM outbox WHERE status IN (?, ?) AND timestamp_updated < ?`, OutboxSent, OutboxDropped, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,66 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOutbox(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		first, err := store.AddOutbox(OutboxMessage{ChatID: 5000000001, Payload: `{"method":"sendMessage"}`})
+		if err != nil {
+			t.Fatalf("AddOutbox error: %v", err)
+		}
+
+		second, err := store.AddOutbox(OutboxMessage{ChatID: -1001234567890, Payload: `{"method":"forwardMessage"}`})
+		if err != nil {
+			t.Fatalf("AddOutbox error: %v", err)
+		}
+
+		if second <= first {
+			t.Fatalf("Expected increasing IDs, got %d then %d", first, second)
+		}
+
+		pending, err := store.ListOutbox(OutboxPending)
+		if err != nil {
+			t.Fatalf("ListOutbox error: %v", err)
+		}
+
+		if len(pending) != 2 || pending[0].ID != first || pending[1].ChatID != -1001234567890 || pending[1].Payload != `{"method":"forwardMessage"}` {
+			t.Fatalf("Unexpected pending messages: %+v", pending)
+		}
+
+		if err := store.UpdateOutbox(OutboxMessage{ID: first, Status: OutboxSent, Attempts: 1}); err != nil {
+			t.Fatalf("UpdateOutbox error: %v", err)
+		}
+
+		if err := store.UpdateOutbox(OutboxMessage{ID: second, Status: OutboxFailed, Attempts: 2, LastError: "Forbidden"}); err != nil {
+			t.Fatalf("UpdateOutbox error: %v", err)
+		}
+
+		if pending, err := store.ListOutbox(OutboxPending); err != nil || len(pending) != 0 {
+			t.Fatalf("Expected no pending messages, got %+v, %v", pending, err)
+		}
+
+		failed, err := store.ListOutbox(OutboxFailed)
+		if err != nil {
+			t.Fatalf("ListOutbox error: %v", err)
+		}
+
+		if len(failed) != 1 || failed[0].Attempts != 2 || failed[0].LastError != "Forbidden" {
+			t.Fatalf("Unexpected failed messages: %+v", failed)
+		}
+
+		if pruned, err := store.PruneOutbox(time.Now().Add(-time.Hour)); err != nil || pruned != 0 {
+			t.Fatalf("Expected recent messages to be kept, got %d, %v", pruned, err)
+		}
+
+		if pruned, err := store.PruneOutbox(time.Now().Add(time.Hour)); err != nil || pruned != 1 {
+			t.Fatalf("Expected only the sent message to be pruned, got %d, %v", pruned, err)
+		}
+
+		if failed, err := store.ListOutbox(OutboxFailed); err != nil || len(failed) != 1 {
+			t.Fatalf("Expected failed message to be kept, got %+v, %v", failed, err)
+		}
+	})
+}
@@ -0,0 +1,35 @@
+package data
+
+func (s *SQLStore) SetSetting(groupId int64, key, value string) error {
+	_, err := s.exec(`INSERT INTO settings (group_id, key, value) VALUES (?, ?, ?)
+ON CONFLICT (group_id, key) DO UPDATE SET value = excluded.value, timestamp_updated = CURRENT_TIMESTAMP`, groupId, key, value)
+
+	return err
+}
+
+func (s *SQLStore) GetSettings(groupId int64) (map[string]string, error) {
+	rows, err := s.query(`SELECT key, value FROM settings WHERE group_id = ?`, groupId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := map[string]string{}
+
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+
+		settings[key] = value
+	}
+
+	return settings, rows.Err()
+}
+
+func (s *SQLStore) DeleteSettings(groupId int64) error {
+	_, err := s.exec(`DELETE FROM settings WHERE group_id = ?`, groupId)
+
+	return err
+}
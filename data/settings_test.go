@@ -0,0 +1,52 @@
+package data
+
+import (
+	"testing"
+)
+
+func TestSettings(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		if err := store.SetSetting(-1001234567890, "delete_join", "true"); err != nil {
+			t.Fatalf("SetSetting error: %v", err)
+		}
+
+		if err := store.SetSetting(-1001234567890, "delete_join", "false"); err != nil {
+			t.Fatalf("SetSetting overwrite error: %v", err)
+		}
+
+		if err := store.SetSetting(-200, "delete_join", "true"); err != nil {
+			t.Fatalf("SetSetting error: %v", err)
+		}
+
+		settings, err := store.GetSettings(-1001234567890)
+		if err != nil {
+			t.Fatalf("GetSettings error: %v", err)
+		}
+
+		if len(settings) != 1 || settings["delete_join"] != "false" {
+			t.Fatalf("unexpected settings: %v", settings)
+		}
+
+		if err := store.DeleteSettings(-1001234567890); err != nil {
+			t.Fatalf("DeleteSettings error: %v", err)
+		}
+
+		settings, err = store.GetSettings(-1001234567890)
+		if err != nil {
+			t.Fatalf("GetSettings error: %v", err)
+		}
+
+		if len(settings) != 0 {
+			t.Fatalf("expected no settings after delete, got %v", settings)
+		}
+
+		settings, err = store.GetSettings(-200)
+		if err != nil {
+			t.Fatalf("GetSettings error: %v", err)
+		}
+
+		if settings["delete_join"] != "true" {
+			t.Fatalf("expected other group settings to be kept, got %v", settings)
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package data
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when a requested record does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Store is the persistence layer of the bot. Every table gets its methods
+// here, so the SQL and in-memory implementations stay interchangeable.
+type Store interface {
+	// AddVote records a successful verification of a user for a group.
+	AddVote(userId, groupId int64, vote, userData string) error
+	// CheckVote returns the vote of a user for a group or ErrNotFound.
+	CheckVote(userId, groupId int64) (string, error)
+	// ListVotes returns the votes of a user keyed by group.
+	ListVotes(userId int64) (map[int64]string, error)
+	// AdoptLegacyVotes copies the votes stored before verification was per
+	// group, with the user ID as group, to each of the groups and removes
+	// them. It returns the number of legacy votes.
+	AdoptLegacyVotes(groupIds []int64) (int64, error)
+
+	// SaveAnswer stores the answer to a questionnaire stage, replacing a previous one.
+	SaveAnswer(answer Answer) error
+	// ListAnswers returns every stored answer of a user ordered by group and stage.
+	ListAnswers(userId int64) ([]Answer, error)
+
+	// SaveConversation stores the questionnaire progress of a user, replacing the previous one.
+	SaveConversation(state ConversationState) error
+	// DeleteConversation removes the questionnaire progress of a user.
+	DeleteConversation(userId int64) error
+	// ListConversations returns the progress of every unfinished questionnaire.
+	ListConversations() ([]ConversationState, error)
+
+	// AddOutbox stores a new pending outgoing request and returns its ID.
+	AddOutbox(message OutboxMessage) (int64, error)
+	// UpdateOutbox saves the status, attempts and last error of an outgoing request.
+	UpdateOutbox(message OutboxMessage) error
+	// ListOutbox returns the outgoing requests with status, oldest first.
+	ListOutbox(status OutboxStatus) ([]OutboxMessage, error)
+	// PruneOutbox deletes sent and dropped requests last updated before the given time.
+	PruneOutbox(before time.Time) (int64, error)
+
+	// SaveCaptcha stores the pending captcha of a member, replacing the previous one.
+	SaveCaptcha(captcha Captcha) error
+	// GetCaptcha returns the pending captcha of a member or ErrNotFound.
+	GetCaptcha(chatId, userId int64) (Captcha, error)
+	// ListExpiredCaptchas returns the captchas with a deadline before the given time, earliest first.
+	ListExpiredCaptchas(before time.Time) ([]Captcha, error)
+	// DeleteCaptcha removes the pending captcha of a member.
+	DeleteCaptcha(chatId, userId int64) error
+
+	// AddJoinRequestNotification remembers the message an admin was notified
+	// about a join request with, replacing the previous one of that admin.
+	AddJoinRequestNotification(notification JoinRequestNotification) error
+	// ListJoinRequestNotifications returns the notifications about a join request ordered by admin.
+	ListJoinRequestNotifications(chatId, userId int64) ([]JoinRequestNotification, error)
+	// DeleteJoinRequestNotifications forgets the notifications about a join request.
+	DeleteJoinRequestNotifications(chatId, userId int64) error
+	// SaveJoinRequestDecision stores the decision on a join request, replacing the previous one.
+	SaveJoinRequestDecision(decision JoinRequestDecision) error
+	// GetJoinRequestDecision returns the decision on a join request or ErrNotFound.
+	GetJoinRequestDecision(chatId, userId int64) (JoinRequestDecision, error)
+
+	// SavePendingJoinRequest stores a join request left pending for the questionnaire, replacing the previous one.
+	SavePendingJoinRequest(request PendingJoinRequest) error
+	// GetPendingJoinRequest returns the pending join request of a user to a group or ErrNotFound.
+	GetPendingJoinRequest(chatId, userId int64) (PendingJoinRequest, error)
+	// ListExpiredPendingJoinRequests returns the pending join requests with a deadline before the given time, earliest first.
+	ListExpiredPendingJoinRequests(before time.Time) ([]PendingJoinRequest, error)
+	// DeletePendingJoinRequest forgets the pending join request of a user to a group.
+	DeletePendingJoinRequest(chatId, userId int64) error
+
+	// SetSetting stores a runtime override for a group, replacing the previous value.
+	SetSetting(groupId int64, key, value string) error
+	// GetSettings returns all runtime overrides stored for a group.
+	GetSettings(groupId int64) (map[string]string, error)
+	// DeleteSettings removes all runtime overrides of a group.
+	DeleteSettings(groupId int64) error
+
+	Close() error
+}
+
+var (
+	_ Store = (*SQLStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
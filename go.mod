@@ -6,7 +6,9 @@ require (
 	github.com/PuerkitoBio/goquery v1.12.0
 	github.com/go-telegram/bot v1.20.0
 	github.com/joho/godotenv v1.5.1
+	github.com/lib/pq v1.12.3
 	github.com/tidwall/gjson v1.18.0
+	gopkg.in/yaml.v3 v3.0.1
 	modernc.org/sqlite v1.44.3
 	mvdan.cc/xurls/v2 v2.6.0
 )
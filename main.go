@@ -15,30 +15,35 @@ var (
 )
 
 func main() {
-	fmt.Printf("starting version %s\n", version)
+	args, checkConfig := app.ExtractFlag(os.Args, app.CheckConfigFlag)
+	if checkConfig {
+		if err := app.CheckConfig(os.Stdout, args); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+
+		return
+	}
 
-	sigs := make(chan os.Signal, 1)
+	args, migrateOnly := app.ExtractFlag(args, app.MigrateOnlyFlag)
+	if migrateOnly {
+		if err := app.MigrateOnly(os.Stdout, args); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
 
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+		return
+	}
 
-	done := make(chan bool, 1)
+	fmt.Printf("starting version %s\n", version)
 
-	ctx := context.Background()
-	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
-	if err := app.Run(ctx, os.Stdout, os.Args); err != nil {
+	if err := app.Run(ctx, os.Stdout, args); err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err)
 		os.Exit(1)
 	}
 
-	go func() {
-		sig := <-sigs
-		fmt.Println(sig)
-		cancel()
-		done <- true
-	}()
-
-	<-done
 	fmt.Println("exiting")
 }
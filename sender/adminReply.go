@@ -33,7 +33,7 @@ func (s *Sender) handleAdminReplyToNotification(ctx context.Context, b *bot.Bot,
 	}
 
 	message := update.Message
-	if !slices.Contains(s.config.TelegramAdminIDsList, message.Chat.ID) {
+	if !slices.Contains(s.config.Load().TelegramAdminIDsList, message.Chat.ID) {
 		return false
 	}
 
@@ -47,33 +47,23 @@ func (s *Sender) handleAdminReplyToNotification(ctx context.Context, b *bot.Bot,
 	}
 	if !ok {
 		if target, ok, parseErr := s.resolveGroupReplyTargetFromReference(ctx, b, message.ReplyToMessage); ok {
-			_, err := b.CopyMessage(ctx, &bot.CopyMessageParams{
-				ChatID:          target.chatID,
-				FromChatID:      message.Chat.ID,
-				MessageID:       message.ID,
-				MessageThreadID: target.messageThreadID,
-				ReplyParameters: &models.ReplyParameters{MessageID: target.messageID},
-			})
-			if err != nil {
-				s.lgr.Error(fmt.Sprintf(
-					"admin group reply relay failed for admin=%d target_chat=%d target_message=%d: %s",
-					message.Chat.ID,
-					target.chatID,
-					target.messageID,
-					err.Error(),
-				))
-
-				_, _ = b.SendMessage(ctx, &bot.SendMessageParams{
-					ChatID: message.Chat.ID,
-					Text: fmt.Sprintf(
-						"Не удалось отправить ответ в группу (chat_id=%d, message_id=%d)",
-						target.chatID,
-						target.messageID,
-					),
-				})
-
-				return true
-			}
+			adminChatID := message.Chat.ID
+
+			s.MakeDeferred(DeferredMessage{
+				Request: &CopyMessage{
+					ChatID:           target.chatID,
+					FromChatID:       strconv.FormatInt(adminChatID, 10),
+					MessageID:        message.ID,
+					MessageThreadID:  target.messageThreadID,
+					ReplyToMessageID: target.messageID,
+				},
+				DeleteAfter: s.ephemeralTTL(target.chatID),
+				After: &ReportGroupReplyFailure{
+					AdminChatID:     adminChatID,
+					TargetChatID:    target.chatID,
+					TargetMessageID: target.messageID,
+				},
+			}, s.SendResult)
 
 			return true
 		} else if parseErr != "" {
@@ -101,7 +91,7 @@ func (s *Sender) handleAdminReplyToNotification(ctx context.Context, b *bot.Bot,
 
 		_, _ = b.SendMessage(ctx, &bot.SendMessageParams{
 			ChatID: message.Chat.ID,
-			Text:   fmt.Sprintf("Не удалось отправить сообщение пользователю ID %d", targetUserID),
+			Text:   s.t(s.adminLocale(), "admin.user_reply_failed", targetUserID),
 		})
 
 		return true
@@ -136,10 +126,10 @@ func (s *Sender) resolveGroupReplyTargetFromReference(ctx context.Context, b *bo
 		}
 
 		if errors.Is(err, errInvalidTelegramLink) {
-			return groupReplyTarget{}, false, "Не удалось разобрать ссылку на сообщение. Используйте ссылку вида https://t.me/c/<chat>/<message> или https://t.me/<username>/<message>."
+			return groupReplyTarget{}, false, s.t(s.adminLocale(), "admin.invalid_message_link")
 		}
 
-		return groupReplyTarget{}, false, fmt.Sprintf("Не удалось определить группу по ссылке: %s", err.Error())
+		return groupReplyTarget{}, false, s.t(s.adminLocale(), "admin.resolve_link_failed", err.Error())
 	}
 
 	return groupReplyTarget{}, false, ""
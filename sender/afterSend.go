@@ -0,0 +1,151 @@
+package sender
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ad/telegram-delete-join-messages/data"
+)
+
+// AfterSend is what the bot does with the result of a request, e.g.
+// remember the ID of the sent message. Unlike a callback it is stored in the
+// outbox next to the request, so it also runs for requests replayed after
+// a restart or retried with /failed.
+type AfterSend interface {
+	// Kind identifies the action in the outbox.
+	Kind() string
+
+	// run handles the result of request.
+	run(s *Sender, request Request, result SendResult) error
+}
+
+// afterSendTypes creates an empty action for each stored kind.
+var afterSendTypes = map[string]func() AfterSend{
+	"rememberCaptchaMessage":          func() AfterSend { return &RememberCaptchaMessage{} },
+	"rememberKeyboardMessage":         func() AfterSend { return &RememberKeyboardMessage{} },
+	"reportGroupReplyFailure":         func() AfterSend { return &ReportGroupReplyFailure{} },
+	"rememberJoinRequestNotification": func() AfterSend { return &RememberJoinRequestNotification{} },
+}
+
+// encodeAfterSend stores the action as its JSON with the kind added.
+func encodeAfterSend(after AfterSend) (map[string]json.RawMessage, error) {
+	encoded, err := json.Marshal(after)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+
+	fields["kind"], _ = json.Marshal(after.Kind())
+
+	return fields, nil
+}
+
+func decodeAfterSend(raw json.RawMessage) (AfterSend, error) {
+	var header struct {
+		Kind string `json:"kind"`
+	}
+
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return nil, err
+	}
+
+	newAfterSend, ok := afterSendTypes[header.Kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown after send action %q", header.Kind)
+	}
+
+	after := newAfterSend()
+	if err := json.Unmarshal(raw, after); err != nil {
+		return nil, err
+	}
+
+	return after, nil
+}
+
+// RememberCaptchaMessage stores the ID of a sent challenge in its captcha,
+// so the challenge is deleted once solved or on timeout.
+type RememberCaptchaMessage struct {
+	ChatID   int64     `json:"chat_id"`
+	UserID   int64     `json:"user_id"`
+	Answer   string    `json:"answer"`
+	Deadline time.Time `json:"deadline"`
+}
+
+func (a *RememberCaptchaMessage) Kind() string { return "rememberCaptchaMessage" }
+
+func (a *RememberCaptchaMessage) run(s *Sender, _ Request, result SendResult) error {
+	if result.Error != nil {
+		return nil
+	}
+
+	// the member may have solved it or joined again meanwhile
+	stored, err := s.Store.GetCaptcha(a.ChatID, a.UserID)
+	if err != nil || stored.Answer != a.Answer || !stored.Deadline.Equal(a.Deadline) {
+		return ignoreNotFound(err)
+	}
+
+	stored.MessageID = int(result.MessageID)
+
+	return s.Store.SaveCaptcha(stored)
+}
+
+// RememberKeyboardMessage remembers a sent question with inline variants,
+// so its keyboard is removed once the stage is answered.
+type RememberKeyboardMessage struct {
+	UserID int64 `json:"user_id"`
+}
+
+func (a *RememberKeyboardMessage) Kind() string { return "rememberKeyboardMessage" }
+
+func (a *RememberKeyboardMessage) run(s *Sender, _ Request, result SendResult) error {
+	if result.Error == nil {
+		s.convHandler.SetKeyboardMessage(int(a.UserID), int(result.MessageID))
+	}
+
+	return nil
+}
+
+// ReportGroupReplyFailure tells an admin that their reply could not be
+// copied to the group message they replied to.
+type ReportGroupReplyFailure struct {
+	AdminChatID     int64 `json:"admin_chat_id"`
+	TargetChatID    int64 `json:"target_chat_id"`
+	TargetMessageID int   `json:"target_message_id"`
+}
+
+func (a *ReportGroupReplyFailure) Kind() string { return "reportGroupReplyFailure" }
+
+func (a *ReportGroupReplyFailure) run(s *Sender, _ Request, result SendResult) error {
+	if result.Error == nil {
+		return nil
+	}
+
+	s.lgr.Error(fmt.Sprintf(
+		"admin group reply relay failed for admin=%d target_chat=%d target_message=%d: %s",
+		a.AdminChatID,
+		a.TargetChatID,
+		a.TargetMessageID,
+		result.Error.Error(),
+	))
+
+	s.MakeRequestDeferred(&SendMessage{
+		ChatID: a.AdminChatID,
+		Text:   s.t(s.adminLocale(), "admin.group_reply_failed", a.TargetChatID, a.TargetMessageID),
+	}, s.SendResult)
+
+	return nil
+}
+
+func ignoreNotFound(err error) error {
+	if errors.Is(err, data.ErrNotFound) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,95 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// announceTimeLayout is the local time format /announce accepts.
+const announceTimeLayout = "2006-01-02T15:04"
+
+var announcePattern = regexp.MustCompile(`(?s)^/announce(?:@\S+)?\s+(-?\d+)\s+(\S+)\s+(.+)$`)
+
+var errAnnounceUsage = errors.New("bad /announce arguments")
+
+type announcement struct {
+	chatID int64
+	sendAt time.Time
+	text   string
+}
+
+// parseAnnouncement parses "/announce <chat_id> <when> <text>", where when is
+// a duration from now or a local time, keeping the line breaks of the text.
+func parseAnnouncement(text string, now time.Time) (announcement, error) {
+	match := announcePattern.FindStringSubmatch(text)
+	if match == nil {
+		return announcement{}, errAnnounceUsage
+	}
+
+	chatID, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return announcement{}, errAnnounceUsage
+	}
+
+	var sendAt time.Time
+
+	if delay, err := time.ParseDuration(match[2]); err == nil && delay > 0 {
+		sendAt = now.Add(delay)
+	} else if at, err := time.ParseInLocation(announceTimeLayout, match[2], now.Location()); err == nil && at.After(now) {
+		sendAt = at
+	} else {
+		return announcement{}, errAnnounceUsage
+	}
+
+	return announcement{chatID: chatID, sendAt: sendAt, text: match[3]}, nil
+}
+
+// Handle /announce command: schedule a message to an allowed chat
+func (s *Sender) announce(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.Message == nil || update.Message.From == nil {
+		return
+	}
+
+	config := s.config.Load()
+
+	if !slices.Contains(config.TelegramAdminIDsList, update.Message.From.ID) {
+		return
+	}
+
+	locale := s.adminLocale()
+
+	var text string
+
+	a, err := parseAnnouncement(update.Message.Text, time.Now())
+
+	switch {
+	case err != nil:
+		text = s.t(locale, "admin.announce_usage")
+	case !slices.Contains(config.AllowedChatIDsList, a.chatID):
+		text = s.t(locale, "settings.chat_not_allowed")
+	default:
+		s.MakeDeferred(DeferredMessage{
+			Request: &SendMessage{ChatID: a.chatID, Text: a.text},
+			SendAt:  a.sendAt,
+		}, s.SendResult)
+
+		text = s.t(locale, "admin.announce_scheduled", a.chatID, a.sendAt.Format(announceTimeLayout))
+	}
+
+	_, errSendMessage := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: update.Message.Chat.ID,
+		Text:   text,
+	})
+
+	if errSendMessage != nil {
+		fmt.Println("errSendMessage (/announce): ", errSendMessage)
+	}
+}
@@ -0,0 +1,345 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	conf "github.com/ad/telegram-delete-join-messages/config"
+	"github.com/ad/telegram-delete-join-messages/data"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const captchaCallbackPrefix = "captcha:"
+
+// captchaEmoji are the buttons of a challenge, captchaOptions of them are shown.
+var captchaEmoji = []string{"🍎", "🚗", "🐶", "🌲", "⚽", "🎸", "🌙", "🔑", "🚀", "🍕"}
+
+const (
+	captchaOptions = 6
+	captchaRowSize = 3
+
+	// kicked members are banned for a minute, bans shorter than 30 seconds are forever
+	kickBanTime = time.Minute
+
+	// the join message follows the approval of a join request within seconds
+	approvedJoinTTL = 10 * time.Minute
+)
+
+// unrestrictedPermissions grant everything a member can be allowed.
+var unrestrictedPermissions = &models.ChatPermissions{
+	CanSendMessages:       true,
+	CanSendAudios:         true,
+	CanSendDocuments:      true,
+	CanSendPhotos:         true,
+	CanSendVideos:         true,
+	CanSendVideoNotes:     true,
+	CanSendVoiceNotes:     true,
+	CanSendPolls:          true,
+	CanSendOtherMessages:  true,
+	CanAddWebPagePreviews: true,
+	CanChangeInfo:         true,
+	CanInviteUsers:        true,
+	CanPinMessages:        true,
+	CanManageTopics:       true,
+}
+
+// chatUser identifies a member of a chat.
+type chatUser struct {
+	chatID int64
+	userID int64
+}
+
+// rememberApprovedJoin records a join request approved by the bot, on its
+// own or by an admin's decision, so the member is not challenged on join.
+func (s *Sender) rememberApprovedJoin(chatID, userID int64) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.approvedJoins == nil {
+		s.approvedJoins = make(map[chatUser]time.Time)
+	}
+
+	for key, approvedAt := range s.approvedJoins {
+		if time.Since(approvedAt) > approvedJoinTTL {
+			delete(s.approvedJoins, key)
+		}
+	}
+
+	s.approvedJoins[chatUser{chatID: chatID, userID: userID}] = time.Now()
+}
+
+// takeApprovedJoin reports whether the bot recently approved the join
+// request of the member and forgets it.
+func (s *Sender) takeApprovedJoin(chatID, userID int64) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	key := chatUser{chatID: chatID, userID: userID}
+	approvedAt, ok := s.approvedJoins[key]
+	delete(s.approvedJoins, key)
+
+	return ok && time.Since(approvedAt) <= approvedJoinTTL
+}
+
+// needsCaptcha reports whether a member who joined with message has to
+// solve a captcha: bots, members added by an admin, members whose join
+// request the bot approved and members already verified for the chat are
+// let in. In CONCIERGE_MODE members come through join requests and are
+// restricted until they answer the questionnaire instead.
+func (s *Sender) needsCaptcha(message *models.Message, member models.User) bool {
+	if member.IsBot || s.config.Load().ConciergeMode {
+		return false
+	}
+
+	if s.takeApprovedJoin(message.Chat.ID, member.ID) {
+		return false
+	}
+
+	if message.From != nil && message.From.ID != member.ID && slices.Contains(s.config.Load().TelegramAdminIDsList, message.From.ID) {
+		return false
+	}
+
+	if _, err := s.Store.CheckVote(member.ID, message.Chat.ID); err == nil {
+		return false
+	}
+
+	return true
+}
+
+// sendCaptcha restricts a new member and posts a challenge only they can
+// answer. An unsolved challenge is handled by expireCaptchas at the deadline.
+func (s *Sender) sendCaptcha(ctx context.Context, chatID int64, member models.User, policy conf.Policy) {
+	err := s.callWithRetry(ctx, &RestrictChatMember{
+		ChatID:      chatID,
+		UserID:      member.ID,
+		Permissions: restrictedPermissions,
+	})
+	if err != nil {
+		s.lgr.Error(fmt.Sprintf("Error restricting member %d for captcha: %s", member.ID, err.Error()))
+		return
+	}
+
+	// whole seconds survive every store, the deadline identifies the challenge
+	deadline := time.Now().Add(time.Duration(policy.CaptchaTimeout) * time.Second).Truncate(time.Second)
+
+	options := newCaptchaOptions()
+	captcha := data.Captcha{
+		ChatID:   chatID,
+		UserID:   member.ID,
+		Answer:   options[rand.IntN(len(options))],
+		Deadline: deadline,
+	}
+
+	if err := s.Store.SaveCaptcha(captcha); err != nil {
+		s.lgr.Error(fmt.Sprintf("Error saving captcha of %d in %d: %s", member.ID, chatID, err.Error()))
+		return
+	}
+
+	locale := s.userLocale(&member)
+
+	s.MakeDeferred(DeferredMessage{
+		Request: &SendMessage{
+			ChatID:      chatID,
+			Text:        s.t(locale, "captcha.challenge", member.FirstName, captcha.Answer, s.formatSeconds(locale, policy.CaptchaTimeout)),
+			ReplyMarkup: captchaKeyboard(member.ID, options),
+		},
+		After: &RememberCaptchaMessage{ChatID: chatID, UserID: member.ID, Answer: captcha.Answer, Deadline: captcha.Deadline},
+	}, s.SendResult)
+}
+
+func newCaptchaOptions() []string {
+	options := slices.Clone(captchaEmoji)
+	rand.Shuffle(len(options), func(i, j int) {
+		options[i], options[j] = options[j], options[i]
+	})
+
+	return options[:captchaOptions]
+}
+
+func captchaKeyboard(userID int64, options []string) *models.InlineKeyboardMarkup {
+	keyboard := [][]models.InlineKeyboardButton{}
+
+	for index, option := range options {
+		button := models.InlineKeyboardButton{
+			Text:         option,
+			CallbackData: fmt.Sprintf("%s%d:%s", captchaCallbackPrefix, userID, option),
+		}
+
+		if index%captchaRowSize == 0 {
+			keyboard = append(keyboard, []models.InlineKeyboardButton{button})
+		} else {
+			keyboard[len(keyboard)-1] = append(keyboard[len(keyboard)-1], button)
+		}
+	}
+
+	return &models.InlineKeyboardMarkup{InlineKeyboard: keyboard}
+}
+
+// parseCaptchaCallback parses callback data of the form captcha:<user>:<option>.
+func parseCaptchaCallback(raw string) (int64, string, error) {
+	userPart, option, ok := strings.Cut(strings.TrimPrefix(raw, captchaCallbackPrefix), ":")
+	if !ok || option == "" {
+		return 0, "", fmt.Errorf("invalid captcha callback %q", raw)
+	}
+
+	userID, err := strconv.ParseInt(userPart, 10, 64)
+	if err != nil || userID == 0 {
+		return 0, "", fmt.Errorf("invalid user id %q", userPart)
+	}
+
+	return userID, option, nil
+}
+
+// Handle a press of a captcha button: the right one lets the member in, a
+// wrong one can be followed by another try until expireCaptchas kicks them.
+// Buttons of other members' challenges are refused.
+func (s *Sender) captchaCallback(ctx context.Context, b *bot.Bot, update *models.Update) {
+	query := update.CallbackQuery
+	if query == nil || query.Message.Message == nil {
+		return
+	}
+
+	message := query.Message.Message
+	locale := s.userLocale(&query.From)
+	answer := ""
+
+	defer func() {
+		_, errAnswer := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: query.ID,
+			Text:            answer,
+			ShowAlert:       answer != "",
+		})
+
+		if errAnswer != nil {
+			fmt.Println("errAnswerCallbackQuery (captcha): ", errAnswer)
+		}
+	}()
+
+	userID, option, err := parseCaptchaCallback(query.Data)
+	if err != nil {
+		s.lgr.Error(fmt.Sprintf("captchaCallback parse error: %s", err.Error()))
+		return
+	}
+
+	if query.From.ID != userID {
+		answer = s.t(locale, "captcha.not_yours")
+		return
+	}
+
+	captcha, err := s.Store.GetCaptcha(message.Chat.ID, userID)
+	if errors.Is(err, data.ErrNotFound) {
+		answer = s.t(locale, "captcha.expired")
+		return
+	}
+
+	if err != nil {
+		s.lgr.Error(fmt.Sprintf("captchaCallback GetCaptcha error for %d in %d: %s", userID, message.Chat.ID, err.Error()))
+		return
+	}
+
+	if option != captcha.Answer {
+		s.lgr.Info(fmt.Sprintf("Member %d pressed a wrong captcha button in %d", userID, message.Chat.ID))
+
+		answer = s.t(locale, "captcha.failed")
+
+		return
+	}
+
+	s.lgr.Info(fmt.Sprintf("Member %d solved the captcha in %d", userID, message.Chat.ID))
+
+	err = s.callWithRetry(ctx, &RestrictChatMember{
+		ChatID:      message.Chat.ID,
+		UserID:      userID,
+		Permissions: s.chatPermissions(ctx, b, message.Chat.ID),
+	})
+	if err != nil {
+		s.lgr.Error(fmt.Sprintf("captchaCallback error for %d in %d: %s", userID, message.Chat.ID, err.Error()))
+		return
+	}
+
+	s.finishCaptcha(ctx, captcha, message.ID)
+}
+
+// chatPermissions returns the default permissions of a chat, which lift the
+// captcha restriction: the member gets the same rights as everyone else.
+// If the chat can't be read every permission is granted, Telegram still
+// limits members to the chat defaults then.
+func (s *Sender) chatPermissions(ctx context.Context, b *bot.Bot, chatID int64) *models.ChatPermissions {
+	chat, err := b.GetChat(ctx, &bot.GetChatParams{ChatID: chatID})
+	if err != nil {
+		s.lgr.Error(fmt.Sprintf("chatPermissions GetChat error for %d: %s", chatID, err.Error()))
+		return unrestrictedPermissions
+	}
+
+	if chat.Permissions == nil {
+		return unrestrictedPermissions
+	}
+
+	return chat.Permissions
+}
+
+// kickMember removes a member from the chat without keeping them banned.
+func (s *Sender) kickMember(ctx context.Context, chatID, userID int64) error {
+	err := s.callWithRetry(ctx, &BanChatMember{
+		ChatID:    chatID,
+		UserID:    userID,
+		UntilDate: int(time.Now().Add(kickBanTime).Unix()),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.callWithRetry(ctx, &UnbanChatMember{ChatID: chatID, UserID: userID, OnlyIfBanned: true})
+}
+
+// finishCaptcha deletes the challenge message and the stored captcha.
+func (s *Sender) finishCaptcha(ctx context.Context, captcha data.Captcha, messageID int) {
+	if messageID != 0 {
+		if err := s.callWithRetry(ctx, &DeleteMessage{ChatID: captcha.ChatID, MessageID: messageID}); err != nil {
+			s.lgr.Error(fmt.Sprintf("Error deleting captcha %d, %d: %s", captcha.ChatID, messageID, err.Error()))
+		}
+	}
+
+	if err := s.Store.DeleteCaptcha(captcha.ChatID, captcha.UserID); err != nil {
+		s.lgr.Error(fmt.Sprintf("Error deleting captcha of %d in %d: %s", captcha.UserID, captcha.ChatID, err.Error()))
+	}
+}
+
+// expireCaptchas kicks the members who did not solve their captcha by the
+// deadline and deletes the challenges. A kick that fails for good is
+// reported to the admins by callWithRetry, the captcha is dropped anyway.
+func (s *Sender) expireCaptchas(ctx context.Context) {
+	captchas, err := s.Store.ListExpiredCaptchas(time.Now())
+	if err != nil {
+		s.lgr.Error(fmt.Sprintf("ListExpiredCaptchas error: %s", err.Error()))
+		return
+	}
+
+	for _, captcha := range captchas {
+		// the member may have solved it or joined again meanwhile
+		stored, err := s.Store.GetCaptcha(captcha.ChatID, captcha.UserID)
+		if err != nil || !stored.Deadline.Equal(captcha.Deadline) {
+			continue
+		}
+
+		s.lgr.Info(fmt.Sprintf("Member %d did not solve the captcha in %d in time", captcha.UserID, captcha.ChatID))
+
+		if err := s.kickMember(ctx, captcha.ChatID, captcha.UserID); err != nil {
+			s.lgr.Error(fmt.Sprintf("Error kicking member %d from %d: %s", captcha.UserID, captcha.ChatID, err.Error()))
+		}
+
+		// shutting down, the next start kicks them
+		if ctx.Err() != nil {
+			return
+		}
+
+		s.finishCaptcha(ctx, stored, stored.MessageID)
+	}
+}
@@ -0,0 +1,237 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	conf "github.com/ad/telegram-delete-join-messages/config"
+	"github.com/ad/telegram-delete-join-messages/data"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func TestParseCaptchaCallback(t *testing.T) {
+	userID, option, err := parseCaptchaCallback("captcha:5000000001:🍎")
+	if err != nil || userID != 5000000001 || option != "🍎" {
+		t.Errorf("Expected user 5000000001 and 🍎, got %d, %q, %v", userID, option, err)
+	}
+
+	for _, raw := range []string{"captcha:", "captcha:5000000001", "captcha:5000000001:", "captcha:x:🍎", "captcha:0:🍎"} {
+		if _, _, err := parseCaptchaCallback(raw); err == nil {
+			t.Errorf("Expected error for %q", raw)
+		}
+	}
+}
+
+func TestCaptchaKeyboard(t *testing.T) {
+	options := newCaptchaOptions()
+	if len(options) != captchaOptions {
+		t.Fatalf("Expected %d options, got %v", captchaOptions, options)
+	}
+
+	keyboard := captchaKeyboard(42, options)
+	if len(keyboard.InlineKeyboard) != captchaOptions/captchaRowSize {
+		t.Fatalf("Expected %d rows, got %d", captchaOptions/captchaRowSize, len(keyboard.InlineKeyboard))
+	}
+
+	for _, row := range keyboard.InlineKeyboard {
+		for _, button := range row {
+			userID, option, err := parseCaptchaCallback(button.CallbackData)
+			if err != nil || userID != 42 || option != button.Text {
+				t.Errorf("Expected the button to carry its own option for user 42, got %q", button.CallbackData)
+			}
+		}
+	}
+}
+
+func TestNeedsCaptcha(t *testing.T) {
+	s := newTestSender(t, &conf.Config{TelegramAdminIDsList: []int64{1}})
+
+	if err := s.Store.AddVote(3, -100, "ok", ""); err != nil {
+		t.Fatalf("AddVote error: %v", err)
+	}
+
+	message := func(fromID int64) *models.Message {
+		return &models.Message{Chat: models.Chat{ID: -100}, From: &models.User{ID: fromID}}
+	}
+
+	tests := []struct {
+		name    string
+		message *models.Message
+		member  models.User
+		want    bool
+	}{
+		{"joined by themselves", message(2), models.User{ID: 2}, true},
+		{"added by a member", message(4), models.User{ID: 2}, true},
+		{"added by an admin", message(1), models.User{ID: 2}, false},
+		{"bot", message(2), models.User{ID: 2, IsBot: true}, false},
+		{"verified", message(3), models.User{ID: 3}, false},
+	}
+
+	for _, tt := range tests {
+		if got := s.needsCaptcha(tt.message, tt.member); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestNeedsCaptchaAfterJoinRequest(t *testing.T) {
+	b, _ := newFakeBotAPI(t)
+
+	s := newTestSender(t, &conf.Config{})
+	s.Bot = b
+
+	if result := s.call(context.Background(), &ApproveChatJoinRequest{ChatID: -100, UserID: 2}); result.Error != nil {
+		t.Fatalf("approveChatJoinRequest error: %v", result.Error)
+	}
+
+	message := &models.Message{Chat: models.Chat{ID: -100}, From: &models.User{ID: 2}}
+
+	if s.needsCaptcha(message, models.User{ID: 2}) {
+		t.Error("Expected a member with an approved join request to be let in")
+	}
+
+	if !s.needsCaptcha(message, models.User{ID: 2}) {
+		t.Error("Expected the approval to exempt only the join that followed it")
+	}
+
+	s.config.Store(&conf.Config{ConciergeMode: true})
+
+	if s.needsCaptcha(message, models.User{ID: 2}) {
+		t.Error("Expected no captcha in concierge mode")
+	}
+}
+
+func TestExpireCaptchas(t *testing.T) {
+	b, calls := newFakeBotAPI(t)
+
+	s := newTestSender(t, &conf.Config{})
+	s.Bot = b
+
+	if err := s.Store.SaveCaptcha(data.Captcha{ChatID: -100, UserID: 5000000001, MessageID: 7, Answer: "🍎", Deadline: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("SaveCaptcha error: %v", err)
+	}
+
+	s.expireCaptchas(context.Background())
+
+	if len(calls()) != 0 {
+		t.Fatalf("Expected a challenge before its deadline to be left alone, got calls %v", calls())
+	}
+
+	if err := s.Store.SaveCaptcha(data.Captcha{ChatID: -100, UserID: 5000000001, MessageID: 7, Answer: "🍎", Deadline: time.Now().Add(-time.Second)}); err != nil {
+		t.Fatalf("SaveCaptcha error: %v", err)
+	}
+
+	s.expireCaptchas(context.Background())
+
+	if want := []string{"banChatMember", "unbanChatMember", "deleteMessage"}; !slices.Equal(calls(), want) {
+		t.Errorf("Expected calls %v, got %v", want, calls())
+	}
+
+	if _, err := s.Store.GetCaptcha(-100, 5000000001); !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("Expected the captcha to be deleted, got %v", err)
+	}
+
+	if s.dispatcher.size() != 0 || len(s.scheduler.scheduled()) != 0 {
+		t.Errorf("Expected the timeout to bypass the outbox, got %d queued, %d scheduled", s.dispatcher.size(), len(s.scheduler.scheduled()))
+	}
+
+	s.expireCaptchas(context.Background())
+
+	if len(calls()) != 3 {
+		t.Errorf("Expected a finished captcha to be left alone, got calls %v", calls())
+	}
+}
+
+func TestCaptchaCallback(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		calls       []string
+		answers     []string
+		permissions *models.ChatPermissions
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		method := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+		_ = req.ParseMultipartForm(1 << 20)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		calls = append(calls, method)
+
+		w.Header().Set("Content-Type", "application/json")
+
+		switch method {
+		case "getChat":
+			_, _ = w.Write([]byte(`{"ok": true, "result": {"id": -100, "type": "supergroup", "permissions": {"can_send_messages": true, "can_send_audios": true, "can_send_voice_notes": true, "can_send_polls": true, "can_add_web_page_previews": true}}}`))
+			return
+		case "restrictChatMember":
+			permissions = &models.ChatPermissions{}
+			_ = json.Unmarshal([]byte(req.FormValue("permissions")), permissions)
+		case "answerCallbackQuery":
+			answers = append(answers, req.FormValue("text"))
+		}
+
+		_, _ = w.Write([]byte(`{"ok": true, "result": true}`))
+	}))
+	t.Cleanup(server.Close)
+
+	b, err := bot.New("123:token", bot.WithSkipGetMe(), bot.WithServerURL(server.URL))
+	if err != nil {
+		t.Fatalf("bot.New error: %v", err)
+	}
+
+	s := newTestSender(t, &conf.Config{MemberPermissions: "messages"})
+	s.Bot = b
+
+	if err := s.Store.SaveCaptcha(data.Captcha{ChatID: -100, UserID: 5000000001, MessageID: 7, Answer: "🍎", Deadline: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("SaveCaptcha error: %v", err)
+	}
+
+	press := func(option string) {
+		s.captchaCallback(context.Background(), b, &models.Update{CallbackQuery: &models.CallbackQuery{
+			ID:      "1",
+			From:    models.User{ID: 5000000001, LanguageCode: "en"},
+			Message: models.MaybeInaccessibleMessage{Message: &models.Message{ID: 7, Chat: models.Chat{ID: -100}}},
+			Data:    captchaCallbackPrefix + "5000000001:" + option,
+		}})
+	}
+
+	press("🚗")
+
+	mu.Lock()
+	if !slices.Equal(calls, []string{"answerCallbackQuery"}) || answers[0] != s.t("en", "captcha.failed") {
+		t.Errorf("Expected a wrong button to only be answered, got calls %v, answers %q", calls, answers)
+	}
+	mu.Unlock()
+
+	if _, err := s.Store.GetCaptcha(-100, 5000000001); err != nil {
+		t.Fatalf("Expected the challenge to stay after a wrong button, got %v", err)
+	}
+
+	press("🍎")
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if slices.Contains(calls, "banChatMember") {
+		t.Errorf("Expected nobody to be kicked, got calls %v", calls)
+	}
+
+	if permissions == nil || !permissions.CanSendMessages || !permissions.CanSendVoiceNotes || !permissions.CanSendPolls || !permissions.CanAddWebPagePreviews || permissions.CanPinMessages {
+		t.Errorf("Expected the default permissions of the chat after the right button, got %+v", permissions)
+	}
+
+	if _, err := s.Store.GetCaptcha(-100, 5000000001); !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("Expected the solved captcha to be deleted, got %v", err)
+	}
+}
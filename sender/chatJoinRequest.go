@@ -2,13 +2,16 @@ package sender
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"fmt"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 
+	conf "github.com/ad/telegram-delete-join-messages/config"
 	"github.com/ad/telegram-delete-join-messages/data"
+	"github.com/ad/telegram-delete-join-messages/translations"
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
 )
@@ -28,12 +31,37 @@ var restrictedPermissions = &models.ChatPermissions{
 	CanChangeInfo:        false,
 }
 
-var adminNotificationPrefixes = []string{
-	"📝 Новая заявка на вступление",
-	"✅ Пользователь добавлен в группу",
-	"🎉 Пользователь присоединился к группе",
-	"👋 Пользователь вышел из группы",
-	"📨 ЛС от пользователя",
+// memberPermissions are granted to a member once verified in the chat,
+// as set by MEMBER_PERMISSIONS or the policy of the chat.
+func (s *Sender) memberPermissions(chatID int64) *models.ChatPermissions {
+	set := s.getPolicy(chatID).MemberPermissions
+
+	return &models.ChatPermissions{
+		CanSendMessages:       set.Has(conf.PermissionMessages),
+		CanSendAudios:         set.Has(conf.PermissionAudios),
+		CanSendDocuments:      set.Has(conf.PermissionDocuments),
+		CanSendPhotos:         set.Has(conf.PermissionPhotos),
+		CanSendVideos:         set.Has(conf.PermissionVideos),
+		CanSendVideoNotes:     set.Has(conf.PermissionVideoNotes),
+		CanSendVoiceNotes:     set.Has(conf.PermissionVoiceNotes),
+		CanSendPolls:          set.Has(conf.PermissionPolls),
+		CanSendOtherMessages:  set.Has(conf.PermissionOther),
+		CanAddWebPagePreviews: set.Has(conf.PermissionLinkPreviews),
+		CanChangeInfo:         set.Has(conf.PermissionChangeInfo),
+		CanInviteUsers:        set.Has(conf.PermissionInvite),
+		CanPinMessages:        set.Has(conf.PermissionPin),
+		CanManageTopics:       set.Has(conf.PermissionTopics),
+	}
+}
+
+// adminNotificationTitleKeys are the catalog keys of admin notification titles
+// that are followed by the "ID: <user id>" line an admin can reply to.
+var adminNotificationTitleKeys = []string{
+	"admin.join_request",
+	"admin.join_approved",
+	"admin.user_joined",
+	"admin.user_left",
+	"admin.private_message",
 }
 
 var adminNotificationUserIDPattern = regexp.MustCompile(`(?m)^ID:\s*(-?\d+)\b`)
@@ -44,10 +72,15 @@ func (s *Sender) HandleChatJoinRequest(ctx context.Context, b *bot.Bot, update *
 	chatID := update.ChatJoinRequest.Chat.ID
 	fromID := update.ChatJoinRequest.From.ID
 
-	go s.notifyAdminsJoinRequest(ctx, &update.ChatJoinRequest.From, chatID)
+	if s.getPolicy(chatID).ManualApproval {
+		s.notifyAdminsJoinRequestDecision(&update.ChatJoinRequest.From, chatID)
+		return
+	}
+
+	s.notifyAdminsJoinRequest(ctx, &update.ChatJoinRequest.From, chatID)
 
-	vote, err := data.CheckVote(s.DB, fromID, fromID)
-	if err != nil && err != sql.ErrNoRows {
+	vote, err := s.Store.CheckVote(fromID, chatID)
+	if err != nil && !errors.Is(err, data.ErrNotFound) {
 		return
 	}
 
@@ -57,15 +90,12 @@ func (s *Sender) HandleChatJoinRequest(ctx context.Context, b *bot.Bot, update *
 
 	fmt.Println(formatUpdateForLog(update), "room number", vote)
 
-	if vote != 0 {
+	if err == nil {
 		// TODO: add ban check
-		_, errApproveChatJoinRequest := b.ApproveChatJoinRequest(
-			ctx,
-			&bot.ApproveChatJoinRequestParams{
-				ChatID: chatID,
-				UserID: fromID,
-			},
-		)
+		errApproveChatJoinRequest := s.callWithRetry(ctx, &ApproveChatJoinRequest{
+			ChatID: chatID,
+			UserID: fromID,
+		})
 
 		if errApproveChatJoinRequest != nil {
 			fmt.Println("errApproveChatJoinRequest: ", errApproveChatJoinRequest, "for", fromID)
@@ -76,46 +106,34 @@ func (s *Sender) HandleChatJoinRequest(ctx context.Context, b *bot.Bot, update *
 		return
 	}
 
-	if s.config.ConciergeMode {
+	if s.config.Load().ConciergeMode {
 		// Send message first while join request is still pending —
 		// Telegram allows the bot to DM the user at this moment even if they haven't started the bot.
+		s.convHandler.SetGroup(int(fromID), chatID)
 		s.convHandler.SetActiveStage(0, int(fromID))
 
-		conversation, errConv := s.GetConversationById(0)
+		conversation, errConv := s.GetConversationById(chatID, 0)
 		if errConv != nil {
 			fmt.Println("errGetConversation (concierge): ", errConv)
 			return
 		}
 
-		_, errSendMessage := b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID: fromID,
-			Text:   conversation.Question,
-		})
-		if errSendMessage != nil {
-			fmt.Println("errSendMessage (concierge): ", errSendMessage, "for", fromID)
-		}
+		s.askStage(ctx, b, fromID, 0, conversation)
 
-		_, errApproveChatJoinRequest := b.ApproveChatJoinRequest(
-			ctx,
-			&bot.ApproveChatJoinRequestParams{
-				ChatID: chatID,
-				UserID: fromID,
-			},
-		)
+		errApproveChatJoinRequest := s.callWithRetry(ctx, &ApproveChatJoinRequest{
+			ChatID: chatID,
+			UserID: fromID,
+		})
 		if errApproveChatJoinRequest != nil {
 			fmt.Println("errApproveChatJoinRequest (concierge): ", errApproveChatJoinRequest, "for", fromID)
 			return
 		}
 
-		_, errRestrict := b.RestrictChatMember(
-			ctx,
-			&bot.RestrictChatMemberParams{
-				ChatID:      chatID,
-				UserID:      fromID,
-				Permissions: restrictedPermissions,
-				UntilDate:   0,
-			},
-		)
+		errRestrict := s.callWithRetry(ctx, &RestrictChatMember{
+			ChatID:      chatID,
+			UserID:      fromID,
+			Permissions: restrictedPermissions,
+		})
 		if errRestrict != nil {
 			fmt.Println("errRestrictChatMember (concierge): ", errRestrict, "for", fromID)
 		}
@@ -124,27 +142,40 @@ func (s *Sender) HandleChatJoinRequest(ctx context.Context, b *bot.Bot, update *
 		return
 	}
 
+	s.convHandler.SetGroup(int(fromID), chatID)
 	s.convHandler.SetActiveStage(0, int(fromID)) //start conversation
 
-	_, errSendMessage := b.SendMessage(
-		ctx,
-		&bot.SendMessageParams{
-			ChatID: fromID,
-			Text:   "❓ Для входа в группу ответьте на пару вопросов.\n\n🏬 В какой башне вы живете?",
-		},
-	)
+	prompt := s.t(s.userLocale(&update.ChatJoinRequest.From), "user.join_prompt")
+	if conversation, errConv := s.GetConversationById(chatID, 0); errConv == nil {
+		s.askStageAfter(ctx, b, fromID, prompt, 0, conversation)
+	} else {
+		_, errSendMessage := b.SendMessage(
+			ctx,
+			&bot.SendMessageParams{
+				ChatID: fromID,
+				Text:   prompt,
+			},
+		)
 
-	if errSendMessage != nil {
-		fmt.Println("errSendMessage: ", errSendMessage, "for", fromID)
+		if errSendMessage != nil {
+			fmt.Println("errSendMessage: ", errSendMessage, "for", fromID)
+		}
 	}
 
-	_, errDeclineChatJoinRequest := b.DeclineChatJoinRequest(
-		ctx,
-		&bot.DeclineChatJoinRequestParams{
-			ChatID: chatID,
-			UserID: fromID,
-		},
-	)
+	if s.config.Load().KeepJoinRequestsPending {
+		errPending := s.keepJoinRequestPending(chatID, fromID)
+		if errPending == nil {
+			fmt.Println("user join request kept pending", fromID)
+			return
+		}
+
+		s.lgr.Error(fmt.Sprintf("keepJoinRequestPending error for %d in %d: %s", fromID, chatID, errPending.Error()))
+	}
+
+	errDeclineChatJoinRequest := s.callWithRetry(ctx, &DeclineChatJoinRequest{
+		ChatID: chatID,
+		UserID: fromID,
+	})
 
 	if errDeclineChatJoinRequest != nil {
 		fmt.Println("errDeclineChatJoinRequest: ", errDeclineChatJoinRequest, "for", fromID)
@@ -153,160 +184,189 @@ func (s *Sender) HandleChatJoinRequest(ctx context.Context, b *bot.Bot, update *
 	fmt.Println("user join request declined", fromID)
 }
 
-func (s *Sender) notifyAdminsJoinRequest(_ context.Context, user *models.User, _ int64) {
-	if len(s.config.TelegramAdminIDsList) == 0 {
-		return
-	}
-
-	vote, err := data.CheckVote(s.DB, user.ID, user.ID)
-	if err != nil && err != sql.ErrNoRows {
-		s.lgr.Error(fmt.Sprintf("notifyAdminsJoinRequest CheckVote error: %s", err.Error()))
-	}
-
-	message := fmt.Sprintf("📝 Новая заявка на вступление\n\n"+
-		"ID: %d\n%s",
-		user.ID,
-		buildData(user, vote),
-	)
-
-	for _, adminID := range s.config.TelegramAdminIDsList {
-		s.MakeRequestDeferred(DeferredMessage{
-			Method: "sendMessage",
-			ChatID: adminID,
-			Text:   message,
-		}, s.SendResult)
-	}
+func (s *Sender) notifyAdminsJoinRequest(_ context.Context, user *models.User, chatID int64) {
+	s.notifyAdminsAboutUser("admin.join_request", user, chatID)
 }
 
-func (s *Sender) notifyAdminsJoinApprove(_ context.Context, user *models.User, _ int64) {
-	if len(s.config.TelegramAdminIDsList) == 0 {
-		return
-	}
-
-	vote, err := data.CheckVote(s.DB, user.ID, user.ID)
-	if err != nil && err != sql.ErrNoRows {
-		s.lgr.Error(fmt.Sprintf("notifyAdminsJoinRequest CheckVote error: %s", err.Error()))
-	}
+func (s *Sender) notifyAdminsJoinApprove(_ context.Context, user *models.User, chatID int64) {
+	s.notifyAdminsAboutUser("admin.join_approved", user, chatID)
+}
 
-	message := fmt.Sprintf("✅ Пользователь добавлен в группу\n\n"+
-		"ID: %d\n%s",
-		user.ID,
-		buildData(user, vote),
-	)
+func (s *Sender) notifyAdminsUserJoined(_ context.Context, user *models.User, chatID int64) {
+	s.notifyAdminsAboutUser("admin.user_joined", user, chatID)
+}
 
-	for _, adminID := range s.config.TelegramAdminIDsList {
-		s.MakeRequestDeferred(DeferredMessage{
-			Method: "sendMessage",
-			ChatID: adminID,
-			Text:   message,
-		}, s.SendResult)
-	}
+func (s *Sender) notifyAdminsUserLeft(_ context.Context, user *models.User, chatID int64) {
+	s.notifyAdminsAboutUser("admin.user_left", user, chatID)
 }
 
-func (s *Sender) notifyAdminsUserJoined(_ context.Context, user *models.User, _ int64) {
-	if len(s.config.TelegramAdminIDsList) == 0 {
+// notifyAdminsAboutUser sends every admin a notification titled with the
+// catalog message titleKey, followed by the user's ID, profile data and
+// verification status in chatID and the other groups.
+func (s *Sender) notifyAdminsAboutUser(titleKey string, user *models.User, chatID int64) {
+	adminIDs := s.config.Load().TelegramAdminIDsList
+	if len(adminIDs) == 0 {
 		return
 	}
 
-	vote, err := data.CheckVote(s.DB, user.ID, user.ID)
-	if err != nil && err != sql.ErrNoRows {
-		s.lgr.Error(fmt.Sprintf("notifyAdminsUserJoined CheckVote error: %s", err.Error()))
-	}
-
-	message := fmt.Sprintf("✅ Пользователь присоединился к группе\n\n"+
-		"ID: %d\n%s",
-		user.ID,
-		buildData(user, vote),
-	)
+	message := s.adminUserNotification(s.adminLocale(), titleKey, user, chatID)
 
-	for _, adminID := range s.config.TelegramAdminIDsList {
-		s.MakeRequestDeferred(DeferredMessage{
-			Method: "sendMessage",
+	for _, adminID := range adminIDs {
+		s.MakeRequestDeferred(&SendMessage{
 			ChatID: adminID,
 			Text:   message,
 		}, s.SendResult)
 	}
 }
 
-func (s *Sender) notifyAdminsUserLeft(_ context.Context, user *models.User, _ int64) {
-	if len(s.config.TelegramAdminIDsList) == 0 {
-		return
-	}
-
-	vote, err := data.CheckVote(s.DB, user.ID, user.ID)
-	if err != nil && err != sql.ErrNoRows {
-		s.lgr.Error(fmt.Sprintf("notifyAdminsUserLeft CheckVote error: %s", err.Error()))
+// adminUserNotification is the text of an admin notification about a user.
+func (s *Sender) adminUserNotification(locale, titleKey string, user *models.User, chatID int64) string {
+	userVerification, err := s.loadVerification(user.ID)
+	if err != nil {
+		s.lgr.Error(fmt.Sprintf("notifyAdminsAboutUser (%s) loadVerification error: %s", titleKey, err.Error()))
 	}
 
-	message := fmt.Sprintf("👋 Пользователь вышел из группы\n\n"+
+	return fmt.Sprintf("%s\n\n"+
 		"ID: %d\n%s",
+		s.t(locale, titleKey),
 		user.ID,
-		buildData(user, vote),
+		s.buildData(locale, user, userVerification, chatID),
 	)
-
-	for _, adminID := range s.config.TelegramAdminIDsList {
-		s.MakeRequestDeferred(DeferredMessage{
-			Method: "sendMessage",
-			ChatID: adminID,
-			Text:   message,
-		}, s.SendResult)
-	}
 }
 
 func (s *Sender) notifyAdminsBotAddedToGroup(_ context.Context, chat *models.Chat) {
-	if len(s.config.TelegramAdminIDsList) == 0 {
+	adminIDs := s.config.Load().TelegramAdminIDsList
+	if len(adminIDs) == 0 {
 		return
 	}
 
-	forumEnabled := "Нет"
+	locale := s.adminLocale()
+
+	forumEnabled := s.t(locale, "common.no")
 	if chat.IsForum {
-		forumEnabled = "Да"
+		forumEnabled = s.t(locale, "common.yes")
 	}
 
-	message := fmt.Sprintf("🤖 Бот добавлен в группу\n\n"+
+	message := fmt.Sprintf("%s\n\n"+
 		"ID: %d\n"+
-		"Название: %s\n"+
-		"Форум: %s",
+		"%s\n"+
+		"%s",
+		s.t(locale, "admin.bot_added"),
 		chat.ID,
-		chat.Title,
-		forumEnabled,
+		s.t(locale, "admin.field_title", chat.Title),
+		s.t(locale, "admin.field_forum", forumEnabled),
 	)
 
-	for _, adminID := range s.config.TelegramAdminIDsList {
-		s.MakeRequestDeferred(DeferredMessage{
-			Method: "sendMessage",
+	for _, adminID := range adminIDs {
+		s.MakeRequestDeferred(&SendMessage{
 			ChatID: adminID,
 			Text:   message,
 		}, s.SendResult)
 	}
 }
 
-func buildData(user *models.User, vote int) string {
+func (s *Sender) buildData(locale string, user *models.User, v verification, chatID int64) string {
 	usernameStr := ""
 
 	if user.Username != "" {
-		usernameStr = fmt.Sprintf("Username: @%s\n", user.Username)
+		usernameStr = s.t(locale, "admin.field_username", user.Username) + "\n"
 	}
 
 	nameStr := ""
 
 	if user.FirstName != "" {
-		nameStr = fmt.Sprintf("Имя: %s\n", user.FirstName)
+		nameStr = s.t(locale, "admin.field_first_name", user.FirstName) + "\n"
 	}
 
 	surnameStr := ""
 
 	if user.LastName != "" {
-		surnameStr = fmt.Sprintf("Фамилия: %s\n", user.LastName)
+		surnameStr = s.t(locale, "admin.field_last_name", user.LastName) + "\n"
 	}
 
-	voteStr := ""
+	return fmt.Sprintf("%s%s%s%s", usernameStr, nameStr, surnameStr, s.buildVerificationStatus(locale, user.ID, v, chatID))
+}
 
-	if vote > 0 {
-		voteStr = fmt.Sprintf("Vote: %d\n", vote)
+// verification is what the store knows about the verification of a user:
+// their votes keyed by group and every accepted questionnaire answer.
+type verification struct {
+	votes   map[int64]string
+	answers []data.Answer
+}
+
+func (s *Sender) loadVerification(userID int64) (verification, error) {
+	votes, err := s.Store.ListVotes(userID)
+	if err != nil {
+		return verification{}, err
+	}
+
+	// votes from before verification was per group are assigned to the
+	// allowed chats on start, without allowed chats they verify nothing
+	delete(votes, userID)
+
+	answers, err := s.Store.ListAnswers(userID)
+	if err != nil {
+		return verification{}, err
+	}
+
+	return verification{votes: votes, answers: answers}, nil
+}
+
+// buildVerificationStatus lists whether the user passed verification in
+// chatID, in every allowed chat and in any other group they have a vote or
+// answers for, together with their answers to each stage.
+func (s *Sender) buildVerificationStatus(locale string, userID int64, v verification, chatID int64) string {
+	groupIDs := []int64{}
+	if chatID != 0 && chatID != userID {
+		groupIDs = append(groupIDs, chatID)
+	}
+
+	for _, groupID := range s.config.Load().AllowedChatIDsList {
+		if !slices.Contains(groupIDs, groupID) {
+			groupIDs = append(groupIDs, groupID)
+		}
+	}
+
+	others := []int64{}
+	addOther := func(groupID int64) {
+		// votes recorded before verification was per group used the user ID as group_id
+		if groupID != userID && !slices.Contains(groupIDs, groupID) && !slices.Contains(others, groupID) {
+			others = append(others, groupID)
+		}
+	}
+
+	for groupID := range v.votes {
+		addOther(groupID)
+	}
+
+	for _, answer := range v.answers {
+		addOther(answer.GroupID)
+	}
+
+	slices.Sort(others)
+	groupIDs = append(groupIDs, others...)
+
+	if len(groupIDs) == 0 {
+		return ""
+	}
+
+	lines := []string{s.t(locale, "admin.field_verification")}
+	for _, groupID := range groupIDs {
+		if _, ok := v.votes[groupID]; ok {
+			lines = append(lines, s.t(locale, "admin.group_verified", groupID))
+		} else {
+			lines = append(lines, s.t(locale, "admin.group_not_verified", groupID))
+		}
+
+		for _, answer := range v.answers {
+			if answer.GroupID == groupID {
+				question, _, _ := strings.Cut(strings.TrimSpace(answer.Question), "\n")
+				lines = append(lines, s.t(locale, "admin.field_answer", answer.Stage+1, question, strings.TrimSpace(answer.Answer)))
+			}
+		}
 	}
 
-	return fmt.Sprintf("%s%s%s%s", usernameStr, nameStr, surnameStr, voteStr)
+	return strings.Join(lines, "\n") + "\n"
 }
 
 func extractUserIDFromAdminNotification(message *models.Message) (int64, bool) {
@@ -324,10 +384,12 @@ func extractUserIDFromAdminNotification(message *models.Message) (int64, bool) {
 	}
 
 	isAdminNotification := false
-	for _, prefix := range adminNotificationPrefixes {
-		if strings.HasPrefix(text, prefix) {
-			isAdminNotification = true
-			break
+	for _, key := range adminNotificationTitleKeys {
+		for _, prefix := range translations.Default().All(key) {
+			if strings.HasPrefix(text, prefix) {
+				isAdminNotification = true
+				break
+			}
 		}
 	}
 
@@ -1,8 +1,17 @@
 package sender
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
 	"testing"
 
+	conf "github.com/ad/telegram-delete-join-messages/config"
+	"github.com/ad/telegram-delete-join-messages/data"
+	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
 )
 
@@ -69,3 +78,91 @@ func TestExtractUserIDFromAdminNotification(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildVerificationStatus(t *testing.T) {
+	s := newTestSender(t, &conf.Config{AllowedChatIDsList: []int64{-100, -200}})
+
+	v := verification{
+		votes: map[int64]string{-200: "7", -300: "A", 42: "5"},
+		answers: []data.Answer{
+			{GroupID: -200, Stage: 0, Question: "Tower?\nA or B", Answer: "b "},
+			{GroupID: -200, Stage: 1, Question: "Room?", Answer: "7"},
+			{GroupID: -500, Stage: 0, Question: "Tower?", Answer: "a"},
+		},
+	}
+
+	got := s.buildVerificationStatus("en", 42, v, -400)
+	want := "Verification by group:\n" +
+		"• -400: ❌ not passed\n" +
+		"• -100: ❌ not passed\n" +
+		"• -200: ✅ passed\n" +
+		"    1. Tower? — b\n" +
+		"    2. Room? — 7\n" +
+		"• -500: ❌ not passed\n" +
+		"    1. Tower? — a\n" +
+		"• -300: ✅ passed\n"
+
+	if got != want {
+		t.Errorf("buildVerificationStatus() = %q, want %q", got, want)
+	}
+
+	if got := newTestSender(t, &conf.Config{}).buildVerificationStatus("en", 42, verification{}, 0); got != "" {
+		t.Errorf("Expected empty status without groups, got %q", got)
+	}
+}
+
+func TestJoinRequestAsksFirstStage(t *testing.T) {
+	for _, concierge := range []bool{false, true} {
+		var (
+			mu       sync.Mutex
+			messages []url.Values
+		)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+
+			if !strings.HasSuffix(req.URL.Path, "/sendMessage") {
+				_, _ = w.Write([]byte(`{"ok": true, "result": true}`))
+				return
+			}
+
+			_ = req.ParseMultipartForm(1 << 20)
+
+			mu.Lock()
+			messages = append(messages, url.Values(req.MultipartForm.Value))
+			mu.Unlock()
+
+			_, _ = w.Write([]byte(`{"ok": true, "result": {"message_id": 42, "chat": {"id": 100}}}`))
+		}))
+
+		b, err := bot.New("123:token", bot.WithSkipGetMe(), bot.WithServerURL(server.URL))
+		if err != nil {
+			t.Fatalf("bot.New error: %v", err)
+		}
+
+		s := newTestSender(t, &conf.Config{
+			ConciergeMode: concierge,
+			Conversations: []conf.Conversation{{Question: "Tower?", Variants: "A,B", Keyboard: conf.KeyboardInline}},
+		})
+		s.Bot = b
+
+		s.HandleChatJoinRequest(context.Background(), b, &models.Update{ChatJoinRequest: &models.ChatJoinRequest{
+			Chat: models.Chat{ID: -100},
+			From: models.User{ID: 100, FirstName: "A"},
+		}})
+
+		server.Close()
+
+		if len(messages) != 1 {
+			t.Fatalf("Expected the first question to be sent (concierge %v), got %v", concierge, messages)
+		}
+
+		if !strings.HasSuffix(messages[0].Get("text"), "Tower?") || !strings.Contains(messages[0].Get("reply_markup"), stageCallbackPrefix+"0:1") {
+			t.Errorf("Expected the first question with its variants (concierge %v), got %v", concierge, messages[0])
+		}
+
+		if got := s.convHandler.TakeKeyboardMessage(100); got != 42 {
+			t.Errorf("Expected the question to be remembered to remove its variants (concierge %v), got %d", concierge, got)
+		}
+	}
+}
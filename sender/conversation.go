@@ -2,7 +2,7 @@ package sender
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"slices"
@@ -16,27 +16,55 @@ import (
 	"github.com/go-telegram/bot/models"
 )
 
-const (
-	UserBadAnswer = "❌ Вы дали неправильный ответ.\nЕсли вы не знаете ответа, то вам сюда не надо."
-)
-
 // ConversationHandler is a structure that manages conversation functions.
 type ConversationHandler struct {
 	mutex          sync.RWMutex            // mutex for thread-safe map access
+	store          data.Store              // persists the progress of active conversations
 	active         map[int]bool            // a flag indicating whether the conversation is active
 	currentStageId map[int]int             // the identifier of the active conversation stage
+	stageUpdatedAt map[int]time.Time       // when the user reached the active stage
 	stages         map[int]bot.HandlerFunc // a map of conversation stages
+	groups         map[int]int64           // the group each user is being verified for
+	keyboards      map[int]int             // the question message with inline variants of each user
 }
 
-// NewConversationHandler returns a new instance of ConversationHandler.
-func NewConversationHandler() *ConversationHandler {
+// NewConversationHandler returns a new instance of ConversationHandler
+// that persists the progress of active conversations in store.
+func NewConversationHandler(store data.Store) *ConversationHandler {
 	return &ConversationHandler{
+		store:          store,
 		active:         make(map[int]bool),
 		currentStageId: make(map[int]int),
+		stageUpdatedAt: make(map[int]time.Time),
 		stages:         make(map[int]bot.HandlerFunc),
+		groups:         make(map[int]int64),
+		keyboards:      make(map[int]int),
 	}
 }
 
+// Restore loads the active conversations saved in the store, e.g. before
+// a restart, and returns them.
+func (c *ConversationHandler) Restore() ([]data.ConversationState, error) {
+	states, err := c.store.ListConversations()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, state := range states {
+		userID := int(state.UserID)
+
+		c.active[userID] = true
+		c.currentStageId[userID] = state.Stage
+		c.stageUpdatedAt[userID] = state.StageUpdatedAt
+		c.groups[userID] = state.GroupID
+	}
+
+	return states, nil
+}
+
 // AddStage adds a conversation stage to the ConversationHandler.
 func (c *ConversationHandler) AddStage(stageId int, hf bot.HandlerFunc) {
 	c.mutex.Lock()
@@ -45,6 +73,14 @@ func (c *ConversationHandler) AddStage(stageId int, hf bot.HandlerFunc) {
 	c.stages[stageId] = hf
 }
 
+// ResetStages removes all conversation stages, keeping the state of active conversations.
+func (c *ConversationHandler) ResetStages() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.stages = make(map[int]bot.HandlerFunc)
+}
+
 // SetActiveStage sets the active conversation stage.
 // Invalid currentStageId is not checked because if the CallStage function encounters an invalid id,
 // it will not process it, so the stageId is not checked.
@@ -58,19 +94,84 @@ func (c *ConversationHandler) SetActiveStage(stageId int, userID int) {
 	}
 
 	c.currentStageId[userID] = stageId
+	c.stageUpdatedAt[userID] = time.Now()
+
+	err := c.store.SaveConversation(data.ConversationState{
+		UserID:         int64(userID),
+		GroupID:        c.groups[userID],
+		Stage:          stageId,
+		StageUpdatedAt: c.stageUpdatedAt[userID],
+	})
+	if err != nil {
+		log.Println("Error: failed to save conversation state:", err)
+	}
+}
+
+// IsActive reports whether the user has an unfinished conversation.
+func (c *ConversationHandler) IsActive(userID int) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.active[userID]
 }
 
 func (c *ConversationHandler) GetActiveStage(userID int) int {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
 
-	if _, ok := c.active[userID]; ok {
+	if c.active[userID] {
 		return c.currentStageId[userID]
 	}
 
 	return 0
 }
 
+// SetGroup remembers the group the user is being verified for.
+// It is persisted together with the next SetActiveStage.
+func (c *ConversationHandler) SetGroup(userID int, groupID int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.groups[userID] = groupID
+}
+
+// GetGroup returns the group the user is being verified for or 0 if unknown.
+func (c *ConversationHandler) GetGroup(userID int) int64 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.groups[userID]
+}
+
+// SetKeyboardMessage remembers the question message with inline variants,
+// so its keyboard is removed once the stage is answered.
+func (c *ConversationHandler) SetKeyboardMessage(userID int, messageID int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.keyboards[userID] = messageID
+}
+
+// TakeKeyboardMessage returns and forgets the question message with inline
+// variants, 0 if there is none.
+func (c *ConversationHandler) TakeKeyboardMessage(userID int) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	messageID := c.keyboards[userID]
+	delete(c.keyboards, userID)
+
+	return messageID
+}
+
+// GetStageUpdatedAt returns when the user reached the active stage.
+func (c *ConversationHandler) GetStageUpdatedAt(userID int) time.Time {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.stageUpdatedAt[userID]
+}
+
 func (c *ConversationHandler) GetStagesCount() int {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
@@ -91,7 +192,7 @@ func (c *ConversationHandler) CallStage(ctx context.Context, b *bot.Bot, update
 
 	c.mutex.RLock()
 	userID := int(update.Message.From.ID)
-	if _, ok := c.active[userID]; ok {
+	if c.active[userID] {
 		// hf = HandlerFunction
 		if hf, ok := c.stages[c.currentStageId[userID]]; ok {
 			c.mutex.RUnlock()
@@ -111,6 +212,10 @@ func (c *ConversationHandler) End(userID int) {
 	defer c.mutex.Unlock()
 
 	c.active[userID] = false
+
+	if err := c.store.DeleteConversation(int64(userID)); err != nil {
+		log.Println("Error: failed to delete conversation state:", err)
+	}
 }
 
 // Handle /start command to start conversation
@@ -124,16 +229,33 @@ func (s *Sender) startConversation(ctx context.Context, b *bot.Bot, update *mode
 		return
 	}
 
+	userID := update.Message.From.ID
+	locale := s.userLocale(update.Message.From)
+
+	groupID := s.verificationGroup(userID)
+	if groupID == 0 {
+		_, errSendMessage := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   s.t(locale, "user.join_request_first"),
+		})
+
+		if errSendMessage != nil {
+			fmt.Println("errSendMessage (/start): ", errSendMessage)
+		}
+
+		return
+	}
+
 	// check room presense in db
-	vote, err := data.CheckVote(s.DB, update.Message.Chat.ID, update.Message.From.ID)
-	if err != nil && err != sql.ErrNoRows {
+	_, err := s.Store.CheckVote(userID, groupID)
+	if err != nil && !errors.Is(err, data.ErrNotFound) {
 		s.lgr.Info(fmt.Sprintf("startConversation CheckVote: %s", err.Error()))
 	}
 
-	if vote != 0 {
+	if err == nil {
 		_, errSendMessage := b.SendMessage(ctx, &bot.SendMessageParams{
 			ChatID: update.Message.Chat.ID,
-			Text:   "✅ Вас уже записали",
+			Text:   s.t(locale, "user.already_verified"),
 		})
 
 		if errSendMessage != nil {
@@ -143,28 +265,79 @@ func (s *Sender) startConversation(ctx context.Context, b *bot.Bot, update *mode
 		return
 	}
 
-	s.convHandler.SetActiveStage(0, int(update.Message.From.ID)) //start conversation
+	s.convHandler.SetGroup(int(userID), groupID)
+	s.convHandler.SetActiveStage(0, int(userID)) //start conversation
 
 	// Get the first stage of the conversation
-	conversation, err := s.GetConversationById(0)
+	conversation, err := s.GetConversationById(groupID, 0)
 	if err != nil {
 		fmt.Println("errGetConversation (/start): ", err)
 		return
 	}
 
-	// Ask user to enter their name
-	_, errSendMessage := b.SendMessage(ctx, &bot.SendMessageParams{
-		ChatID: update.Message.Chat.ID,
-		Text:   conversation.Question,
-	})
+	s.askStage(ctx, b, update.Message.Chat.ID, 0, conversation)
+}
 
-	if errSendMessage != nil {
-		fmt.Println("errSendMessage (/start): ", errSendMessage)
+// resumeConversations restores the conversations that were active before
+// a restart and asks every user the question of their current stage again.
+// Users whose stage no longer exists after a config change start over.
+func (s *Sender) resumeConversations() {
+	states, err := s.convHandler.Restore()
+	if err != nil {
+		s.lgr.Error(fmt.Sprintf("resumeConversations Restore error: %s", err.Error()))
+		return
+	}
+
+	locale := s.config.Load().DefaultLocale
+
+	for _, state := range states {
+		conversation, err := s.GetConversationById(state.GroupID, state.Stage)
+		if err != nil {
+			s.convHandler.SetActiveStage(0, int(state.UserID))
+
+			if conversation, err = s.GetConversationById(state.GroupID, 0); err != nil {
+				s.convHandler.End(int(state.UserID))
+				continue
+			}
+		}
+
+		stage := s.convHandler.GetActiveStage(int(state.UserID))
+
+		dm := DeferredMessage{Request: &SendMessage{
+			ChatID:      state.UserID,
+			Text:        s.t(locale, "user.resume_prompt") + "\n\n" + conversation.Question,
+			ReplyMarkup: stageMarkup(stage, conversation),
+		}}
+
+		if conversation.Keyboard == config.KeyboardInline {
+			dm.After = &RememberKeyboardMessage{UserID: state.UserID}
+		}
+
+		s.MakeDeferred(dm, s.SendResult)
+	}
+
+	if len(states) > 0 {
+		s.lgr.Info(fmt.Sprintf("resumed %d conversations", len(states)))
+	}
+}
+
+// verificationGroup returns the group the user is being verified for: the
+// group of their last join request or the only allowed chat, 0 if unknown.
+func (s *Sender) verificationGroup(userID int64) int64 {
+	if groupID := s.convHandler.GetGroup(int(userID)); groupID != 0 {
+		return groupID
+	}
+
+	if allowed := s.config.Load().AllowedChatIDsList; len(allowed) == 1 {
+		return allowed[0]
 	}
+
+	return 0
 }
 
-func (s *Sender) GetConversationById(index int) (*config.Conversation, error) {
-	conversations := s.config.Conversations
+// GetConversationById returns a stage of the questionnaire of the group.
+func (s *Sender) GetConversationById(groupID int64, index int) (*config.Conversation, error) {
+	conversations := s.config.Load().ConversationsFor(groupID)
 
 	if index < 0 || index >= len(conversations) {
 		return nil, fmt.Errorf("index out of range")
@@ -184,10 +357,18 @@ func (s *Sender) stageHandler(ctx context.Context, b *bot.Bot, update *models.Up
 		return
 	}
 
-	currentStageId := s.convHandler.GetActiveStage(int(update.Message.From.ID))
+	s.answerStage(ctx, b, update.Message.From, update.Message.Text)
+}
+
+// answerStage checks the answer of a user to their active stage, typed or
+// chosen with a button, and moves on to the next stage.
+func (s *Sender) answerStage(ctx context.Context, b *bot.Bot, from *models.User, text string) {
+	currentStageId := s.convHandler.GetActiveStage(int(from.ID))
 	// s.lgr.Info(fmt.Sprintf("currentStageId: %d", currentStageId))
 
-	conversation, err := s.GetConversationById(currentStageId)
+	groupID := s.verificationGroup(from.ID)
+
+	conversation, err := s.GetConversationById(groupID, currentStageId)
 	if err != nil {
 		fmt.Println("errGetConversation (/stageHandler): ", err)
 		return
@@ -195,18 +376,18 @@ func (s *Sender) stageHandler(ctx context.Context, b *bot.Bot, update *models.Up
 
 	// s.lgr.Info(fmt.Sprintf("currentStageId: %v", conversation))
 
-	// split conversation.variants by comma
-	variants := strings.Split(conversation.Variants, ",")
+	variants := conversation.VariantList()
 	for i := range variants {
-		variants[i] = strings.ToUpper(strings.TrimSpace(variants[i]))
+		variants[i] = strings.ToUpper(variants[i])
 	}
 
-	userAnswer := strings.TrimSpace(update.Message.Text)
+	userAnswer := strings.TrimSpace(text)
 
-	if !slices.Contains(variants, strings.ToUpper(userAnswer)) {
+	variantIndex := slices.Index(variants, strings.ToUpper(userAnswer))
+	if variantIndex < 0 {
 		_, errSendMessage := b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID: update.Message.Chat.ID,
-			Text:   UserBadAnswer,
+			ChatID: from.ID,
+			Text:   s.t(s.userLocale(from), "user.bad_answer"),
 		})
 
 		if errSendMessage != nil {
@@ -216,89 +397,108 @@ func (s *Sender) stageHandler(ctx context.Context, b *bot.Bot, update *models.Up
 		return
 	}
 
-	stagesCount := s.convHandler.GetStagesCount()
+	s.saveAnswer(from.ID, currentStageId, conversation, text, variantIndex)
+	s.removeInlineVariants(ctx, b, from.ID)
+
+	stagesCount := len(s.config.Load().ConversationsFor(groupID))
 
 	if currentStageId+1 >= stagesCount {
-		result := s.lastStep(ctx, b, update, userAnswer, conversation.Answer)
+		result := s.lastStep(ctx, b, from, userAnswer, conversation)
 		if result {
-			s.convHandler.End(int(update.Message.From.ID)) // end the conversation
+			s.convHandler.End(int(from.ID)) // end the conversation
 		}
 	} else {
-		s.convHandler.SetActiveStage(currentStageId+1, int(update.Message.From.ID))
+		s.convHandler.SetActiveStage(currentStageId+1, int(from.ID))
 
 		_, errSendMessage := b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID: update.Message.Chat.ID,
-			Text:   conversation.Answer,
+			ChatID:      from.ID,
+			Text:        conversation.Answer,
+			ReplyMarkup: answerMarkup(conversation),
 		})
 
 		if errSendMessage != nil {
 			fmt.Println("errSendMessage (/tower): ", errSendMessage)
 		}
 
-		nextConversation, err := s.GetConversationById(currentStageId + 1)
+		nextConversation, err := s.GetConversationById(groupID, currentStageId+1)
 		if err != nil {
 			fmt.Println("errGetConversation (next stage): ", err)
 			return
 		}
 
-		_, errSendNextMessage := b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID: update.Message.Chat.ID,
-			Text:   nextConversation.Question,
-		})
+		s.askStage(ctx, b, from.ID, currentStageId+1, nextConversation)
+	}
+}
 
-		if errSendNextMessage != nil {
-			fmt.Println("errSendMessage (next question): ", errSendNextMessage)
-		}
+// saveAnswer stores the accepted answer to a stage of the questionnaire for
+// the group the user is being verified for.
+func (s *Sender) saveAnswer(userID int64, stage int, conversation *config.Conversation, rawAnswer string, variantIndex int) {
+	groupID := s.verificationGroup(userID)
+	if groupID == 0 {
+		return
+	}
+
+	normalized := conversation.VariantList()[variantIndex]
+
+	err := s.Store.SaveAnswer(data.Answer{
+		UserID:     userID,
+		GroupID:    groupID,
+		Stage:      stage,
+		Question:   conversation.Question,
+		Answer:     rawAnswer,
+		Normalized: normalized,
+		AnsweredAt: time.Now(),
+	})
+	if err != nil {
+		s.lgr.Error(fmt.Sprintf("saveAnswer error for %d: %s", userID, err.Error()))
 	}
 }
 
 // Handle the room stage to get the user's room
-func (s *Sender) lastStep(ctx context.Context, b *bot.Bot, update *models.Update, userInput, answer string) bool {
-	_, err := s.GetVoteFromDBForUser(ctx, b, update.Message.Chat.ID, update.Message.From.ID)
+func (s *Sender) lastStep(ctx context.Context, b *bot.Bot, from *models.User, userInput string, conversation *config.Conversation) bool {
+	locale := s.userLocale(from)
+	current := s.config.Load()
+
+	groupID := s.verificationGroup(from.ID)
+	if groupID == 0 {
+		s.lgr.Info(fmt.Sprintf("roomHandler unknown group for user %d", from.ID))
+
+		return false
+	}
+
+	_, err := s.GetVoteFromDBForUser(ctx, b, locale, from.ID, from.ID, groupID)
 	if err != nil {
 		s.lgr.Info(fmt.Sprintf("roomHandler GetVoteFromDBForUser (%s): %s", userInput, err.Error()))
 
 		return false
 	}
 
-	user_data := fmt.Sprintf("id %d %s %s %s", update.Message.From.ID, update.Message.From.FirstName, update.Message.From.LastName, update.Message.From.Username)
+	user_data := fmt.Sprintf("id %d %s %s %s", from.ID, from.FirstName, from.LastName, from.Username)
 
-	err = data.AddVote(s.DB, update.Message.Chat.ID, update.Message.From.ID, userInput, user_data)
+	err = s.Store.AddVote(from.ID, groupID, userInput, user_data)
 	if err != nil {
 		s.lgr.Info(fmt.Sprintf("roomHandler AddVote (%s): %s", userInput, err.Error()))
 
 		return false
 	}
 
-	if s.config.ConciergeMode && len(s.config.AllowedChatIDsList) > 0 {
-		groupID := s.config.AllowedChatIDsList[0]
-		_, errRestrict := b.RestrictChatMember(ctx, &bot.RestrictChatMemberParams{
-			ChatID: groupID,
-			UserID: update.Message.From.ID,
-			Permissions: &models.ChatPermissions{
-				CanSendMessages:      true,
-				CanSendAudios:        false,
-				CanSendDocuments:     true,
-				CanSendPhotos:        true,
-				CanSendVideos:        true,
-				CanSendPolls:         false,
-				CanSendVideoNotes:    false,
-				CanSendVoiceNotes:    false,
-				CanSendOtherMessages: true,
-				CanInviteUsers:       true,
-				CanPinMessages:       false,
-				CanManageTopics:      false,
-				CanChangeInfo:        false,
-			},
-			UntilDate: int(time.Now().Add(1 * time.Second).Unix()),
+	answer := conversation.Answer
+
+	if current.ConciergeMode {
+		errRestrict := s.callWithRetry(ctx, &RestrictChatMember{
+			ChatID:      groupID,
+			UserID:      from.ID,
+			Permissions: s.memberPermissions(groupID),
+			UntilDate:   int(time.Now().Add(1 * time.Second).Unix()),
 		})
 		if errRestrict != nil {
 			fmt.Println("errUnrestrict (concierge): ", errRestrict)
 		}
 
 		_, errSendMessage := b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID: update.Message.Chat.ID,
-			Text:   answer + "\n✅ Вы стали полноправным участником группы!",
+			ChatID:      from.ID,
+			Text:        answer + "\n" + s.t(locale, "user.full_member"),
+			ReplyMarkup: answerMarkup(conversation),
 		})
 		if errSendMessage != nil {
 			fmt.Println("errSendMessage (concierge lastStep): ", errSendMessage)
@@ -307,13 +507,16 @@ func (s *Sender) lastStep(ctx context.Context, b *bot.Bot, update *models.Update
 		return true
 	}
 
-	if s.config.InviteLink != "" {
-		answer = answer + "\n🤫 Теперь перейдите по ссылке: " + s.config.InviteLink
+	if s.approvePendingJoinRequest(ctx, groupID, from.ID) {
+		answer = answer + "\n" + s.t(locale, "user.join_approved")
+	} else if current.InviteLink != "" {
+		answer = answer + "\n" + s.t(locale, "user.invite_link", current.InviteLink)
 	}
 
 	_, errSendMessage := b.SendMessage(ctx, &bot.SendMessageParams{
-		ChatID: update.Message.Chat.ID,
-		Text:   answer,
+		ChatID:      from.ID,
+		Text:        answer,
+		ReplyMarkup: answerMarkup(conversation),
 	})
 
 	if errSendMessage != nil {
@@ -323,27 +526,27 @@ func (s *Sender) lastStep(ctx context.Context, b *bot.Bot, update *models.Update
 	return true
 }
 
-func (s *Sender) GetVoteFromDBForUser(ctx context.Context, b *bot.Bot, chatID, userID int64) (int, error) {
-	vote, err := data.CheckVote(s.DB, chatID, userID)
-	if err != nil && err != sql.ErrNoRows {
+func (s *Sender) GetVoteFromDBForUser(ctx context.Context, b *bot.Bot, locale string, chatID, userID, groupID int64) (string, error) {
+	vote, err := s.Store.CheckVote(userID, groupID)
+	if err != nil && !errors.Is(err, data.ErrNotFound) {
 		s.lgr.Info(fmt.Sprintf("roomHandler CheckVote: %s", err.Error()))
 
 		_, errSendMessage := b.SendMessage(ctx, &bot.SendMessageParams{
 			ChatID: chatID,
-			Text:   "❌ Произошла ошибка при проверке ответа. Попробуйте еще раз",
+			Text:   s.t(locale, "user.check_error"),
 		})
 
 		if errSendMessage != nil {
 			fmt.Println("errSendMessage (/room): ", errSendMessage)
 		}
 
-		return 0, err
+		return "", err
 	}
 
-	if vote != 0 {
+	if err == nil {
 		_, errSendMessage := b.SendMessage(ctx, &bot.SendMessageParams{
 			ChatID: chatID,
-			Text:   "✅ Вас уже записали",
+			Text:   s.t(locale, "user.already_verified"),
 		})
 
 		if errSendMessage != nil {
@@ -353,7 +556,7 @@ func (s *Sender) GetVoteFromDBForUser(ctx context.Context, b *bot.Bot, chatID, u
 		return vote, err
 	}
 
-	return 0, nil
+	return "", nil
 }
 
 // Handle /cancel command to end the conversation
@@ -372,7 +575,7 @@ func (s *Sender) cancelConversation(ctx context.Context, b *bot.Bot, update *mod
 	// Send a message to indicate the conversation has been cancelled
 	_, errSendMessage := b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID: update.Message.Chat.ID,
-		Text:   "🥺 Дело ваше, может быть в следующий раз",
+		Text:   s.t(s.userLocale(update.Message.From), "user.cancelled"),
 	})
 
 	if errSendMessage != nil {
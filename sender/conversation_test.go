@@ -1,13 +1,20 @@
 package sender
 
 import (
+	"context"
+	"strings"
 	"sync"
 	"testing"
+
+	conf "github.com/ad/telegram-delete-join-messages/config"
+	"github.com/ad/telegram-delete-join-messages/data"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
 )
 
 // TestConcurrentMapAccess проверяет что нет race condition при одновременном доступе к ConversationHandler
 func TestConcurrentMapAccess(t *testing.T) {
-	ch := NewConversationHandler()
+	ch := NewConversationHandler(data.NewMemoryStore())
 
 	// Создаем WaitGroup для синхронизации горутин
 	var wg sync.WaitGroup
@@ -39,7 +46,7 @@ func TestConcurrentMapAccess(t *testing.T) {
 
 // TestConversationHandlerBasicFunctionality проверяет базовую функциональность
 func TestConversationHandlerBasicFunctionality(t *testing.T) {
-	ch := NewConversationHandler()
+	ch := NewConversationHandler(data.NewMemoryStore())
 
 	// Тестируем установку и получение активной стадии
 	userID := 123
@@ -62,3 +69,127 @@ func TestConversationHandlerBasicFunctionality(t *testing.T) {
 		t.Logf("После End() получили стадию %d (это ожидаемо, если active[userID] = false)", activeAfterEnd)
 	}
 }
+
+func TestCallStageAfterEnd(t *testing.T) {
+	ch := NewConversationHandler(data.NewMemoryStore())
+
+	calls := 0
+	ch.AddStage(0, func(ctx context.Context, b *bot.Bot, update *models.Update) { calls++ })
+
+	update := &models.Update{Message: &models.Message{
+		Chat: models.Chat{ID: 123, Type: "private"},
+		From: &models.User{ID: 123},
+		Text: "A",
+	}}
+
+	ch.SetActiveStage(0, 123)
+	ch.CallStage(context.Background(), nil, update)
+
+	ch.End(123)
+	ch.CallStage(context.Background(), nil, update)
+
+	if calls != 1 {
+		t.Errorf("Expected the stage to be called only while the conversation is active, got %d calls", calls)
+	}
+
+	if ch.IsActive(123) || ch.GetActiveStage(123) != 0 {
+		t.Errorf("Expected no active stage after End, got %d", ch.GetActiveStage(123))
+	}
+}
+
+func TestResumeConversations(t *testing.T) {
+	s := newTestSender(t, &conf.Config{Conversations: []conf.Conversation{
+		{Question: "Tower?", Variants: "A,B"},
+		{Question: "Room?", Variants: "1,2"},
+	}})
+
+	for _, state := range []data.ConversationState{
+		{UserID: 100, GroupID: -100, Stage: 1},
+		{UserID: 200, GroupID: -200, Stage: 5},
+	} {
+		if err := s.Store.SaveConversation(state); err != nil {
+			t.Fatalf("SaveConversation error: %v", err)
+		}
+	}
+
+	s.resumeConversations()
+
+	if got := s.convHandler.GetActiveStage(100); got != 1 {
+		t.Errorf("Expected user 100 to resume at stage 1, got %d", got)
+	}
+
+	if got := s.convHandler.GetGroup(100); got != -100 {
+		t.Errorf("Expected user 100 to be verified for -100, got %d", got)
+	}
+
+	if got := s.convHandler.GetActiveStage(200); got != 0 {
+		t.Errorf("Expected user 200 with a removed stage to start over, got %d", got)
+	}
+
+	for userID, question := range map[int64]string{100: "Room?", 200: "Tower?"} {
+		queue := s.dispatcher.queued(userID)
+		if len(queue) != 1 {
+			t.Fatalf("Expected 1 prompt for user %d, got %d", userID, len(queue))
+		}
+
+		if prompt, ok := queue[0].Request.(*SendMessage); !ok || !strings.HasSuffix(prompt.Text, "\n\n"+question) {
+			t.Errorf("Expected prompt for user %d to repeat %q, got %#v", userID, question, queue[0].Request)
+		}
+	}
+
+	s.convHandler.End(100)
+
+	states, err := s.Store.ListConversations()
+	if err != nil || len(states) != 1 || states[0].UserID != 200 {
+		t.Fatalf("Expected only user 200 to stay in progress, got %+v, %v", states, err)
+	}
+}
+
+func TestResumeConversationsPerGroup(t *testing.T) {
+	s := newTestSender(t, &conf.Config{Conversations: []conf.Conversation{
+		{Question: "Tower?", Variants: "A,B"},
+		{Question: "Flat?", Variants: "1,2", ChatID: -100},
+	}})
+
+	for _, state := range []data.ConversationState{
+		{UserID: 100, GroupID: -100, Stage: 0},
+		{UserID: 200, GroupID: -200, Stage: 0},
+	} {
+		if err := s.Store.SaveConversation(state); err != nil {
+			t.Fatalf("SaveConversation error: %v", err)
+		}
+	}
+
+	s.resumeConversations()
+
+	for userID, question := range map[int64]string{100: "Flat?", 200: "Tower?"} {
+		queue := s.dispatcher.queued(userID)
+		if len(queue) != 1 {
+			t.Fatalf("Expected 1 prompt for user %d, got %d", userID, len(queue))
+		}
+
+		if prompt, ok := queue[0].Request.(*SendMessage); !ok || !strings.HasSuffix(prompt.Text, "\n\n"+question) {
+			t.Errorf("Expected prompt for user %d to ask %q, got %#v", userID, question, queue[0].Request)
+		}
+	}
+}
+
+func TestMemberPermissionsPerGroup(t *testing.T) {
+	readOnly := "messages"
+
+	config := &conf.Config{
+		MemberPermissionsSet: conf.MemberPermissions(0).With(conf.PermissionMessages).With(conf.PermissionPhotos),
+		ChatPolicies:         []conf.ChatPolicy{{ChatID: -100, MemberPermissions: &readOnly}},
+	}
+	config.ChatPoliciesMap = map[int64]conf.ChatPolicy{-100: config.ChatPolicies[0]}
+
+	s := newTestSender(t, config)
+
+	if permissions := s.memberPermissions(-200); !permissions.CanSendMessages || !permissions.CanSendPhotos || permissions.CanInviteUsers {
+		t.Errorf("Unexpected global permissions %+v", permissions)
+	}
+
+	if permissions := s.memberPermissions(-100); !permissions.CanSendMessages || permissions.CanSendPhotos {
+		t.Errorf("Unexpected permissions of -100 %+v", permissions)
+	}
+}
@@ -0,0 +1,28 @@
+package sender
+
+import (
+	"context"
+	"time"
+)
+
+// deadlineInterval is how often expired deadlines are looked for. They are
+// kept in the store, so a restart doesn't lose them, and handled with direct
+// calls, not through the outbox.
+const deadlineInterval = 5 * time.Second
+
+// expireDeadlinesEvery handles the expired deadlines every interval until
+// ctx is done.
+func (s *Sender) expireDeadlinesEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.expireCaptchas(ctx)
+			s.expirePendingJoinRequests(ctx)
+		}
+	}
+}
@@ -2,156 +2,131 @@ package sender
 
 import (
 	"context"
-	"reflect"
+	"errors"
+	"fmt"
 	"time"
 
-	"github.com/go-telegram/bot"
-	"github.com/go-telegram/bot/models"
-)
-
-const (
-	sendCooldownPerUser = int64(time.Second / 3)
-	sendInterval        = time.Second
+	"github.com/ad/telegram-delete-join-messages/data"
 )
 
+// DeferredMessage is a request waiting in the deferred queue.
 type DeferredMessage struct {
-	Method string
-
-	ChatID int64  // for copyMessage, forwardMessage and sendMessage
-	Text   string // for sendMessage
-
-	fromChatID string // for copyMessage and forwardMessage
-	messageID  int    // for copyMessage and forwardMessage
+	Request Request
 
-	messageThreadID  int // for copyMessage and sendMessage
-	replyToMessageID int // for copyMessage and sendMessage
+	SendAt      time.Time     // the request is sent at this time, or right away if it is zero or in the past
+	DeleteAfter time.Duration // the messages sent by the request are deleted after this time, if set
+	After       AfterSend     // handles the result of the request, if set
 
-	replyMarkup models.ReplyMarkup // for sendMessage
+	outboxID int64 // the persisted copy of the request, 0 if it could not be stored
+	attempts int
 
-	callback func(SendResult) error
+	callback func(SendResult) error // not persisted, replayed requests report to SendResult, use After for what must survive
 }
 
+var errUnknownMethod = errors.New("unknown method")
+
+// SendResult is the result of a request. Requests that send or act on
+// several messages list them in MessageIDs.
 type SendResult struct {
+	Method      string
 	ChatID      int64
 	Msg         string
 	Error       error
 	MessageID   int64
+	MessageIDs  []int64
 	ForwardDate int
 }
 
-func (s *Sender) MakeRequestDeferred(dm DeferredMessage, callback func(s SendResult) error) {
-	s.Lock()
-	defer s.Unlock()
-
-	if _, ok := s.deferredMessages[dm.ChatID]; !ok {
-		s.deferredMessages[dm.ChatID] = make(chan DeferredMessage, 100)
-	}
+// MakeRequestDeferred stores the request in the outbox and queues it for
+// sending. It never blocks: when the queue of the chat is full the
+// OUTBOX_OVERFLOW_POLICY decides which request is dropped.
+func (s *Sender) MakeRequestDeferred(request Request, callback func(s SendResult) error) {
+	s.MakeDeferred(DeferredMessage{Request: request}, callback)
+}
 
+// MakeDeferred is MakeRequestDeferred for a request with SendAt or DeleteAfter.
+func (s *Sender) MakeDeferred(dm DeferredMessage, callback func(s SendResult) error) {
 	dm.callback = callback
+	dm.outboxID = s.persistOutbox(dm)
 
-	s.deferredMessages[dm.ChatID] <- dm
+	s.schedule(dm)
 }
 
-func (s *Sender) sendDeferredMessages() {
-	timer := time.NewTicker(sendInterval)
+// schedule queues the request, or holds it in the scheduler until SendAt.
+func (s *Sender) schedule(dm DeferredMessage) {
+	if dm.SendAt.After(time.Now()) {
+		s.scheduler.add(dm)
+		return
+	}
+
+	s.enqueue(dm)
+}
 
-	for range timer.C {
-		var cases []reflect.SelectCase
+// scheduleDeletion deletes the messages sent by a request after delay.
+func (s *Sender) scheduleDeletion(result SendResult, delay time.Duration) {
+	var request Request
 
-		for userID, ch := range s.deferredMessages {
-			if s.userCanReceiveMessage(userID) && len(ch) > 0 {
-				sc := reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)}
-				cases = append(cases, sc)
-			}
+	switch {
+	case len(result.MessageIDs) > 0:
+		messageIDs := make([]int, 0, len(result.MessageIDs))
+		for _, messageID := range result.MessageIDs {
+			messageIDs = append(messageIDs, int(messageID))
 		}
 
-		if len(cases) > 0 {
-			_, value, ok := reflect.Select(cases)
-
-			if ok {
-				dm := value.Interface().(DeferredMessage)
-
-				var (
-					err         error
-					messageID   int64
-					forwardDate int
-				)
-
-				switch dm.Method {
-				case "sendMessage":
-					resultMessage, errSendMessage := s.Bot.SendMessage(context.Background(), &bot.SendMessageParams{
-						ChatID:          dm.ChatID,
-						Text:            dm.Text,
-						MessageThreadID: dm.messageThreadID,
-						ReplyParameters: &models.ReplyParameters{MessageID: dm.replyToMessageID},
-						ReplyMarkup:     dm.replyMarkup,
-					})
-
-					messageID = int64(resultMessage.ID)
-					err = errSendMessage
-				case "sendMessageHTML":
-					resultMessage, errSendMessage := s.Bot.SendMessage(context.Background(), &bot.SendMessageParams{
-						ChatID:    dm.ChatID,
-						Text:      dm.Text,
-						ParseMode: "HTML",
-						LinkPreviewOptions: &models.LinkPreviewOptions{
-							IsDisabled: bot.True(),
-						},
-					})
-
-					messageID = int64(resultMessage.ID)
-					err = errSendMessage
-
-				case "copyMessage":
-					resultMessage, errCopyMessage := s.Bot.CopyMessage(context.Background(), &bot.CopyMessageParams{
-						ChatID:          dm.ChatID,
-						FromChatID:      dm.fromChatID,
-						MessageID:       dm.messageID,
-						MessageThreadID: dm.messageThreadID,
-						ReplyParameters: &models.ReplyParameters{MessageID: dm.replyToMessageID},
-					})
-
-					messageID = int64(resultMessage.ID)
-					err = errCopyMessage
-
-				case "forwardMessage":
-					resultMessage, errForwardMessage := s.Bot.ForwardMessage(context.Background(), &bot.ForwardMessageParams{
-						ChatID:     dm.ChatID,
-						FromChatID: dm.fromChatID,
-						MessageID:  dm.messageID,
-					})
-
-					if resultMessage.ForwardOrigin.MessageOriginHiddenUser == nil {
-						forwardDate = resultMessage.ForwardOrigin.MessageOriginUser.Date
-					} else {
-						forwardDate = resultMessage.ForwardOrigin.MessageOriginHiddenUser.Date
-					}
-
-					messageID = int64(resultMessage.ID)
-					err = errForwardMessage
-					dm.Text = resultMessage.Text
-				}
-
-				if dm.callback != nil {
-					_ = dm.callback(
-						SendResult{
-							ChatID:      dm.ChatID,
-							Msg:         dm.Text,
-							Error:       err,
-							MessageID:   messageID,
-							ForwardDate: forwardDate,
-						},
-					)
-				}
-
-				s.lastMessageTimes[dm.ChatID] = time.Now().UnixNano()
-			}
+		request = &DeleteMessages{ChatID: result.ChatID, MessageIDs: messageIDs}
+	case result.MessageID != 0:
+		request = &DeleteMessage{ChatID: result.ChatID, MessageID: int(result.MessageID)}
+	default:
+		return
+	}
+
+	s.MakeDeferred(DeferredMessage{Request: request, SendAt: time.Now().Add(delay)}, s.SendResult)
+}
+
+// deliver sends a queued request to Telegram and reports the result.
+// Retryable errors are returned as retryError, so the dispatcher sends the
+// request again later; the request is reported once it is sent or given up.
+// A request interrupted by shutdown stays pending and is sent after restart.
+func (s *Sender) deliver(ctx context.Context, dm *DeferredMessage) error {
+	result := s.call(ctx, dm.Request)
+	if result.Error != nil && ctx.Err() != nil {
+		return nil
+	}
+
+	dm.attempts++
+
+	if err := result.Error; isRetryable(err) && dm.attempts < retryAttempts {
+		after := retryDelay(err, dm.attempts)
+
+		s.lgr.Warn(fmt.Sprintf("%s to %d failed, attempt %d of %d: %s", dm.Request.Method(), dm.Request.Chat(), dm.attempts, retryAttempts, err.Error()))
+		s.updateOutbox(*dm, data.OutboxPending, err.Error())
+
+		return &retryError{err: err, after: after}
+	}
+
+	s.finishOutbox(dm, result.Error)
+
+	if result.Error == nil && dm.DeleteAfter > 0 {
+		s.scheduleDeletion(result, dm.DeleteAfter)
+	}
+
+	if dm.After != nil {
+		if err := dm.After.run(s, dm.Request, result); err != nil {
+			s.lgr.Error(fmt.Sprintf("%s after %s to %d error: %s", dm.After.Kind(), dm.Request.Method(), dm.Request.Chat(), err.Error()))
 		}
 	}
+
+	if dm.callback != nil {
+		_ = dm.callback(result)
+	}
+
+	return result.Error
 }
 
-func (s *Sender) userCanReceiveMessage(userID int64) bool {
-	t, ok := s.lastMessageTimes[userID]
+// call makes the Bot API call of the request.
+func (s *Sender) call(ctx context.Context, request Request) SendResult {
+	result := request.do(ctx, s)
+	result.Method = request.Method()
 
-	return !ok || t+sendCooldownPerUser <= time.Now().UnixNano()
+	return result
 }
@@ -0,0 +1,327 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	conf "github.com/ad/telegram-delete-join-messages/config"
+	"github.com/go-telegram/bot"
+)
+
+// Telegram limits, see https://core.telegram.org/bots/faq#my-bot-is-hitting-limits-how-do-i-avoid-this
+const (
+	globalMessagesPerSecond = 30
+	privateChatInterval     = time.Second
+	groupChatInterval       = 3 * time.Second // 20 messages per minute
+
+	dispatcherWorkers = 4
+	dispatcherIdle    = time.Minute
+	maxTrackedChats   = 1000
+)
+
+// dispatcher queues outgoing requests per chat and sends them with
+// dispatcherWorkers workers, taking chats in round-robin order while
+// keeping to the global and per-chat rate limits. A chat has at most one
+// request in flight, so requests to a chat are sent in order.
+type dispatcher struct {
+	mu       sync.Mutex
+	queues   map[int64][]DeferredMessage
+	chats    []int64 // chats with queued requests in round-robin order
+	cursor   int
+	busy     map[int64]bool
+	nextSend map[int64]time.Time
+	bucket   tokenBucket
+
+	stopping bool
+	drained  chan struct{} // closed once stopping with nothing left to send
+
+	wake chan struct{}
+	send func(context.Context, *DeferredMessage) error
+	now  func() time.Time
+}
+
+func newDispatcher(send func(context.Context, *DeferredMessage) error) *dispatcher {
+	return &dispatcher{
+		queues:   make(map[int64][]DeferredMessage),
+		busy:     make(map[int64]bool),
+		nextSend: make(map[int64]time.Time),
+		bucket:   tokenBucket{rate: globalMessagesPerSecond, burst: globalMessagesPerSecond, tokens: globalMessagesPerSecond},
+		drained:  make(chan struct{}),
+		wake:     make(chan struct{}, 1),
+		send:     send,
+		now:      time.Now,
+	}
+}
+
+// push queues the request. If the queue of the chat already holds size
+// requests, one request is dropped according to policy and returned.
+func (d *dispatcher) push(dm DeferredMessage, size int, policy string) []DeferredMessage {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var dropped []DeferredMessage
+
+	chatID := dm.Request.Chat()
+	queue := d.queues[chatID]
+	if len(queue) >= size {
+		if policy == conf.OverflowDropNewest {
+			return []DeferredMessage{dm}
+		}
+
+		dropped = append(dropped, queue[0])
+		queue = queue[1:]
+	}
+
+	d.queues[chatID] = append(queue, dm)
+	d.activate(chatID)
+
+	d.signal()
+
+	return dropped
+}
+
+// activate adds the chat to the round-robin order if it is not there yet.
+func (d *dispatcher) activate(chatID int64) {
+	for _, id := range d.chats {
+		if id == chatID {
+			return
+		}
+	}
+
+	d.chats = append(d.chats, chatID)
+}
+
+func (d *dispatcher) signal() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next takes the request to send now. If there is none it returns how long
+// to wait before one may become ready.
+func (d *dispatcher) next() (DeferredMessage, bool, time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	wait := dispatcherIdle
+
+	if len(d.nextSend) > maxTrackedChats {
+		for chatID, at := range d.nextSend {
+			if at.Before(now) {
+				delete(d.nextSend, chatID)
+			}
+		}
+	}
+
+	if tokenWait := d.bucket.wait(now); tokenWait > 0 {
+		return DeferredMessage{}, false, tokenWait
+	}
+
+	for i := range d.chats {
+		index := (d.cursor + i) % len(d.chats)
+		chatID := d.chats[index]
+
+		if d.busy[chatID] {
+			continue
+		}
+
+		if chatWait := d.nextSend[chatID].Sub(now); chatWait > 0 {
+			wait = min(wait, chatWait)
+			continue
+		}
+
+		dm := d.queues[chatID][0]
+
+		d.queues[chatID] = d.queues[chatID][1:]
+		d.busy[chatID] = true
+		d.bucket.take()
+
+		if len(d.queues[chatID]) == 0 {
+			delete(d.queues, chatID)
+			d.chats = append(d.chats[:index], d.chats[index+1:]...)
+			d.cursor = index
+		} else {
+			d.cursor = index + 1
+		}
+
+		if len(d.chats) > 0 {
+			d.cursor %= len(d.chats)
+		} else {
+			d.cursor = 0
+		}
+
+		return dm, true, 0
+	}
+
+	return DeferredMessage{}, false, wait
+}
+
+// done releases the chat of a sent request. A request to retry is put back
+// in front of its chat queue until the retry delay passes. On 429 the
+// global bucket is emptied to slow everything else down as well.
+func (d *dispatcher) done(dm DeferredMessage, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	chatID := dm.Request.Chat()
+
+	delete(d.busy, chatID)
+	d.nextSend[chatID] = now.Add(chatInterval(chatID))
+
+	var retry *retryError
+	if errors.As(err, &retry) {
+		d.nextSend[chatID] = now.Add(max(retry.after, chatInterval(chatID)))
+
+		d.queues[chatID] = append([]DeferredMessage{dm}, d.queues[chatID]...)
+		d.activate(chatID)
+	}
+
+	var tooManyRequests *bot.TooManyRequestsError
+	if errors.As(err, &tooManyRequests) {
+		d.bucket.drain(now)
+	}
+
+	d.checkDrained()
+	d.signal()
+}
+
+// stop makes run return once every queued request is sent.
+func (d *dispatcher) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.stopping = true
+	d.checkDrained()
+}
+
+func (d *dispatcher) checkDrained() {
+	if !d.stopping || len(d.queues) > 0 || len(d.busy) > 0 {
+		return
+	}
+
+	select {
+	case <-d.drained:
+	default:
+		close(d.drained)
+	}
+}
+
+// size returns the number of queued requests of all chats.
+func (d *dispatcher) size() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	size := 0
+	for _, queue := range d.queues {
+		size += len(queue)
+	}
+
+	return size
+}
+
+// pending returns the number of queued requests of the chat.
+func (d *dispatcher) pending(chatID int64) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return len(d.queues[chatID])
+}
+
+// queued returns a copy of the queued requests of the chat.
+func (d *dispatcher) queued(chatID int64) []DeferredMessage {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]DeferredMessage{}, d.queues[chatID]...)
+}
+
+// run sends queued requests until ctx is done, or until the queue is
+// drained after stop.
+func (d *dispatcher) run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for range dispatcherWorkers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			d.work(ctx)
+		}()
+	}
+
+	wg.Wait()
+}
+
+func (d *dispatcher) work(ctx context.Context) {
+	for {
+		dm, ok, wait := d.next()
+		if ok {
+			// let another worker pick the next chat while this one sends
+			d.signal()
+			d.done(dm, d.send(ctx, &dm))
+
+			continue
+		}
+
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-d.drained:
+			timer.Stop()
+			return
+		case <-d.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// chatInterval is the minimal interval between messages to a chat:
+// groups and channels have negative IDs and stricter limits.
+func chatInterval(chatID int64) time.Duration {
+	if chatID < 0 {
+		return groupChatInterval
+	}
+
+	return privateChatInterval
+}
+
+// tokenBucket allows rate events per second with bursts of up to burst events.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// wait refills the bucket and returns how long to wait for a token.
+func (b *tokenBucket) wait(now time.Time) time.Duration {
+	if !b.last.IsZero() {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+
+	b.last = now
+
+	if b.tokens >= 1 {
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) take() {
+	b.tokens--
+}
+
+func (b *tokenBucket) drain(now time.Time) {
+	b.tokens = 0
+	b.last = now
+}
@@ -0,0 +1,217 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	conf "github.com/ad/telegram-delete-join-messages/config"
+	"github.com/go-telegram/bot"
+)
+
+func newTestDispatcher(now *time.Time) *dispatcher {
+	d := newDispatcher(func(context.Context, *DeferredMessage) error { return nil })
+	d.now = func() time.Time { return *now }
+
+	return d
+}
+
+func TestDispatcherRoundRobin(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	d := newTestDispatcher(&now)
+
+	for _, dm := range []*SendMessage{
+		{ChatID: 1, Text: "1a"},
+		{ChatID: 1, Text: "1b"},
+		{ChatID: 2, Text: "2a"},
+		{ChatID: 3, Text: "3a"},
+	} {
+		d.push(DeferredMessage{Request: dm}, 10, conf.OverflowDropOldest)
+	}
+
+	got := []string{}
+	for {
+		dm, ok, _ := d.next()
+		if !ok {
+			break
+		}
+
+		got = append(got, dm.Request.(*SendMessage).Text)
+		d.done(dm, nil)
+	}
+
+	if len(got) != 3 || got[0] != "1a" || got[1] != "2a" || got[2] != "3a" {
+		t.Fatalf("Expected one message per chat in order, got %v", got)
+	}
+
+	now = now.Add(privateChatInterval)
+
+	if dm, ok, _ := d.next(); !ok || dm.Request.(*SendMessage).Text != "1b" {
+		t.Fatalf("Expected 1b after the chat interval, got %#v, %v", dm.Request, ok)
+	}
+}
+
+func TestDispatcherChatIntervals(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	d := newTestDispatcher(&now)
+
+	for _, chatID := range []int64{100, 100, -100, -100} {
+		d.push(DeferredMessage{Request: &SendMessage{ChatID: chatID}}, 10, conf.OverflowDropOldest)
+	}
+
+	for range 2 {
+		dm, ok, _ := d.next()
+		if !ok {
+			t.Fatal("Expected the first message of each chat to be ready")
+		}
+
+		d.done(dm, nil)
+	}
+
+	if _, ok, wait := d.next(); ok || wait != privateChatInterval {
+		t.Fatalf("Expected to wait %s for the private chat, got %v, %s", privateChatInterval, ok, wait)
+	}
+
+	now = now.Add(privateChatInterval)
+
+	if dm, ok, _ := d.next(); !ok || dm.Request.Chat() != 100 {
+		t.Fatalf("Expected the private chat to be ready first, got %#v, %v", dm.Request, ok)
+	}
+
+	if _, ok, wait := d.next(); ok || wait != groupChatInterval-privateChatInterval {
+		t.Fatalf("Expected to wait for the group, got %v, %s", ok, wait)
+	}
+
+	now = now.Add(groupChatInterval)
+
+	if dm, ok, _ := d.next(); !ok || dm.Request.Chat() != -100 {
+		t.Fatalf("Expected the group to be ready, got %#v, %v", dm.Request, ok)
+	}
+}
+
+func TestDispatcherGlobalLimit(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	d := newTestDispatcher(&now)
+
+	for chatID := range int64(globalMessagesPerSecond + 5) {
+		d.push(DeferredMessage{Request: &SendMessage{ChatID: chatID + 1}}, 10, conf.OverflowDropOldest)
+	}
+
+	sent := 0
+	for {
+		dm, ok, wait := d.next()
+		if !ok {
+			if wait <= 0 || wait > time.Second {
+				t.Errorf("Expected to wait for a token, got %s", wait)
+			}
+
+			break
+		}
+
+		sent++
+		d.done(dm, nil)
+	}
+
+	if sent != globalMessagesPerSecond {
+		t.Fatalf("Expected %d messages in a burst, got %d", globalMessagesPerSecond, sent)
+	}
+
+	now = now.Add(time.Second / globalMessagesPerSecond)
+
+	if _, ok, _ := d.next(); !ok {
+		t.Fatal("Expected a message once a token is refilled")
+	}
+}
+
+func TestDispatcherTooManyRequests(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	d := newTestDispatcher(&now)
+
+	d.push(DeferredMessage{Request: &SendMessage{ChatID: 1, Text: "a"}}, 10, conf.OverflowDropOldest)
+	d.push(DeferredMessage{Request: &SendMessage{ChatID: 1, Text: "b"}}, 10, conf.OverflowDropOldest)
+
+	dm, ok, _ := d.next()
+	if !ok {
+		t.Fatal("Expected a message")
+	}
+
+	if _, ok, _ := d.next(); ok {
+		t.Fatal("Expected the chat to be busy while a message is in flight")
+	}
+
+	tooManyRequests := &bot.TooManyRequestsError{Message: "Too Many Requests", RetryAfter: 5}
+	d.done(dm, &retryError{err: tooManyRequests, after: retryDelay(tooManyRequests, 1)})
+
+	if d.bucket.tokens >= 1 {
+		t.Errorf("Expected 429 to empty the global bucket, got %f tokens", d.bucket.tokens)
+	}
+
+	if queue := d.queued(1); len(queue) != 2 || queue[0].Request.(*SendMessage).Text != "a" {
+		t.Fatalf("Expected the rejected message to be retried first, got %+v", queue)
+	}
+
+	now = now.Add(4 * time.Second)
+
+	if _, ok, wait := d.next(); ok || wait != time.Second {
+		t.Fatalf("Expected to wait for retry_after, got %v, %s", ok, wait)
+	}
+
+	now = now.Add(time.Second)
+
+	if dm, ok, _ := d.next(); !ok || dm.Request.(*SendMessage).Text != "a" {
+		t.Fatalf("Expected a to be retried, got %#v, %v", dm.Request, ok)
+	}
+}
+
+func TestDispatcherRun(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		sent []string
+		all  = make(chan struct{})
+	)
+
+	d := newDispatcher(func(_ context.Context, dm *DeferredMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		text := dm.Request.(*SendMessage).Text
+
+		sent = append(sent, text)
+		if len(sent) == 3 {
+			close(all)
+		}
+
+		if text == "fail" {
+			return errors.New("Bad Request")
+		}
+
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		d.run(ctx)
+		close(done)
+	}()
+
+	for i, text := range []string{"a", "fail", "b"} {
+		d.push(DeferredMessage{Request: &SendMessage{ChatID: int64(i + 1), Text: text}}, 10, conf.OverflowDropOldest)
+	}
+
+	select {
+	case <-all:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected all messages to be sent")
+	}
+
+	cancel()
+	<-done
+
+	if d.pending(2) != 0 {
+		t.Error("Expected a failed message not to be retried")
+	}
+}
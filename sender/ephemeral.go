@@ -0,0 +1,36 @@
+package sender
+
+import (
+	"time"
+
+	"github.com/go-telegram/bot/models"
+)
+
+// ephemeralTTL is how long a bot reply stays in the chat: replies in groups
+// are deleted after EPHEMERAL_MESSAGES_TTL, private chats keep them.
+func (s *Sender) ephemeralTTL(chatID int64) time.Duration {
+	if chatID > 0 {
+		return 0
+	}
+
+	return time.Duration(s.config.Load().EphemeralMessagesTTL) * time.Second
+}
+
+// replyEphemeral replies to the chat and thread of message with a message
+// that is deleted after the ephemeral TTL of the chat.
+func (s *Sender) replyEphemeral(message *models.Message, text string, parseMode models.ParseMode) {
+	messageThreadID := 0
+	if message.IsTopicMessage {
+		messageThreadID = message.MessageThreadID
+	}
+
+	s.MakeDeferred(DeferredMessage{
+		Request: &SendMessage{
+			ChatID:          message.Chat.ID,
+			Text:            text,
+			ParseMode:       parseMode,
+			MessageThreadID: messageThreadID,
+		},
+		DeleteAfter: s.ephemeralTTL(message.Chat.ID),
+	}, s.SendResult)
+}
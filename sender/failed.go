@@ -0,0 +1,143 @@
+package sender
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ad/telegram-delete-join-messages/data"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// failedListLimit is how many of the latest failed requests /failed shows.
+const failedListLimit = 20
+
+// Handle /failed command: list the dead-letter requests, or queue them
+// again with "/failed retry <id>" or "/failed retry all"
+func (s *Sender) failed(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.Message == nil || update.Message.From == nil {
+		return
+	}
+
+	if !slices.Contains(s.config.Load().TelegramAdminIDsList, update.Message.From.ID) {
+		return
+	}
+
+	locale := s.adminLocale()
+	args := strings.Fields(update.Message.Text)[1:]
+
+	var text string
+
+	switch {
+	case len(args) == 0:
+		text = s.failedList(locale)
+	case len(args) == 2 && args[0] == "retry":
+		var id int64
+		if args[1] != "all" {
+			parsed, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil || parsed <= 0 {
+				text = s.t(locale, "admin.failed_usage")
+				break
+			}
+
+			id = parsed
+		}
+
+		count, err := s.retryFailed(id)
+
+		switch {
+		case err != nil:
+			s.lgr.Error(fmt.Sprintf("retryFailed error: %s", err.Error()))
+			text = s.t(locale, "admin.failed_load_error")
+		case count == 0 && id != 0:
+			text = s.t(locale, "admin.failed_not_found", id)
+		default:
+			text = s.t(locale, "admin.failed_retried", count)
+		}
+	default:
+		text = s.t(locale, "admin.failed_usage")
+	}
+
+	_, errSendMessage := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: update.Message.Chat.ID,
+		Text:   text,
+	})
+
+	if errSendMessage != nil {
+		fmt.Println("errSendMessage (/failed): ", errSendMessage)
+	}
+}
+
+// failedList describes the latest failed requests, newest first.
+func (s *Sender) failedList(locale string) string {
+	messages, err := s.Store.ListOutbox(data.OutboxFailed)
+	if err != nil {
+		s.lgr.Error(fmt.Sprintf("failedList ListOutbox error: %s", err.Error()))
+		return s.t(locale, "admin.failed_load_error")
+	}
+
+	if len(messages) == 0 {
+		return s.t(locale, "admin.failed_empty")
+	}
+
+	lines := []string{s.t(locale, "admin.failed_title", len(messages))}
+
+	for i := len(messages) - 1; i >= 0 && i >= len(messages)-failedListLimit; i-- {
+		message := messages[i]
+
+		method := "?"
+		if dm, err := decodeDeferredMessage(message); err == nil {
+			method = dm.Request.Method()
+		}
+
+		lines = append(lines, s.t(locale, "admin.failed_item", message.ID, method, message.ChatID, message.Attempts, message.LastError))
+	}
+
+	lines = append(lines, s.t(locale, "admin.failed_usage"))
+
+	return strings.Join(lines, "\n\n")
+}
+
+// retryFailed queues the failed request with the given outbox ID, or every
+// failed request if id is 0, and returns how many were queued.
+func (s *Sender) retryFailed(id int64) (int, error) {
+	messages, err := s.Store.ListOutbox(data.OutboxFailed)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+
+	for _, message := range messages {
+		if id != 0 && message.ID != id {
+			continue
+		}
+
+		dm, err := decodeDeferredMessage(message)
+		if err != nil {
+			s.lgr.Error(fmt.Sprintf("retryFailed decode error for %d: %s", message.ID, err.Error()))
+			continue
+		}
+
+		// dead-lettered before moderation calls were kept out of the list
+		if _, ok := dm.Request.(moderationRequest); ok {
+			s.lgr.Warn(fmt.Sprintf("retryFailed dropped %s request %d, it depends on the state of the member", dm.Request.Method(), message.ID))
+			s.updateOutbox(dm, data.OutboxDropped, "moderation requests are not replayed")
+
+			continue
+		}
+
+		dm.attempts = 0
+		dm.callback = s.SendResult
+
+		s.updateOutbox(dm, data.OutboxPending, "")
+		s.enqueue(dm)
+
+		count++
+	}
+
+	return count, nil
+}
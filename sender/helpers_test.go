@@ -0,0 +1,85 @@
+package sender
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	conf "github.com/ad/telegram-delete-join-messages/config"
+	"github.com/ad/telegram-delete-join-messages/data"
+	"github.com/go-telegram/bot"
+)
+
+// newTestSender returns a Sender backed by an in-memory store that does
+// not talk to Telegram.
+func newTestSender(t *testing.T, config *conf.Config) *Sender {
+	t.Helper()
+
+	if config.AdminLocale == "" {
+		config.AdminLocale = "ru"
+	}
+
+	if config.DefaultLocale == "" {
+		config.DefaultLocale = "ru"
+	}
+
+	if config.OutboxQueueSize == 0 {
+		config.OutboxQueueSize = 100
+	}
+
+	if config.OutboxOverflowPolicy == "" {
+		config.OutboxOverflowPolicy = conf.OverflowDropOldest
+	}
+
+	store := data.NewMemoryStore()
+
+	sender := &Sender{
+		lgr:            slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Store:          store,
+		forwardTargets: make(map[int64]map[int64]int64),
+		convHandler:    NewConversationHandler(store),
+	}
+	sender.config.Store(config)
+	sender.dispatcher = newDispatcher(sender.deliver)
+	sender.scheduler = newScheduler(sender.enqueue)
+	sender.updates = newUpdatePool()
+
+	return sender
+}
+
+// newFakeBotAPI returns a bot talking to a fake Bot API that answers every
+// call with true, and the methods it was called with.
+func newFakeBotAPI(t *testing.T) (*bot.Bot, func() []string) {
+	t.Helper()
+
+	var (
+		mu    sync.Mutex
+		calls []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		calls = append(calls, req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:])
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok": true, "result": true}`))
+	}))
+	t.Cleanup(server.Close)
+
+	b, err := bot.New("123:token", bot.WithSkipGetMe(), bot.WithServerURL(server.URL))
+	if err != nil {
+		t.Fatalf("bot.New error: %v", err)
+	}
+
+	return b, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]string{}, calls...)
+	}
+}
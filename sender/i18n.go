@@ -0,0 +1,40 @@
+package sender
+
+import (
+	"github.com/ad/telegram-delete-join-messages/translations"
+	"github.com/go-telegram/bot/models"
+)
+
+// t returns the catalog message for key in locale.
+func (s *Sender) t(locale, key string, args ...any) string {
+	return translations.Default().T(locale, key, args...)
+}
+
+// userLocale picks the locale of a user from their Telegram language,
+// falling back to DEFAULT_LOCALE.
+func (s *Sender) userLocale(user *models.User) string {
+	languageCode := ""
+	if user != nil {
+		languageCode = user.LanguageCode
+	}
+
+	return translations.Default().Resolve(languageCode, s.config.Load().DefaultLocale)
+}
+
+// adminLocale returns the locale of admin notifications.
+func (s *Sender) adminLocale() string {
+	return translations.Default().Resolve(s.config.Load().AdminLocale, s.config.Load().DefaultLocale)
+}
+
+// NotifyFirstAdmin sends the catalog message key to the first admin in the admin locale.
+func (s *Sender) NotifyFirstAdmin(key string, args ...any) {
+	adminIDs := s.config.Load().TelegramAdminIDsList
+	if len(adminIDs) == 0 {
+		return
+	}
+
+	s.MakeRequestDeferred(&SendMessage{
+		ChatID: adminIDs[0],
+		Text:   s.t(s.adminLocale(), key, args...),
+	}, s.SendResult)
+}
@@ -0,0 +1,309 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ad/telegram-delete-join-messages/data"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const joinDecisionCallbackPrefix = "join:"
+
+// Decisions an admin can make on a join request in MANUAL_APPROVAL mode.
+const (
+	joinApprove = "approve"
+	joinDecline = "decline"
+	joinBan     = "ban"
+)
+
+var joinDecisions = []string{joinApprove, joinDecline, joinBan}
+
+// decisionLocks serialize the decisions on each join request, so a slow
+// decision on one request doesn't hold up the others.
+type decisionLocks struct {
+	mu    sync.Mutex
+	locks map[chatUser]*decisionLock
+}
+
+type decisionLock struct {
+	sync.Mutex
+	users int // holders and waiters, the lock is dropped when none are left
+}
+
+// lock locks the join request of userID to chatID and returns the unlock function.
+func (d *decisionLocks) lock(chatID, userID int64) func() {
+	key := chatUser{chatID: chatID, userID: userID}
+
+	d.mu.Lock()
+	if d.locks == nil {
+		d.locks = make(map[chatUser]*decisionLock)
+	}
+
+	l, ok := d.locks[key]
+	if !ok {
+		l = &decisionLock{}
+		d.locks[key] = l
+	}
+
+	l.users++
+	d.mu.Unlock()
+
+	l.Lock()
+
+	return func() {
+		l.Unlock()
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		l.users--
+		if l.users == 0 {
+			delete(d.locks, key)
+		}
+	}
+}
+
+// notifyAdminsJoinRequestDecision stores the join request as undecided and
+// sends every admin the request with buttons to decide on it. The sent
+// messages are remembered by RememberJoinRequestNotification, so all of
+// them are updated once an admin decides.
+func (s *Sender) notifyAdminsJoinRequestDecision(user *models.User, chatID int64) {
+	adminIDs := s.config.Load().TelegramAdminIDsList
+	if len(adminIDs) == 0 {
+		s.lgr.Warn(fmt.Sprintf("Join request of %d to %d waits for manual approval, but there are no admins", user.ID, chatID))
+		return
+	}
+
+	unlock := s.decisions.lock(chatID, user.ID)
+	err := s.Store.SaveJoinRequestDecision(data.JoinRequestDecision{ChatID: chatID, UserID: user.ID})
+	unlock()
+
+	if err != nil {
+		s.lgr.Error(fmt.Sprintf("SaveJoinRequestDecision error for %d in %d: %s", user.ID, chatID, err.Error()))
+	}
+
+	locale := s.adminLocale()
+	text := s.adminUserNotification(locale, "admin.join_request", user, chatID)
+	markup := s.joinDecisionKeyboard(locale, chatID, user.ID)
+
+	for _, adminID := range adminIDs {
+		s.MakeDeferred(DeferredMessage{
+			Request: &SendMessage{
+				ChatID:      adminID,
+				Text:        text,
+				ReplyMarkup: markup,
+			},
+			After: &RememberJoinRequestNotification{ChatID: chatID, UserID: user.ID, AdminID: adminID},
+		}, s.SendResult)
+	}
+}
+
+// joinDecidedText is a notification about a join request with the decision on it.
+func (s *Sender) joinDecidedText(notification string, decision data.JoinRequestDecision) string {
+	return notification + "\n\n" + s.t(s.adminLocale(), "admin.join_decided_"+decision.Decision, decision.DecidedBy)
+}
+
+// RememberJoinRequestNotification stores the message an admin was notified
+// about a join request with. A notification sent after an admin already
+// decided is updated with the decision right away.
+type RememberJoinRequestNotification struct {
+	ChatID  int64 `json:"chat_id"`
+	UserID  int64 `json:"user_id"`
+	AdminID int64 `json:"admin_id"`
+}
+
+func (a *RememberJoinRequestNotification) Kind() string { return "rememberJoinRequestNotification" }
+
+func (a *RememberJoinRequestNotification) run(s *Sender, request Request, result SendResult) error {
+	if result.Error != nil {
+		return nil
+	}
+
+	defer s.decisions.lock(a.ChatID, a.UserID)()
+
+	decision, err := s.Store.GetJoinRequestDecision(a.ChatID, a.UserID)
+	if err != nil && !errors.Is(err, data.ErrNotFound) {
+		return err
+	}
+
+	if err == nil && decision.Decision != "" {
+		text := ""
+		if message, ok := request.(*SendMessage); ok {
+			text = message.Text
+		}
+
+		s.MakeRequestDeferred(&EditMessageText{
+			ChatID:    a.AdminID,
+			MessageID: int(result.MessageID),
+			Text:      s.joinDecidedText(text, decision),
+		}, s.SendResult)
+
+		return nil
+	}
+
+	return s.Store.AddJoinRequestNotification(data.JoinRequestNotification{
+		ChatID:    a.ChatID,
+		UserID:    a.UserID,
+		AdminID:   a.AdminID,
+		MessageID: int(result.MessageID),
+	})
+}
+
+func (s *Sender) joinDecisionKeyboard(locale string, chatID, userID int64) *models.InlineKeyboardMarkup {
+	row := []models.InlineKeyboardButton{}
+
+	for _, decision := range joinDecisions {
+		row = append(row, models.InlineKeyboardButton{
+			Text:         s.t(locale, "admin.join_button_"+decision),
+			CallbackData: fmt.Sprintf("%s%s:%d:%d", joinDecisionCallbackPrefix, decision, chatID, userID),
+		})
+	}
+
+	return &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{row}}
+}
+
+// parseJoinDecisionCallback parses callback data of the form
+// join:<decision>:<chat>:<user>.
+func parseJoinDecisionCallback(raw string) (string, int64, int64, error) {
+	parts := strings.Split(strings.TrimPrefix(raw, joinDecisionCallbackPrefix), ":")
+	if len(parts) != 3 || !slices.Contains(joinDecisions, parts[0]) {
+		return "", 0, 0, fmt.Errorf("invalid join decision callback %q", raw)
+	}
+
+	chatID, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || chatID == 0 {
+		return "", 0, 0, fmt.Errorf("invalid chat id %q", parts[1])
+	}
+
+	userID, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || userID == 0 {
+		return "", 0, 0, fmt.Errorf("invalid user id %q", parts[2])
+	}
+
+	return parts[0], chatID, userID, nil
+}
+
+// Handle a press of a decision button: the first admin to press decides,
+// and the notifications of all admins show who it was.
+func (s *Sender) joinDecisionCallback(ctx context.Context, b *bot.Bot, update *models.Update) {
+	query := update.CallbackQuery
+	if query == nil || query.Message.Message == nil {
+		return
+	}
+
+	locale := s.adminLocale()
+	answer := ""
+
+	defer func() {
+		_, errAnswer := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: query.ID,
+			Text:            answer,
+		})
+
+		if errAnswer != nil {
+			fmt.Println("errAnswerCallbackQuery (join decision): ", errAnswer)
+		}
+	}()
+
+	if !slices.Contains(s.config.Load().TelegramAdminIDsList, query.From.ID) {
+		answer = s.t(locale, "admin.admins_only")
+		return
+	}
+
+	decision, chatID, userID, err := parseJoinDecisionCallback(query.Data)
+	if err != nil {
+		s.lgr.Error(fmt.Sprintf("joinDecisionCallback parse error: %s", err.Error()))
+		return
+	}
+
+	defer s.decisions.lock(chatID, userID)()
+
+	state, errState := s.Store.GetJoinRequestDecision(chatID, userID)
+	if errState != nil && !errors.Is(errState, data.ErrNotFound) {
+		s.lgr.Error(fmt.Sprintf("joinDecisionCallback GetJoinRequestDecision error for %d in %d: %s", userID, chatID, errState.Error()))
+		answer = s.t(locale, "admin.join_decision_failed", errState.Error())
+
+		return
+	}
+
+	notifications, err := s.Store.ListJoinRequestNotifications(chatID, userID)
+	if err != nil {
+		s.lgr.Error(fmt.Sprintf("joinDecisionCallback ListJoinRequestNotifications error for %d in %d: %s", userID, chatID, err.Error()))
+		answer = s.t(locale, "admin.join_decision_failed", err.Error())
+
+		return
+	}
+
+	// requests notified about by older versions have no decision stored
+	decided := state.Decision != "" || (errState != nil && len(notifications) == 0)
+
+	if decided {
+		answer = s.t(locale, "admin.join_already_decided")
+
+		s.MakeRequestDeferred(&EditMessageReplyMarkup{ChatID: query.From.ID, MessageID: query.Message.Message.ID}, s.SendResult)
+
+		return
+	}
+
+	if err := s.decideJoinRequest(ctx, decision, chatID, userID); err != nil {
+		s.lgr.Error(fmt.Sprintf("joinDecisionCallback %s error for %d in %d: %s", decision, userID, chatID, err.Error()))
+		answer = s.t(locale, "admin.join_decision_failed", err.Error())
+
+		return
+	}
+
+	s.lgr.Info(fmt.Sprintf("Join request of %d to %d: %s by %d", userID, chatID, decision, query.From.ID))
+
+	state = data.JoinRequestDecision{ChatID: chatID, UserID: userID, Decision: decision, DecidedBy: adminName(&query.From)}
+	if err := s.Store.SaveJoinRequestDecision(state); err != nil {
+		s.lgr.Error(fmt.Sprintf("joinDecisionCallback SaveJoinRequestDecision error for %d in %d: %s", userID, chatID, err.Error()))
+	}
+
+	answer = s.t(locale, "admin.join_decided_"+decision, state.DecidedBy)
+	text := s.joinDecidedText(query.Message.Message.Text, state)
+
+	for _, notification := range notifications {
+		s.MakeRequestDeferred(&EditMessageText{
+			ChatID:    notification.AdminID,
+			MessageID: notification.MessageID,
+			Text:      text,
+		}, s.SendResult)
+	}
+
+	if err := s.Store.DeleteJoinRequestNotifications(chatID, userID); err != nil {
+		s.lgr.Error(fmt.Sprintf("joinDecisionCallback DeleteJoinRequestNotifications error for %d in %d: %s", userID, chatID, err.Error()))
+	}
+}
+
+// decideJoinRequest approves or declines the join request, a banned user
+// can't send another one.
+func (s *Sender) decideJoinRequest(ctx context.Context, decision string, chatID, userID int64) error {
+	switch decision {
+	case joinApprove:
+		return s.callWithRetry(ctx, &ApproveChatJoinRequest{ChatID: chatID, UserID: userID})
+	case joinDecline:
+		return s.callWithRetry(ctx, &DeclineChatJoinRequest{ChatID: chatID, UserID: userID})
+	default:
+		if err := s.callWithRetry(ctx, &DeclineChatJoinRequest{ChatID: chatID, UserID: userID}); err != nil {
+			s.lgr.Warn(fmt.Sprintf("Declining the join request of %d to %d before the ban failed: %s", userID, chatID, err.Error()))
+		}
+
+		return s.callWithRetry(ctx, &BanChatMember{ChatID: chatID, UserID: userID})
+	}
+}
+
+// adminName is how the admin who decided is shown to the others.
+func adminName(user *models.User) string {
+	if user.Username != "" {
+		return "@" + user.Username
+	}
+
+	return strings.TrimSpace(user.FirstName + " " + user.LastName)
+}
@@ -0,0 +1,191 @@
+package sender
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	conf "github.com/ad/telegram-delete-join-messages/config"
+	"github.com/ad/telegram-delete-join-messages/data"
+	"github.com/go-telegram/bot/models"
+)
+
+func TestParseJoinDecisionCallback(t *testing.T) {
+	decision, chatID, userID, err := parseJoinDecisionCallback("join:ban:-1001234:5000000001")
+	if err != nil || decision != joinBan || chatID != -1001234 || userID != 5000000001 {
+		t.Errorf("Expected ban of 5000000001 in -1001234, got %q, %d, %d, %v", decision, chatID, userID, err)
+	}
+
+	for _, raw := range []string{"join:", "join:kick:-100:1", "join:approve:-100", "join:approve:x:1", "join:approve:-100:0", "join:approve:-100:1:2"} {
+		if _, _, _, err := parseJoinDecisionCallback(raw); err == nil {
+			t.Errorf("Expected error for %q", raw)
+		}
+	}
+}
+
+func TestJoinDecisionCallback(t *testing.T) {
+	b, calls := newFakeBotAPI(t)
+
+	s := newTestSender(t, &conf.Config{TelegramAdminIDsList: []int64{1, 2}})
+	s.Bot = b
+
+	if err := s.Store.SaveJoinRequestDecision(data.JoinRequestDecision{ChatID: -100, UserID: 5000000001}); err != nil {
+		t.Fatalf("SaveJoinRequestDecision error: %v", err)
+	}
+
+	for _, notification := range []data.JoinRequestNotification{
+		{ChatID: -100, UserID: 5000000001, AdminID: 1, MessageID: 10},
+		{ChatID: -100, UserID: 5000000001, AdminID: 2, MessageID: 20},
+	} {
+		if err := s.Store.AddJoinRequestNotification(notification); err != nil {
+			t.Fatalf("AddJoinRequestNotification error: %v", err)
+		}
+	}
+
+	press := func(fromID int64, decision string) {
+		s.joinDecisionCallback(context.Background(), b, &models.Update{CallbackQuery: &models.CallbackQuery{
+			ID:   "1",
+			From: models.User{ID: fromID, Username: "boss"},
+			Message: models.MaybeInaccessibleMessage{Message: &models.Message{
+				ID:   10,
+				Chat: models.Chat{ID: fromID},
+				Text: "📝 request",
+			}},
+			Data: s.joinDecisionKeyboard("en", -100, 5000000001).InlineKeyboard[0][slices.Index(joinDecisions, decision)].CallbackData,
+		}})
+	}
+
+	press(3, joinApprove)
+
+	if slices.Contains(calls(), "approveChatJoinRequest") {
+		t.Fatalf("Expected a non-admin to be refused, got calls %v", calls())
+	}
+
+	press(2, joinApprove)
+
+	if !slices.Contains(calls(), "approveChatJoinRequest") {
+		t.Fatalf("Expected the join request to be approved, got calls %v", calls())
+	}
+
+	for _, adminID := range []int64{1, 2} {
+		queued := s.dispatcher.queued(adminID)
+		if len(queued) != 1 {
+			t.Fatalf("Expected the notification of admin %d to be updated, got %+v", adminID, queued)
+		}
+
+		edit, ok := queued[0].Request.(*EditMessageText)
+		if !ok || edit.Text != "📝 request\n\n"+s.t(s.adminLocale(), "admin.join_decided_approve", "@boss") || edit.ReplyMarkup != nil {
+			t.Errorf("Expected the notification to show who decided without buttons, got %+v", queued[0].Request)
+		}
+	}
+
+	if notifications, _ := s.Store.ListJoinRequestNotifications(-100, 5000000001); len(notifications) != 0 {
+		t.Errorf("Expected the notifications to be forgotten, got %+v", notifications)
+	}
+
+	if state, err := s.Store.GetJoinRequestDecision(-100, 5000000001); err != nil || state.Decision != joinApprove || state.DecidedBy != "@boss" {
+		t.Errorf("Expected the decision to be stored, got %+v, %v", state, err)
+	}
+
+	press(1, joinDecline)
+
+	if slices.Contains(calls(), "declineChatJoinRequest") {
+		t.Errorf("Expected a decided join request to stay decided, got calls %v", calls())
+	}
+}
+
+func TestJoinRequestNotificationAfterRestart(t *testing.T) {
+	s, _ := startTestSender(t)
+
+	if err := s.Store.SaveJoinRequestDecision(data.JoinRequestDecision{ChatID: -100, UserID: 5}); err != nil {
+		t.Fatalf("SaveJoinRequestDecision error: %v", err)
+	}
+
+	// queued before a restart, its callback is gone
+	s.persistOutbox(DeferredMessage{
+		Request: &SendMessage{ChatID: 1, Text: "📝 request"},
+		After:   &RememberJoinRequestNotification{ChatID: -100, UserID: 5, AdminID: 1},
+	})
+
+	s.replayOutbox()
+	s.Shutdown(5 * time.Second)
+
+	notifications, err := s.Store.ListJoinRequestNotifications(-100, 5)
+	if err != nil || len(notifications) != 1 || notifications[0].AdminID != 1 || notifications[0].MessageID != 1 {
+		t.Fatalf("Expected the replayed notification to be remembered, got %+v, %v", notifications, err)
+	}
+}
+
+func TestJoinRequestNotificationAfterDecision(t *testing.T) {
+	s := newTestSender(t, &conf.Config{TelegramAdminIDsList: []int64{1}})
+
+	decision := data.JoinRequestDecision{ChatID: -100, UserID: 5, Decision: joinDecline, DecidedBy: "@boss"}
+	if err := s.Store.SaveJoinRequestDecision(decision); err != nil {
+		t.Fatalf("SaveJoinRequestDecision error: %v", err)
+	}
+
+	after := &RememberJoinRequestNotification{ChatID: -100, UserID: 5, AdminID: 1}
+	if err := after.run(s, &SendMessage{ChatID: 1, Text: "📝 request"}, SendResult{ChatID: 1, MessageID: 30}); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+
+	queued := s.dispatcher.queued(1)
+	if len(queued) != 1 {
+		t.Fatalf("Expected the late notification to be updated, got %+v", queued)
+	}
+
+	edit, ok := queued[0].Request.(*EditMessageText)
+	if !ok || edit.MessageID != 30 || edit.Text != s.joinDecidedText("📝 request", decision) {
+		t.Errorf("Expected the late notification to show the decision, got %+v", queued[0].Request)
+	}
+
+	if notifications, _ := s.Store.ListJoinRequestNotifications(-100, 5); len(notifications) != 0 {
+		t.Errorf("Expected a decided notification not to be remembered, got %+v", notifications)
+	}
+}
+
+func TestDecisionLocks(t *testing.T) {
+	var locks decisionLocks
+
+	unlock := locks.lock(-100, 1)
+
+	other := make(chan struct{})
+	go func() {
+		locks.lock(-100, 2)()
+		close(other)
+	}()
+
+	select {
+	case <-other:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a decision on another join request not to wait")
+	}
+
+	same := make(chan struct{})
+	go func() {
+		locks.lock(-100, 1)()
+		close(same)
+	}()
+
+	select {
+	case <-same:
+		t.Fatal("Expected a decision on the same join request to wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlock()
+
+	select {
+	case <-same:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the waiting decision to go on after unlock")
+	}
+
+	locks.mu.Lock()
+	defer locks.mu.Unlock()
+
+	if len(locks.locks) != 0 {
+		t.Errorf("Expected unused locks to be dropped, got %d", len(locks.locks))
+	}
+}
@@ -0,0 +1,97 @@
+package sender
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// startQueue starts handling updates and sending the deferred requests.
+// The workers outlive ctx to drain the queues on shutdown, the scheduler
+// stops with ctx.
+func (s *Sender) startQueue(ctx context.Context) {
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	s.stopWorkers = stopWorkers
+	s.dispatcherStopped = make(chan struct{})
+
+	go func() {
+		s.dispatcher.run(workersCtx)
+		close(s.dispatcherStopped)
+	}()
+
+	s.workers.Go(func() { s.updates.run(workersCtx) })
+
+	s.running.Go(func() { s.scheduler.run(ctx) })
+	s.running.Go(func() { s.pruneOutboxEvery(ctx, outboxPruneInterval, outboxRetention) })
+	s.running.Go(func() { s.expireDeadlinesEvery(ctx, deadlineInterval) })
+}
+
+// Stop asks the bot to shut down, the same way cancelling the context of
+// InitSender does.
+func (s *Sender) Stop() {
+	s.stop()
+}
+
+// Done is closed when the bot is asked to shut down.
+func (s *Sender) Done() <-chan struct{} {
+	return s.done
+}
+
+// QueueStats is the depth of the bot queues, reported by the health
+// endpoint for monitoring.
+type QueueStats struct {
+	Updates   int `json:"updates"`   // updates waiting for a worker
+	Outbox    int `json:"outbox"`    // requests waiting to be sent
+	Scheduled int `json:"scheduled"` // requests waiting for their SendAt
+}
+
+// QueueStats returns the current depth of the bot queues.
+func (s *Sender) QueueStats() QueueStats {
+	return QueueStats{
+		Updates:   s.updates.depth(),
+		Outbox:    s.dispatcher.size(),
+		Scheduled: len(s.scheduler.scheduled()),
+	}
+}
+
+// Shutdown stops receiving updates and waits up to timeout for the queued
+// updates to be handled and then for the queued requests to be sent. Requests still
+// queued or scheduled stay pending in the outbox and are sent after the
+// next start.
+func (s *Sender) Shutdown(timeout time.Duration) {
+	s.stop()
+	s.running.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	select {
+	case <-waitChan(&s.updates.pending):
+	case <-ctx.Done():
+		s.lgr.Warn(fmt.Sprintf("shutdown timeout, %d queued updates are not handled", s.updates.depth()))
+	}
+
+	s.dispatcher.stop()
+
+	select {
+	case <-s.dispatcherStopped:
+	case <-ctx.Done():
+		s.lgr.Warn(fmt.Sprintf("shutdown timeout, %d queued requests are left for the next start", s.dispatcher.size()))
+	}
+
+	s.stopWorkers()
+	<-s.dispatcherStopped
+	s.workers.Wait()
+}
+
+func waitChan(wg *sync.WaitGroup) <-chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	return done
+}
@@ -0,0 +1,203 @@
+package sender
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	conf "github.com/ad/telegram-delete-join-messages/config"
+	"github.com/ad/telegram-delete-join-messages/data"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// startTestSender runs the queue of a test sender against a fake Bot API
+// and returns the paths of the calls it received.
+func startTestSender(t *testing.T) (*Sender, func() []string) {
+	t.Helper()
+
+	var (
+		mu    sync.Mutex
+		calls []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		calls = append(calls, req.URL.Path)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok": true, "result": {"message_id": 1, "chat": {"id": 1}}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	b, err := bot.New("123:token", bot.WithSkipGetMe(), bot.WithServerURL(server.URL))
+	if err != nil {
+		t.Fatalf("bot.New error: %v", err)
+	}
+
+	s := newTestSender(t, &conf.Config{})
+	s.Bot = b
+
+	ctx, stop := context.WithCancel(context.Background())
+	s.stop = stop
+	s.done = ctx.Done()
+	s.startQueue(ctx)
+
+	return s, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]string{}, calls...)
+	}
+}
+
+func TestShutdownDrainsQueue(t *testing.T) {
+	s, calls := startTestSender(t)
+
+	for chatID := range int64(3) {
+		s.MakeRequestDeferred(&SendMessage{ChatID: chatID + 1, Text: "bye"}, s.SendResult)
+	}
+
+	s.Stop()
+
+	select {
+	case <-s.Done():
+	default:
+		t.Fatal("Expected Done to be closed after Stop")
+	}
+
+	s.Shutdown(5 * time.Second)
+
+	if got := calls(); len(got) != 3 || !strings.HasSuffix(got[0], "/sendMessage") {
+		t.Fatalf("Expected 3 messages to be sent before shutdown, got %v", got)
+	}
+
+	if pending, err := s.Store.ListOutbox(data.OutboxPending); err != nil || len(pending) != 0 {
+		t.Errorf("Expected no pending messages, got %+v, %v", pending, err)
+	}
+}
+
+func TestShutdownTimeoutKeepsPending(t *testing.T) {
+	s, calls := startTestSender(t)
+
+	s.MakeRequestDeferred(&SendMessage{ChatID: -100, Text: "first"}, s.SendResult)
+	s.MakeRequestDeferred(&SendMessage{ChatID: -100, Text: "second"}, s.SendResult)
+	s.MakeDeferred(DeferredMessage{Request: &SendMessage{ChatID: -100, Text: "later"}, SendAt: time.Now().Add(time.Hour)}, s.SendResult)
+
+	started := time.Now()
+	s.Shutdown(100 * time.Millisecond)
+
+	if elapsed := time.Since(started); elapsed > groupChatInterval {
+		t.Errorf("Expected shutdown to stop waiting after the timeout, took %s", elapsed)
+	}
+
+	if got := calls(); len(got) != 1 {
+		t.Fatalf("Expected only the first message to be sent, got %v", got)
+	}
+
+	pending, err := s.Store.ListOutbox(data.OutboxPending)
+	if err != nil || len(pending) != 2 {
+		t.Fatalf("Expected the queued and the scheduled message to stay pending, got %+v, %v", pending, err)
+	}
+}
+
+func TestInitSenderReplaysOutbox(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		method := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if method == "getUpdates" {
+			time.Sleep(10 * time.Millisecond)
+			_, _ = w.Write([]byte(`{"ok": true, "result": []}`))
+
+			return
+		}
+
+		mu.Lock()
+		calls = append(calls, method)
+		mu.Unlock()
+
+		_, _ = w.Write([]byte(`{"ok": true, "result": {"message_id": 1, "chat": {"id": 1}}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	store := data.NewMemoryStore()
+
+	payload, err := DeferredMessage{Request: &SendMessage{ChatID: 1, Text: "pending"}}.encode()
+	if err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+
+	if _, err := store.AddOutbox(data.OutboxMessage{ChatID: 1, Payload: payload}); err != nil {
+		t.Fatalf("AddOutbox error: %v", err)
+	}
+
+	config := &conf.Config{
+		TelegramToken:        "123:token",
+		AdminLocale:          "en",
+		DefaultLocale:        "en",
+		OutboxQueueSize:      100,
+		OutboxOverflowPolicy: conf.OverflowDropOldest,
+	}
+
+	s, err := initSender(context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)), config, store, bot.WithServerURL(server.URL))
+	if err != nil {
+		t.Fatalf("initSender error: %v", err)
+	}
+
+	s.Shutdown(5 * time.Second)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if !slices.Contains(calls, "sendMessage") {
+		t.Fatalf("Expected the pending message to be sent, got %v", calls)
+	}
+
+	if pending, err := store.ListOutbox(data.OutboxPending); err != nil || len(pending) != 0 {
+		t.Errorf("Expected no pending messages, got %+v, %v", pending, err)
+	}
+}
+
+func TestShutdownHandlesQueuedUpdates(t *testing.T) {
+	s, calls := startTestSender(t)
+
+	release := make(chan struct{})
+	results := make(chan error, 1)
+
+	handle := s.queueUpdate(func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		<-release
+		results <- s.callWithRetry(ctx, &SendMessage{ChatID: update.Message.Chat.ID, Text: "handled"})
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	handle(ctx, s.Bot, &models.Update{ID: 1, Message: &models.Message{ID: 7, Chat: models.Chat{ID: -100}}})
+
+	// the bot cancels its context first on shutdown
+	cancel()
+	close(release)
+
+	s.Shutdown(5 * time.Second)
+
+	if err := <-results; err != nil {
+		t.Fatalf("Expected the queued update to be handled on shutdown, got %v", err)
+	}
+
+	if got := calls(); len(got) != 1 || !strings.HasSuffix(got[0], "/sendMessage") {
+		t.Errorf("Expected sendMessage to be called, got %v", got)
+	}
+}
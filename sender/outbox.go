@@ -0,0 +1,187 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ad/telegram-delete-join-messages/data"
+)
+
+// outboxRetention is how long sent and dropped requests are kept in the
+// outbox, outboxPruneInterval how often older ones are deleted while the bot
+// runs.
+const (
+	outboxRetention     = 24 * time.Hour
+	outboxPruneInterval = time.Hour
+)
+
+// outboxSchedule is how SendAt, DeleteAfter and After are stored next to the request.
+type outboxSchedule struct {
+	SendAt      *time.Time      `json:"send_at,omitempty"`
+	DeleteAfter int64           `json:"delete_after,omitempty"` // seconds
+	After       json.RawMessage `json:"after,omitempty"`
+}
+
+func (dm DeferredMessage) encode() (string, error) {
+	extra := map[string]any{}
+
+	if !dm.SendAt.IsZero() {
+		extra["send_at"] = dm.SendAt.UTC()
+	}
+
+	if dm.DeleteAfter > 0 {
+		extra["delete_after"] = int64(dm.DeleteAfter / time.Second)
+	}
+
+	if dm.After != nil {
+		after, err := encodeAfterSend(dm.After)
+		if err != nil {
+			return "", err
+		}
+
+		extra["after"] = after
+	}
+
+	return encodeRequest(dm.Request, extra)
+}
+
+func decodeDeferredMessage(message data.OutboxMessage) (DeferredMessage, error) {
+	request, err := decodeRequest(message.Payload)
+	if err != nil {
+		return DeferredMessage{}, err
+	}
+
+	var schedule outboxSchedule
+	if err := json.Unmarshal([]byte(message.Payload), &schedule); err != nil {
+		return DeferredMessage{}, err
+	}
+
+	dm := DeferredMessage{
+		Request:     request,
+		DeleteAfter: time.Duration(schedule.DeleteAfter) * time.Second,
+		outboxID:    message.ID,
+		attempts:    message.Attempts,
+	}
+
+	if schedule.SendAt != nil {
+		dm.SendAt = *schedule.SendAt
+	}
+
+	if len(schedule.After) > 0 {
+		if dm.After, err = decodeAfterSend(schedule.After); err != nil {
+			return DeferredMessage{}, err
+		}
+	}
+
+	return dm, nil
+}
+
+// persistOutbox stores the request as pending and returns its outbox ID.
+// A request that cannot be stored is still sent, but is lost on restart.
+func (s *Sender) persistOutbox(dm DeferredMessage) int64 {
+	payload, err := dm.encode()
+	if err != nil {
+		s.lgr.Error(fmt.Sprintf("persistOutbox encode error for %d: %s", dm.Request.Chat(), err.Error()))
+		return 0
+	}
+
+	id, err := s.Store.AddOutbox(data.OutboxMessage{ChatID: dm.Request.Chat(), Payload: payload})
+	if err != nil {
+		s.lgr.Error(fmt.Sprintf("persistOutbox AddOutbox error for %d: %s", dm.Request.Chat(), err.Error()))
+		return 0
+	}
+
+	return id
+}
+
+// enqueue puts the request into the queue of its chat without blocking,
+// dropping a request according to the overflow policy if the queue is full.
+func (s *Sender) enqueue(dm DeferredMessage) {
+	config := s.config.Load()
+
+	for _, dm := range s.dispatcher.push(dm, config.OutboxQueueSize, config.OutboxOverflowPolicy) {
+		s.lgr.Warn(fmt.Sprintf("outbox queue of %d is full, dropped %s request %d", dm.Request.Chat(), dm.Request.Method(), dm.outboxID))
+		s.updateOutbox(dm, data.OutboxDropped, "queue overflow")
+	}
+}
+
+// finishOutbox records the final result of a request: sent, or failed and
+// kept in the dead-letter list. A request stays pending until then, so it
+// is replayed if the bot stops first.
+func (s *Sender) finishOutbox(dm *DeferredMessage, err error) {
+	if err != nil {
+		s.updateOutbox(*dm, data.OutboxFailed, err.Error())
+		return
+	}
+
+	s.updateOutbox(*dm, data.OutboxSent, "")
+}
+
+func (s *Sender) updateOutbox(dm DeferredMessage, status data.OutboxStatus, lastError string) {
+	if dm.outboxID == 0 {
+		return
+	}
+
+	err := s.Store.UpdateOutbox(data.OutboxMessage{
+		ID:        dm.outboxID,
+		Status:    status,
+		Attempts:  dm.attempts,
+		LastError: lastError,
+	})
+	if err != nil {
+		s.lgr.Error(fmt.Sprintf("updateOutbox error for %d: %s", dm.outboxID, err.Error()))
+	}
+}
+
+// replayOutbox queues or schedules the requests that were still pending
+// when the bot stopped and prunes old delivered ones.
+func (s *Sender) replayOutbox() {
+	s.pruneOutbox(outboxRetention)
+
+	messages, err := s.Store.ListOutbox(data.OutboxPending)
+	if err != nil {
+		s.lgr.Error(fmt.Sprintf("replayOutbox ListOutbox error: %s", err.Error()))
+		return
+	}
+
+	for _, message := range messages {
+		dm, err := decodeDeferredMessage(message)
+		if err != nil {
+			s.lgr.Error(fmt.Sprintf("replayOutbox decode error for %d: %s", message.ID, err.Error()))
+			s.updateOutbox(DeferredMessage{outboxID: message.ID, attempts: message.Attempts}, data.OutboxFailed, err.Error())
+
+			continue
+		}
+
+		dm.callback = s.SendResult
+		s.schedule(dm)
+	}
+
+	if len(messages) > 0 {
+		s.lgr.Info(fmt.Sprintf("replayed %d pending outbox requests", len(messages)))
+	}
+}
+
+// pruneOutbox deletes sent and dropped requests older than retention.
+func (s *Sender) pruneOutbox(retention time.Duration) {
+	if _, err := s.Store.PruneOutbox(time.Now().Add(-retention)); err != nil {
+		s.lgr.Error(fmt.Sprintf("PruneOutbox error: %s", err.Error()))
+	}
+}
+
+// pruneOutboxEvery prunes the outbox every interval until ctx is done.
+func (s *Sender) pruneOutboxEvery(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.pruneOutbox(retention)
+		}
+	}
+}
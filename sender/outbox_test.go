@@ -0,0 +1,145 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	conf "github.com/ad/telegram-delete-join-messages/config"
+	"github.com/ad/telegram-delete-join-messages/data"
+)
+
+func TestOutboxOverflow(t *testing.T) {
+	tests := []struct {
+		policy    string
+		wantQueue []string
+		wantDrop  string
+	}{
+		{conf.OverflowDropOldest, []string{"2", "3"}, "1"},
+		{conf.OverflowDropNewest, []string{"1", "2"}, "3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			s := newTestSender(t, &conf.Config{OutboxQueueSize: 2, OutboxOverflowPolicy: tt.policy})
+
+			for _, text := range []string{"1", "2", "3"} {
+				s.MakeRequestDeferred(&SendMessage{ChatID: 1, Text: text}, s.SendResult)
+			}
+
+			queue := s.dispatcher.queued(1)
+			if len(queue) != len(tt.wantQueue) {
+				t.Fatalf("Expected %d queued messages, got %d", len(tt.wantQueue), len(queue))
+			}
+
+			for i, want := range tt.wantQueue {
+				if got := queue[i].Request.(*SendMessage).Text; got != want {
+					t.Errorf("Expected %q in queue, got %q", want, got)
+				}
+			}
+
+			dropped, err := s.Store.ListOutbox(data.OutboxDropped)
+			if err != nil {
+				t.Fatalf("ListOutbox error: %v", err)
+			}
+
+			if len(dropped) != 1 {
+				t.Fatalf("Expected 1 dropped message, got %+v", dropped)
+			}
+
+			if dm, err := decodeDeferredMessage(dropped[0]); err != nil || dm.Request.(*SendMessage).Text != tt.wantDrop {
+				t.Errorf("Expected %q to be dropped, got %#v, %v", tt.wantDrop, dm.Request, err)
+			}
+
+			if pending, err := s.Store.ListOutbox(data.OutboxPending); err != nil || len(pending) != 2 {
+				t.Errorf("Expected queued messages to stay pending, got %+v, %v", pending, err)
+			}
+		})
+	}
+}
+
+func TestReplayOutbox(t *testing.T) {
+	s := newTestSender(t, &conf.Config{})
+
+	sent := DeferredMessage{Request: &SendMessage{ChatID: 1, Text: "sent"}}
+	sent.outboxID = s.persistOutbox(sent)
+	s.finishOutbox(&sent, nil)
+
+	failed := DeferredMessage{Request: &SendMessage{ChatID: 1, Text: "failed"}}
+	failed.outboxID = s.persistOutbox(failed)
+	s.finishOutbox(&failed, errors.New("Forbidden"))
+
+	s.persistOutbox(DeferredMessage{Request: &SendMessage{ChatID: 1, Text: "pending"}})
+	s.persistOutbox(DeferredMessage{Request: &ForwardMessage{ChatID: 2, FromChatID: "100", MessageID: 10, ForwardTargetUserID: 100}})
+
+	if _, err := s.Store.AddOutbox(data.OutboxMessage{ChatID: 3, Payload: "not json"}); err != nil {
+		t.Fatalf("AddOutbox error: %v", err)
+	}
+
+	s.replayOutbox()
+
+	if s.dispatcher.pending(1) != 1 || s.dispatcher.pending(2) != 1 || s.dispatcher.pending(3) != 0 {
+		t.Fatalf("Expected only pending messages to be replayed, got %d, %d, %d", s.dispatcher.pending(1), s.dispatcher.pending(2), s.dispatcher.pending(3))
+	}
+
+	if dm := s.dispatcher.queued(1)[0]; dm.Request.(*SendMessage).Text != "pending" || dm.callback == nil || dm.outboxID == 0 {
+		t.Errorf("Unexpected replayed message: %+v", dm)
+	}
+
+	if forward, ok := s.dispatcher.queued(2)[0].Request.(*ForwardMessage); !ok || forward.ForwardTargetUserID != 100 || forward.MessageID != 10 {
+		t.Errorf("Unexpected replayed forward: %#v", s.dispatcher.queued(2)[0].Request)
+	}
+
+	if failed, err := s.Store.ListOutbox(data.OutboxFailed); err != nil || len(failed) != 2 {
+		t.Errorf("Expected the failed and the broken message to be failed, got %+v, %v", failed, err)
+	}
+}
+
+func TestReplayOutboxRunsAfterSend(t *testing.T) {
+	s, _ := startTestSender(t)
+
+	captcha := data.Captcha{ChatID: -100, UserID: 2, Answer: "🍎", Deadline: time.Now().Add(time.Hour).UTC().Truncate(time.Second)}
+	if err := s.Store.SaveCaptcha(captcha); err != nil {
+		t.Fatalf("SaveCaptcha error: %v", err)
+	}
+
+	// queued before a restart, its callback is gone
+	s.persistOutbox(DeferredMessage{
+		Request: &SendMessage{ChatID: -100, Text: "challenge"},
+		After:   &RememberCaptchaMessage{ChatID: -100, UserID: 2, Answer: captcha.Answer, Deadline: captcha.Deadline},
+	})
+
+	s.replayOutbox()
+	s.Shutdown(5 * time.Second)
+
+	stored, err := s.Store.GetCaptcha(-100, 2)
+	if err != nil || stored.MessageID != 1 {
+		t.Fatalf("Expected the replayed challenge to be remembered, got %+v, %v", stored, err)
+	}
+}
+
+func TestPruneOutboxEvery(t *testing.T) {
+	s := newTestSender(t, &conf.Config{})
+
+	dm := DeferredMessage{Request: &SendMessage{ChatID: 1, Text: "hello"}}
+	dm.outboxID = s.persistOutbox(dm)
+	s.updateOutbox(dm, data.OutboxSent, "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// with a negative retention the sent message is old enough right away
+	go s.pruneOutboxEvery(ctx, 10*time.Millisecond, -time.Hour)
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		sent, err := s.Store.ListOutbox(data.OutboxSent)
+		if err == nil && len(sent) == 0 {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the sent message to be pruned while running, got %+v, %v", sent, err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ad/telegram-delete-join-messages/data"
+)
+
+// keepJoinRequestPending leaves the join request pending for the
+// questionnaire, expirePendingJoinRequests declines it at the deadline.
+func (s *Sender) keepJoinRequestPending(chatID, userID int64) error {
+	request := data.PendingJoinRequest{
+		ChatID:   chatID,
+		UserID:   userID,
+		Deadline: time.Now().Add(time.Duration(s.config.Load().JoinRequestTimeout) * time.Second),
+	}
+
+	if err := s.Store.SavePendingJoinRequest(request); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// approvePendingJoinRequest approves the pending join request of a user who
+// answered the questionnaire and reports whether they are in the group now.
+func (s *Sender) approvePendingJoinRequest(ctx context.Context, chatID, userID int64) bool {
+	if _, err := s.Store.GetPendingJoinRequest(chatID, userID); err != nil {
+		if !errors.Is(err, data.ErrNotFound) {
+			s.lgr.Error(fmt.Sprintf("GetPendingJoinRequest error for %d in %d: %s", userID, chatID, err.Error()))
+		}
+
+		return false
+	}
+
+	errApprove := s.callWithRetry(ctx, &ApproveChatJoinRequest{ChatID: chatID, UserID: userID})
+	if errApprove != nil {
+		fmt.Println("errApproveChatJoinRequest (pending): ", errApprove, "for", userID)
+	}
+
+	if err := s.Store.DeletePendingJoinRequest(chatID, userID); err != nil {
+		s.lgr.Error(fmt.Sprintf("DeletePendingJoinRequest error for %d in %d: %s", userID, chatID, err.Error()))
+	}
+
+	return errApprove == nil
+}
+
+// expirePendingJoinRequests declines the join requests of users who did not
+// answer the questionnaire by the deadline. A decline that fails for good is
+// reported to the admins by callWithRetry, the request is forgotten anyway.
+func (s *Sender) expirePendingJoinRequests(ctx context.Context) {
+	requests, err := s.Store.ListExpiredPendingJoinRequests(time.Now())
+	if err != nil {
+		s.lgr.Error(fmt.Sprintf("ListExpiredPendingJoinRequests error: %s", err.Error()))
+		return
+	}
+
+	for _, request := range requests {
+		// the user may have answered or sent a new join request meanwhile
+		stored, err := s.Store.GetPendingJoinRequest(request.ChatID, request.UserID)
+		if err != nil || !stored.Deadline.Equal(request.Deadline) {
+			continue
+		}
+
+		s.lgr.Info(fmt.Sprintf("Join request of %d to %d was not answered in time", request.UserID, request.ChatID))
+
+		if err := s.callWithRetry(ctx, &DeclineChatJoinRequest{ChatID: request.ChatID, UserID: request.UserID}); err != nil {
+			s.lgr.Error(fmt.Sprintf("Error declining join request of %d to %d: %s", request.UserID, request.ChatID, err.Error()))
+		}
+
+		// shutting down, the next start declines it
+		if ctx.Err() != nil {
+			return
+		}
+
+		if s.convHandler.GetGroup(int(request.UserID)) == request.ChatID {
+			s.convHandler.End(int(request.UserID))
+		}
+
+		if err := s.Store.DeletePendingJoinRequest(request.ChatID, request.UserID); err != nil {
+			s.lgr.Error(fmt.Sprintf("DeletePendingJoinRequest error for %d in %d: %s", request.UserID, request.ChatID, err.Error()))
+		}
+	}
+}
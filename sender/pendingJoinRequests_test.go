@@ -0,0 +1,78 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	conf "github.com/ad/telegram-delete-join-messages/config"
+	"github.com/ad/telegram-delete-join-messages/data"
+)
+
+func TestPendingJoinRequest(t *testing.T) {
+	b, calls := newFakeBotAPI(t)
+
+	s := newTestSender(t, &conf.Config{JoinRequestTimeout: 3600})
+	s.Bot = b
+
+	if err := s.keepJoinRequestPending(-100, 5000000001); err != nil {
+		t.Fatalf("keepJoinRequestPending error: %v", err)
+	}
+
+	request, err := s.Store.GetPendingJoinRequest(-100, 5000000001)
+	if err != nil || time.Until(request.Deadline) < 59*time.Minute {
+		t.Fatalf("Expected the request to be pending for an hour, got %+v, %v", request, err)
+	}
+
+	if len(s.scheduler.scheduled()) != 0 {
+		t.Fatalf("Expected the deadline to be kept in the store only, got %+v", s.scheduler.scheduled())
+	}
+
+	s.expirePendingJoinRequests(context.Background())
+
+	if len(calls()) != 0 {
+		t.Fatalf("Expected the request to stay pending before the deadline, got calls %v", calls())
+	}
+
+	if !s.approvePendingJoinRequest(context.Background(), -100, 5000000001) {
+		t.Fatal("Expected the pending request to be approved")
+	}
+
+	if !slices.Equal(calls(), []string{"approveChatJoinRequest"}) {
+		t.Errorf("Expected the request to be approved, got calls %v", calls())
+	}
+
+	if s.approvePendingJoinRequest(context.Background(), -100, 5000000001) {
+		t.Error("Expected an approved request to be forgotten")
+	}
+}
+
+func TestExpirePendingJoinRequests(t *testing.T) {
+	b, calls := newFakeBotAPI(t)
+
+	s := newTestSender(t, &conf.Config{})
+	s.Bot = b
+
+	s.convHandler.SetGroup(5000000001, -100)
+	s.convHandler.SetActiveStage(1, 5000000001)
+
+	if err := s.Store.SavePendingJoinRequest(data.PendingJoinRequest{ChatID: -100, UserID: 5000000001, Deadline: time.Now().Add(-time.Second)}); err != nil {
+		t.Fatalf("SavePendingJoinRequest error: %v", err)
+	}
+
+	s.expirePendingJoinRequests(context.Background())
+
+	if !slices.Equal(calls(), []string{"declineChatJoinRequest"}) {
+		t.Errorf("Expected the request to be declined, got calls %v", calls())
+	}
+
+	if _, err := s.Store.GetPendingJoinRequest(-100, 5000000001); !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("Expected the request to be forgotten, got %v", err)
+	}
+
+	if s.convHandler.IsActive(5000000001) {
+		t.Error("Expected the questionnaire to end with the request")
+	}
+}
@@ -1,17 +1,15 @@
 package sender
 
 import (
-	"database/sql"
 	"fmt"
 	"slices"
 	"strconv"
 
-	"github.com/ad/telegram-delete-join-messages/data"
 	"github.com/go-telegram/bot/models"
 )
 
 func (s *Sender) relayVerifiedPrivateMessageToAdmins(update *models.Update) {
-	if update == nil || update.Message == nil || len(s.config.TelegramAdminIDsList) == 0 {
+	if update == nil || update.Message == nil || len(s.config.Load().TelegramAdminIDsList) == 0 {
 		return
 	}
 
@@ -20,43 +18,35 @@ func (s *Sender) relayVerifiedPrivateMessageToAdmins(update *models.Update) {
 		return
 	}
 
-	if slices.Contains(s.config.TelegramAdminIDsList, message.Chat.ID) {
+	if slices.Contains(s.config.Load().TelegramAdminIDsList, message.Chat.ID) {
 		return
 	}
 
-	vote, err := data.CheckVote(s.DB, message.Chat.ID, message.From.ID)
-	if err != nil && err != sql.ErrNoRows {
-		s.lgr.Error(fmt.Sprintf("relayVerifiedPrivateMessageToAdmins CheckVote error: %s", err.Error()))
+	userVerification, err := s.loadVerification(message.From.ID)
+	if err != nil {
+		s.lgr.Error(fmt.Sprintf("relayVerifiedPrivateMessageToAdmins loadVerification error: %s", err.Error()))
 		return
 	}
 
-	if vote == 0 {
+	if len(userVerification.votes) == 0 {
 		return
 	}
 
-	metadata := fmt.Sprintf("📨 ЛС от пользователя\n\nID: %d\n%s\n\nНа это сообщение можно ответить и пользователь получит его анонимно", message.From.ID, buildData(message.From, vote))
+	locale := s.adminLocale()
+	metadata := fmt.Sprintf("%s\n\nID: %d\n%s\n\n%s", s.t(locale, "admin.private_message"), message.From.ID, s.buildData(locale, message.From, userVerification, 0), s.t(locale, "admin.private_message_hint"))
 	fromChatID := strconv.FormatInt(message.Chat.ID, 10)
 
-	for _, adminID := range s.config.TelegramAdminIDsList {
-		adminID := adminID
-
-		s.MakeRequestDeferred(DeferredMessage{
-			Method: "sendMessage",
+	for _, adminID := range s.config.Load().TelegramAdminIDsList {
+		s.MakeRequestDeferred(&SendMessage{
 			ChatID: adminID,
 			Text:   metadata,
 		}, s.SendResult)
 
-		s.MakeRequestDeferred(DeferredMessage{
-			Method:     "forwardMessage",
-			ChatID:     adminID,
-			fromChatID: fromChatID,
-			messageID:  message.ID,
-		}, func(result SendResult) error {
-			if result.Error == nil && result.MessageID != 0 {
-				s.storeForwardTarget(adminID, result.MessageID, message.From.ID)
-			}
-
-			return s.SendResult(result)
-		})
+		s.MakeRequestDeferred(&ForwardMessage{
+			ChatID:              adminID,
+			FromChatID:          fromChatID,
+			MessageID:           message.ID,
+			ForwardTargetUserID: message.From.ID,
+		}, s.SendResult)
 	}
 }
@@ -0,0 +1,59 @@
+package sender
+
+import (
+	"testing"
+
+	conf "github.com/ad/telegram-delete-join-messages/config"
+	"github.com/go-telegram/bot/models"
+)
+
+func TestRelayVerifiedPrivateMessageToAdmins(t *testing.T) {
+	s := newTestSender(t, &conf.Config{TelegramAdminIDsList: []int64{1, 2}})
+
+	update := &models.Update{
+		Message: &models.Message{
+			ID:   10,
+			Chat: models.Chat{ID: 100, Type: "private"},
+			From: &models.User{ID: 100, FirstName: "Test"},
+			Text: "hello",
+		},
+	}
+
+	s.relayVerifiedPrivateMessageToAdmins(update)
+
+	if s.dispatcher.pending(1) != 0 || s.dispatcher.pending(2) != 0 {
+		t.Fatalf("Expected no relay for unverified user, got %d and %d messages", s.dispatcher.pending(1), s.dispatcher.pending(2))
+	}
+
+	// a legacy vote that was not assigned to an allowed chat
+	if err := s.Store.AddVote(100, 100, "1", ""); err != nil {
+		t.Fatalf("AddVote error: %v", err)
+	}
+
+	s.relayVerifiedPrivateMessageToAdmins(update)
+
+	if s.dispatcher.pending(1) != 0 || s.dispatcher.pending(2) != 0 {
+		t.Fatalf("Expected no relay for a legacy vote, got %d and %d messages", s.dispatcher.pending(1), s.dispatcher.pending(2))
+	}
+
+	if err := s.Store.AddVote(100, -100, "1", ""); err != nil {
+		t.Fatalf("AddVote error: %v", err)
+	}
+
+	s.relayVerifiedPrivateMessageToAdmins(update)
+
+	for _, adminID := range []int64{1, 2} {
+		queue := s.dispatcher.queued(adminID)
+		if len(queue) != 2 {
+			t.Fatalf("Expected 2 deferred messages for admin %d, got %d", adminID, len(queue))
+		}
+
+		if _, ok := queue[0].Request.(*SendMessage); !ok {
+			t.Errorf("Expected sendMessage first, got %s", queue[0].Request.Method())
+		}
+
+		if forward, ok := queue[1].Request.(*ForwardMessage); !ok || forward.MessageID != 10 || forward.ForwardTargetUserID != 100 {
+			t.Errorf("Expected forward of message 10 from user 100, got %#v", queue[1].Request)
+		}
+	}
+}
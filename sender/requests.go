@@ -0,0 +1,561 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Request is a Bot API call made through the deferred queue. Requests are
+// stored in the outbox as JSON, so files are referenced by file_id or URL
+// and are never uploaded from memory.
+type Request interface {
+	// Method is the Bot API method, it identifies the request in the outbox.
+	Method() string
+	// Chat is the chat the request is queued and rate limited for.
+	Chat() int64
+
+	// do makes the call and reports its result.
+	do(ctx context.Context, s *Sender) SendResult
+}
+
+// requestTypes creates an empty request for each stored method.
+var requestTypes = map[string]func() Request{
+	"sendMessage": func() Request { return &SendMessage{} },
+	// stored by older versions, sendMessage with HTML and no link preview
+	"sendMessageHTML":        func() Request { return &SendMessage{ParseMode: models.ParseModeHTML, DisableLinkPreview: true} },
+	"copyMessage":            func() Request { return &CopyMessage{} },
+	"forwardMessage":         func() Request { return &ForwardMessage{} },
+	"sendPhoto":              func() Request { return &SendPhoto{} },
+	"sendDocument":           func() Request { return &SendDocument{} },
+	"sendMediaGroup":         func() Request { return &SendMediaGroup{} },
+	"editMessageText":        func() Request { return &EditMessageText{} },
+	"editMessageReplyMarkup": func() Request { return &EditMessageReplyMarkup{} },
+	"deleteMessage":          func() Request { return &DeleteMessage{} },
+	"deleteMessages":         func() Request { return &DeleteMessages{} },
+	"pinChatMessage":         func() Request { return &PinChatMessage{} },
+	"answerCallbackQuery":    func() Request { return &AnswerCallbackQuery{} },
+	"restrictChatMember":     func() Request { return &RestrictChatMember{} },
+	"banChatMember":          func() Request { return &BanChatMember{} },
+	"unbanChatMember":        func() Request { return &UnbanChatMember{} },
+	"approveChatJoinRequest": func() Request { return &ApproveChatJoinRequest{} },
+	"declineChatJoinRequest": func() Request { return &DeclineChatJoinRequest{} },
+}
+
+// encodeRequest stores the request as its JSON with the method and the
+// extra fields added.
+func encodeRequest(request Request, extra map[string]any) (string, error) {
+	encoded, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return "", err
+	}
+
+	for key, value := range extra {
+		if fields[key], err = json.Marshal(value); err != nil {
+			return "", err
+		}
+	}
+
+	fields["method"], _ = json.Marshal(request.Method())
+
+	encoded, err = json.Marshal(fields)
+
+	return string(encoded), err
+}
+
+func decodeRequest(payload string) (Request, error) {
+	var header struct {
+		Method string `json:"method"`
+	}
+
+	if err := json.Unmarshal([]byte(payload), &header); err != nil {
+		return nil, err
+	}
+
+	newRequest, ok := requestTypes[header.Method]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", errUnknownMethod, header.Method)
+	}
+
+	request := newRequest()
+	if err := json.Unmarshal([]byte(payload), request); err != nil {
+		return nil, err
+	}
+
+	return request, nil
+}
+
+func replyParameters(messageID int) *models.ReplyParameters {
+	if messageID == 0 {
+		return nil
+	}
+
+	return &models.ReplyParameters{MessageID: messageID}
+}
+
+func messageResult(result SendResult, message *models.Message, err error) SendResult {
+	if message != nil {
+		result.MessageID = int64(message.ID)
+	}
+
+	result.Error = err
+
+	return result
+}
+
+type SendMessage struct {
+	ChatID             int64              `json:"chat_id"`
+	Text               string             `json:"text"`
+	ParseMode          models.ParseMode   `json:"parse_mode,omitempty"`
+	DisableLinkPreview bool               `json:"disable_link_preview,omitempty"`
+	MessageThreadID    int                `json:"message_thread_id,omitempty"`
+	ReplyToMessageID   int                `json:"reply_to_message_id,omitempty"`
+	ReplyMarkup        models.ReplyMarkup `json:"reply_markup,omitempty"`
+}
+
+func (r *SendMessage) Method() string { return "sendMessage" }
+func (r *SendMessage) Chat() int64    { return r.ChatID }
+
+func (r *SendMessage) do(ctx context.Context, s *Sender) SendResult {
+	params := &bot.SendMessageParams{
+		ChatID:          r.ChatID,
+		Text:            r.Text,
+		ParseMode:       r.ParseMode,
+		MessageThreadID: r.MessageThreadID,
+		ReplyParameters: replyParameters(r.ReplyToMessageID),
+		ReplyMarkup:     r.ReplyMarkup,
+	}
+
+	if r.DisableLinkPreview {
+		params.LinkPreviewOptions = &models.LinkPreviewOptions{IsDisabled: bot.True()}
+	}
+
+	message, err := s.Bot.SendMessage(ctx, params)
+
+	return messageResult(SendResult{ChatID: r.ChatID, Msg: r.Text}, message, err)
+}
+
+type CopyMessage struct {
+	ChatID           int64  `json:"chat_id"`
+	FromChatID       string `json:"from_chat_id"`
+	MessageID        int    `json:"message_id"`
+	MessageThreadID  int    `json:"message_thread_id,omitempty"`
+	ReplyToMessageID int    `json:"reply_to_message_id,omitempty"`
+}
+
+func (r *CopyMessage) Method() string { return "copyMessage" }
+func (r *CopyMessage) Chat() int64    { return r.ChatID }
+
+func (r *CopyMessage) do(ctx context.Context, s *Sender) SendResult {
+	result := SendResult{ChatID: r.ChatID}
+
+	messageID, err := s.Bot.CopyMessage(ctx, &bot.CopyMessageParams{
+		ChatID:          r.ChatID,
+		FromChatID:      r.FromChatID,
+		MessageID:       r.MessageID,
+		MessageThreadID: r.MessageThreadID,
+		ReplyParameters: replyParameters(r.ReplyToMessageID),
+	})
+
+	if messageID != nil {
+		result.MessageID = int64(messageID.ID)
+	}
+
+	result.Error = err
+
+	return result
+}
+
+// ForwardMessage forwards a message to an admin. If ForwardTargetUserID is
+// set, the admin can reply to the forwarded message to answer that user.
+type ForwardMessage struct {
+	ChatID              int64  `json:"chat_id"`
+	FromChatID          string `json:"from_chat_id"`
+	MessageID           int    `json:"message_id"`
+	ForwardTargetUserID int64  `json:"forward_target_user_id,omitempty"`
+}
+
+func (r *ForwardMessage) Method() string { return "forwardMessage" }
+func (r *ForwardMessage) Chat() int64    { return r.ChatID }
+
+func (r *ForwardMessage) do(ctx context.Context, s *Sender) SendResult {
+	result := SendResult{ChatID: r.ChatID}
+
+	message, err := s.Bot.ForwardMessage(ctx, &bot.ForwardMessageParams{
+		ChatID:     r.ChatID,
+		FromChatID: r.FromChatID,
+		MessageID:  r.MessageID,
+	})
+
+	if message != nil {
+		if origin := message.ForwardOrigin; origin != nil {
+			if origin.MessageOriginHiddenUser != nil {
+				result.ForwardDate = origin.MessageOriginHiddenUser.Date
+			} else if origin.MessageOriginUser != nil {
+				result.ForwardDate = origin.MessageOriginUser.Date
+			}
+		}
+
+		result.MessageID = int64(message.ID)
+		result.Msg = message.Text
+	}
+
+	result.Error = err
+
+	if err == nil && result.MessageID != 0 && r.ForwardTargetUserID != 0 {
+		s.storeForwardTarget(r.ChatID, result.MessageID, r.ForwardTargetUserID)
+	}
+
+	return result
+}
+
+// SendPhoto sends a photo by file_id or URL.
+type SendPhoto struct {
+	ChatID          int64              `json:"chat_id"`
+	Photo           string             `json:"photo"`
+	Caption         string             `json:"caption,omitempty"`
+	ParseMode       models.ParseMode   `json:"parse_mode,omitempty"`
+	MessageThreadID int                `json:"message_thread_id,omitempty"`
+	ReplyMarkup     models.ReplyMarkup `json:"reply_markup,omitempty"`
+}
+
+func (r *SendPhoto) Method() string { return "sendPhoto" }
+func (r *SendPhoto) Chat() int64    { return r.ChatID }
+
+func (r *SendPhoto) do(ctx context.Context, s *Sender) SendResult {
+	message, err := s.Bot.SendPhoto(ctx, &bot.SendPhotoParams{
+		ChatID:          r.ChatID,
+		Photo:           &models.InputFileString{Data: r.Photo},
+		Caption:         r.Caption,
+		ParseMode:       r.ParseMode,
+		MessageThreadID: r.MessageThreadID,
+		ReplyMarkup:     r.ReplyMarkup,
+	})
+
+	return messageResult(SendResult{ChatID: r.ChatID, Msg: r.Caption}, message, err)
+}
+
+// SendDocument sends a document by file_id or URL.
+type SendDocument struct {
+	ChatID          int64              `json:"chat_id"`
+	Document        string             `json:"document"`
+	Caption         string             `json:"caption,omitempty"`
+	ParseMode       models.ParseMode   `json:"parse_mode,omitempty"`
+	MessageThreadID int                `json:"message_thread_id,omitempty"`
+	ReplyMarkup     models.ReplyMarkup `json:"reply_markup,omitempty"`
+}
+
+func (r *SendDocument) Method() string { return "sendDocument" }
+func (r *SendDocument) Chat() int64    { return r.ChatID }
+
+func (r *SendDocument) do(ctx context.Context, s *Sender) SendResult {
+	message, err := s.Bot.SendDocument(ctx, &bot.SendDocumentParams{
+		ChatID:          r.ChatID,
+		Document:        &models.InputFileString{Data: r.Document},
+		Caption:         r.Caption,
+		ParseMode:       r.ParseMode,
+		MessageThreadID: r.MessageThreadID,
+		ReplyMarkup:     r.ReplyMarkup,
+	})
+
+	return messageResult(SendResult{ChatID: r.ChatID, Msg: r.Caption}, message, err)
+}
+
+// MediaItem is an item of a media group: a photo, video, audio or document
+// given by file_id or URL.
+type MediaItem struct {
+	Type      string           `json:"type"`
+	Media     string           `json:"media"`
+	Caption   string           `json:"caption,omitempty"`
+	ParseMode models.ParseMode `json:"parse_mode,omitempty"`
+}
+
+func (item MediaItem) inputMedia() (models.InputMedia, error) {
+	switch item.Type {
+	case "photo":
+		return &models.InputMediaPhoto{Media: item.Media, Caption: item.Caption, ParseMode: item.ParseMode}, nil
+	case "video":
+		return &models.InputMediaVideo{Media: item.Media, Caption: item.Caption, ParseMode: item.ParseMode}, nil
+	case "audio":
+		return &models.InputMediaAudio{Media: item.Media, Caption: item.Caption, ParseMode: item.ParseMode}, nil
+	case "document":
+		return &models.InputMediaDocument{Media: item.Media, Caption: item.Caption, ParseMode: item.ParseMode}, nil
+	default:
+		return nil, fmt.Errorf("%w: media type %q", bot.ErrorBadRequest, item.Type)
+	}
+}
+
+type SendMediaGroup struct {
+	ChatID          int64       `json:"chat_id"`
+	Media           []MediaItem `json:"media"`
+	MessageThreadID int         `json:"message_thread_id,omitempty"`
+}
+
+func (r *SendMediaGroup) Method() string { return "sendMediaGroup" }
+func (r *SendMediaGroup) Chat() int64    { return r.ChatID }
+
+// do reports the IDs of all sent messages, MessageID is the first of them.
+func (r *SendMediaGroup) do(ctx context.Context, s *Sender) SendResult {
+	result := SendResult{ChatID: r.ChatID}
+
+	media := make([]models.InputMedia, 0, len(r.Media))
+	for _, item := range r.Media {
+		inputMedia, err := item.inputMedia()
+		if err != nil {
+			result.Error = err
+			return result
+		}
+
+		media = append(media, inputMedia)
+	}
+
+	messages, err := s.Bot.SendMediaGroup(ctx, &bot.SendMediaGroupParams{
+		ChatID:          r.ChatID,
+		Media:           media,
+		MessageThreadID: r.MessageThreadID,
+	})
+
+	for _, message := range messages {
+		result.MessageIDs = append(result.MessageIDs, int64(message.ID))
+	}
+
+	if len(result.MessageIDs) > 0 {
+		result.MessageID = result.MessageIDs[0]
+	}
+
+	result.Error = err
+
+	return result
+}
+
+type EditMessageText struct {
+	ChatID      int64              `json:"chat_id"`
+	MessageID   int                `json:"message_id"`
+	Text        string             `json:"text"`
+	ParseMode   models.ParseMode   `json:"parse_mode,omitempty"`
+	ReplyMarkup models.ReplyMarkup `json:"reply_markup,omitempty"`
+}
+
+func (r *EditMessageText) Method() string { return "editMessageText" }
+func (r *EditMessageText) Chat() int64    { return r.ChatID }
+
+func (r *EditMessageText) do(ctx context.Context, s *Sender) SendResult {
+	message, err := s.Bot.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      r.ChatID,
+		MessageID:   r.MessageID,
+		Text:        r.Text,
+		ParseMode:   r.ParseMode,
+		ReplyMarkup: r.ReplyMarkup,
+	})
+
+	return messageResult(SendResult{ChatID: r.ChatID, Msg: r.Text}, message, err)
+}
+
+type EditMessageReplyMarkup struct {
+	ChatID      int64              `json:"chat_id"`
+	MessageID   int                `json:"message_id"`
+	ReplyMarkup models.ReplyMarkup `json:"reply_markup,omitempty"`
+}
+
+func (r *EditMessageReplyMarkup) Method() string { return "editMessageReplyMarkup" }
+func (r *EditMessageReplyMarkup) Chat() int64    { return r.ChatID }
+
+func (r *EditMessageReplyMarkup) do(ctx context.Context, s *Sender) SendResult {
+	message, err := s.Bot.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
+		ChatID:      r.ChatID,
+		MessageID:   r.MessageID,
+		ReplyMarkup: r.ReplyMarkup,
+	})
+
+	return messageResult(SendResult{ChatID: r.ChatID}, message, err)
+}
+
+type DeleteMessage struct {
+	ChatID    int64 `json:"chat_id"`
+	MessageID int   `json:"message_id"`
+}
+
+func (r *DeleteMessage) Method() string { return "deleteMessage" }
+func (r *DeleteMessage) Chat() int64    { return r.ChatID }
+
+func (r *DeleteMessage) do(ctx context.Context, s *Sender) SendResult {
+	_, err := s.Bot.DeleteMessage(ctx, &bot.DeleteMessageParams{
+		ChatID:    r.ChatID,
+		MessageID: r.MessageID,
+	})
+
+	return SendResult{ChatID: r.ChatID, MessageID: int64(r.MessageID), Error: err}
+}
+
+type DeleteMessages struct {
+	ChatID     int64 `json:"chat_id"`
+	MessageIDs []int `json:"message_ids"`
+}
+
+func (r *DeleteMessages) Method() string { return "deleteMessages" }
+func (r *DeleteMessages) Chat() int64    { return r.ChatID }
+
+func (r *DeleteMessages) do(ctx context.Context, s *Sender) SendResult {
+	result := SendResult{ChatID: r.ChatID}
+
+	for _, messageID := range r.MessageIDs {
+		result.MessageIDs = append(result.MessageIDs, int64(messageID))
+	}
+
+	_, result.Error = s.Bot.DeleteMessages(ctx, &bot.DeleteMessagesParams{
+		ChatID:     r.ChatID,
+		MessageIDs: r.MessageIDs,
+	})
+
+	return result
+}
+
+type PinChatMessage struct {
+	ChatID              int64 `json:"chat_id"`
+	MessageID           int   `json:"message_id"`
+	DisableNotification bool  `json:"disable_notification,omitempty"`
+}
+
+func (r *PinChatMessage) Method() string { return "pinChatMessage" }
+func (r *PinChatMessage) Chat() int64    { return r.ChatID }
+
+func (r *PinChatMessage) do(ctx context.Context, s *Sender) SendResult {
+	_, err := s.Bot.PinChatMessage(ctx, &bot.PinChatMessageParams{
+		ChatID:              r.ChatID,
+		MessageID:           r.MessageID,
+		DisableNotification: r.DisableNotification,
+	})
+
+	return SendResult{ChatID: r.ChatID, MessageID: int64(r.MessageID), Error: err}
+}
+
+// AnswerCallbackQuery answers a button press. It is queued for the user
+// who pressed the button.
+type AnswerCallbackQuery struct {
+	UserID          int64  `json:"user_id"`
+	CallbackQueryID string `json:"callback_query_id"`
+	Text            string `json:"text,omitempty"`
+	ShowAlert       bool   `json:"show_alert,omitempty"`
+}
+
+func (r *AnswerCallbackQuery) Method() string { return "answerCallbackQuery" }
+func (r *AnswerCallbackQuery) Chat() int64    { return r.UserID }
+
+func (r *AnswerCallbackQuery) do(ctx context.Context, s *Sender) SendResult {
+	_, err := s.Bot.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: r.CallbackQueryID,
+		Text:            r.Text,
+		ShowAlert:       r.ShowAlert,
+	})
+
+	return SendResult{ChatID: r.UserID, Msg: r.Text, Error: err}
+}
+
+type RestrictChatMember struct {
+	ChatID      int64                   `json:"chat_id"`
+	UserID      int64                   `json:"user_id"`
+	Permissions *models.ChatPermissions `json:"permissions,omitempty"`
+	UntilDate   int                     `json:"until_date,omitempty"`
+}
+
+func (r *RestrictChatMember) Method() string { return "restrictChatMember" }
+func (r *RestrictChatMember) Chat() int64    { return r.ChatID }
+func (r *RestrictChatMember) Member() int64  { return r.UserID }
+
+func (r *RestrictChatMember) do(ctx context.Context, s *Sender) SendResult {
+	_, err := s.Bot.RestrictChatMember(ctx, &bot.RestrictChatMemberParams{
+		ChatID:      r.ChatID,
+		UserID:      r.UserID,
+		Permissions: r.Permissions,
+		UntilDate:   r.UntilDate,
+	})
+
+	return SendResult{ChatID: r.ChatID, Error: err}
+}
+
+type BanChatMember struct {
+	ChatID    int64 `json:"chat_id"`
+	UserID    int64 `json:"user_id"`
+	UntilDate int   `json:"until_date,omitempty"`
+}
+
+func (r *BanChatMember) Method() string { return "banChatMember" }
+func (r *BanChatMember) Chat() int64    { return r.ChatID }
+func (r *BanChatMember) Member() int64  { return r.UserID }
+
+func (r *BanChatMember) do(ctx context.Context, s *Sender) SendResult {
+	_, err := s.Bot.BanChatMember(ctx, &bot.BanChatMemberParams{
+		ChatID:    r.ChatID,
+		UserID:    r.UserID,
+		UntilDate: r.UntilDate,
+	})
+
+	return SendResult{ChatID: r.ChatID, Error: err}
+}
+
+type UnbanChatMember struct {
+	ChatID       int64 `json:"chat_id"`
+	UserID       int64 `json:"user_id"`
+	OnlyIfBanned bool  `json:"only_if_banned,omitempty"`
+}
+
+func (r *UnbanChatMember) Method() string { return "unbanChatMember" }
+func (r *UnbanChatMember) Chat() int64    { return r.ChatID }
+func (r *UnbanChatMember) Member() int64  { return r.UserID }
+
+func (r *UnbanChatMember) do(ctx context.Context, s *Sender) SendResult {
+	_, err := s.Bot.UnbanChatMember(ctx, &bot.UnbanChatMemberParams{
+		ChatID:       r.ChatID,
+		UserID:       r.UserID,
+		OnlyIfBanned: r.OnlyIfBanned,
+	})
+
+	return SendResult{ChatID: r.ChatID, Error: err}
+}
+
+type ApproveChatJoinRequest struct {
+	ChatID int64 `json:"chat_id"`
+	UserID int64 `json:"user_id"`
+}
+
+func (r *ApproveChatJoinRequest) Method() string { return "approveChatJoinRequest" }
+func (r *ApproveChatJoinRequest) Chat() int64    { return r.ChatID }
+func (r *ApproveChatJoinRequest) Member() int64  { return r.UserID }
+
+func (r *ApproveChatJoinRequest) do(ctx context.Context, s *Sender) SendResult {
+	_, err := s.Bot.ApproveChatJoinRequest(ctx, &bot.ApproveChatJoinRequestParams{
+		ChatID: r.ChatID,
+		UserID: r.UserID,
+	})
+	if err == nil {
+		s.rememberApprovedJoin(r.ChatID, r.UserID)
+	}
+
+	return SendResult{ChatID: r.ChatID, Error: err}
+}
+
+type DeclineChatJoinRequest struct {
+	ChatID int64 `json:"chat_id"`
+	UserID int64 `json:"user_id"`
+}
+
+func (r *DeclineChatJoinRequest) Method() string { return "declineChatJoinRequest" }
+func (r *DeclineChatJoinRequest) Chat() int64    { return r.ChatID }
+func (r *DeclineChatJoinRequest) Member() int64  { return r.UserID }
+
+func (r *DeclineChatJoinRequest) do(ctx context.Context, s *Sender) SendResult {
+	_, err := s.Bot.DeclineChatJoinRequest(ctx, &bot.DeclineChatJoinRequestParams{
+		ChatID: r.ChatID,
+		UserID: r.UserID,
+	})
+
+	return SendResult{ChatID: r.ChatID, Error: err}
+}
@@ -0,0 +1,115 @@
+package sender
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+)
+
+func TestRequestRoundTrip(t *testing.T) {
+	requests := []Request{
+		&SendMessage{ChatID: 1, Text: "hello", ParseMode: models.ParseModeHTML, DisableLinkPreview: true, MessageThreadID: 3, ReplyToMessageID: 4},
+		&CopyMessage{ChatID: 1, FromChatID: "100", MessageID: 10, MessageThreadID: 3, ReplyToMessageID: 4},
+		&ForwardMessage{ChatID: 1, FromChatID: "100", MessageID: 10, ForwardTargetUserID: 100},
+		&SendPhoto{ChatID: 1, Photo: "AgACAgIAAx", Caption: "welcome", ParseMode: models.ParseModeHTML},
+		&SendDocument{ChatID: 1, Document: "https://example.com/rules.pdf", Caption: "rules"},
+		&SendMediaGroup{ChatID: -100, Media: []MediaItem{{Type: "photo", Media: "a", Caption: "first"}, {Type: "document", Media: "b"}}},
+		&EditMessageText{ChatID: 1, MessageID: 10, Text: "updated"},
+		&EditMessageReplyMarkup{ChatID: 1, MessageID: 10},
+		&DeleteMessage{ChatID: -100, MessageID: 10},
+		&DeleteMessages{ChatID: -100, MessageIDs: []int{10, 11}},
+		&PinChatMessage{ChatID: -100, MessageID: 10, DisableNotification: true},
+		&AnswerCallbackQuery{UserID: 100, CallbackQueryID: "query", Text: "done", ShowAlert: true},
+		&RestrictChatMember{ChatID: -100, UserID: 100, Permissions: &models.ChatPermissions{CanSendMessages: true}, UntilDate: 1700000000},
+		&ApproveChatJoinRequest{ChatID: -100, UserID: 100},
+		&DeclineChatJoinRequest{ChatID: -100, UserID: 100},
+	}
+
+	for _, request := range requests {
+		t.Run(request.Method(), func(t *testing.T) {
+			if _, ok := requestTypes[request.Method()]; !ok {
+				t.Fatalf("%s is not registered in requestTypes", request.Method())
+			}
+
+			payload, err := encodeRequest(request, nil)
+			if err != nil {
+				t.Fatalf("encode error: %v", err)
+			}
+
+			decoded, err := decodeRequest(payload)
+			if err != nil {
+				t.Fatalf("decode error: %v", err)
+			}
+
+			if !reflect.DeepEqual(decoded, request) {
+				t.Fatalf("Expected %#v, got %#v", request, decoded)
+			}
+		})
+	}
+}
+
+func TestRequestReplyMarkupRoundTrip(t *testing.T) {
+	request := &SendMessage{
+		ChatID:      1,
+		Text:        "choose",
+		ReplyMarkup: &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{{{Text: "OK", CallbackData: "ok"}}}},
+	}
+
+	payload, err := encodeRequest(request, nil)
+	if err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+
+	decoded, err := decodeRequest(payload)
+	if err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+
+	encoded, err := json.Marshal(decoded.(*SendMessage).ReplyMarkup)
+	if err != nil {
+		t.Fatalf("marshal reply markup error: %v", err)
+	}
+
+	var markup models.InlineKeyboardMarkup
+	if err := json.Unmarshal(encoded, &markup); err != nil || !reflect.DeepEqual(&markup, request.ReplyMarkup) {
+		t.Fatalf("Unexpected reply markup: %s, %v", encoded, err)
+	}
+}
+
+func TestDecodeLegacyRequests(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    Request
+	}{
+		{
+			`{"method":"sendMessageHTML","chat_id":1,"text":"<b>hi</b>"}`,
+			&SendMessage{ChatID: 1, Text: "<b>hi</b>", ParseMode: models.ParseModeHTML, DisableLinkPreview: true},
+		},
+		{
+			`{"method":"forwardMessage","chat_id":1,"from_chat_id":"100","message_id":10,"forward_target_user_id":100}`,
+			&ForwardMessage{ChatID: 1, FromChatID: "100", MessageID: 10, ForwardTargetUserID: 100},
+		},
+		{
+			`{"method":"restrictChatMember","chat_id":-100,"user_id":100,"permissions":{},"until_date":1700000000}`,
+			&RestrictChatMember{ChatID: -100, UserID: 100, Permissions: &models.ChatPermissions{}, UntilDate: 1700000000},
+		},
+	}
+
+	for _, tt := range tests {
+		decoded, err := decodeRequest(tt.payload)
+		if err != nil {
+			t.Fatalf("decode %s error: %v", tt.payload, err)
+		}
+
+		if !reflect.DeepEqual(decoded, tt.want) {
+			t.Errorf("Expected %#v, got %#v", tt.want, decoded)
+		}
+	}
+
+	if _, err := decodeRequest(`{"method":"sendPigeon","chat_id":1}`); !errors.Is(err, errUnknownMethod) {
+		t.Errorf("Expected unknown method error, got %v", err)
+	}
+}
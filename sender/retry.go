@@ -0,0 +1,160 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ad/telegram-delete-join-messages/data"
+	"github.com/go-telegram/bot"
+)
+
+// Retry policy of failed Bot API calls: up to retryAttempts attempts with
+// exponential backoff starting at retryBaseDelay, capped at retryMaxDelay.
+const (
+	retryAttempts  = 5
+	retryBaseDelay = time.Second
+	retryMaxDelay  = time.Minute
+)
+
+// directRetryWait bounds how long callWithRetry waits between attempts in
+// total. Direct calls are made by update handlers, which hold a worker of
+// their chat meanwhile, so during an outage a call gives up after about this
+// long instead of after the full backoff.
+const directRetryWait = 10 * time.Second
+
+// moderationRequest is a request that acts on a member according to their
+// state when it is made: a restriction until a moment, a decision on a
+// pending join request, a ban of a kick. Replayed later it could undo a
+// newer decision or turn a kick into a ban, so a failed one is reported to
+// the admins instead of going to the dead-letter list.
+type moderationRequest interface {
+	Request
+
+	// Member is the user the request acts on.
+	Member() int64
+}
+
+// isRetryable reports whether a failed Bot API call may succeed later:
+// network errors, 5xx and 429 are retryable, while errors like a user who
+// blocked the bot (403) or a message that is gone (400) are permanent.
+func isRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if bot.IsMigrateError(err) {
+		return false
+	}
+
+	for _, permanent := range []error{
+		bot.ErrorForbidden,
+		bot.ErrorBadRequest,
+		bot.ErrorUnauthorized,
+		bot.ErrorNotFound,
+		bot.ErrorConflict,
+		errUnknownMethod,
+	} {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// retryDelay is how long to wait before the next attempt after attempt
+// failed attempts. Telegram tells how long to wait on 429.
+func retryDelay(err error, attempt int) time.Duration {
+	var tooManyRequests *bot.TooManyRequestsError
+	if errors.As(err, &tooManyRequests) && tooManyRequests.RetryAfter > 0 {
+		return time.Duration(tooManyRequests.RetryAfter) * time.Second
+	}
+
+	delay := retryBaseDelay
+	for i := 1; i < attempt && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, retryMaxDelay)
+}
+
+// retryError asks the dispatcher to send the request again after a delay.
+type retryError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryError) Error() string {
+	return fmt.Sprintf("%s, retry in %s", e.err.Error(), e.after)
+}
+
+func (e *retryError) Unwrap() error {
+	return e.err
+}
+
+// callWithRetry makes the call right away for a handler, retrying retryable
+// errors with backoff for up to directRetryWait. A call that still fails goes
+// to the dead-letter list, or is reported to the admins if it is a
+// moderationRequest.
+func (s *Sender) callWithRetry(ctx context.Context, request Request) error {
+	dm := DeferredMessage{Request: request}
+
+	var waited time.Duration
+
+	for {
+		err := s.call(ctx, request).Error
+		dm.attempts++
+
+		if err == nil {
+			return nil
+		}
+
+		delay := retryDelay(err, dm.attempts)
+
+		if !isRetryable(err) || dm.attempts >= retryAttempts || waited+delay > directRetryWait {
+			s.giveUp(dm, err)
+			return err
+		}
+
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			s.giveUp(dm, err)
+
+			return err
+		case <-timer.C:
+			waited += delay
+		}
+	}
+}
+
+// giveUp handles a direct call that failed for good.
+func (s *Sender) giveUp(dm DeferredMessage, err error) {
+	moderation, ok := dm.Request.(moderationRequest)
+	if !ok {
+		s.deadLetter(dm, err)
+		return
+	}
+
+	s.lgr.Error(fmt.Sprintf("%s of %d in %d failed after %d attempts: %s", moderation.Method(), moderation.Member(), moderation.Chat(), dm.attempts, err.Error()))
+
+	for _, adminID := range s.config.Load().TelegramAdminIDsList {
+		s.MakeRequestDeferred(&SendMessage{
+			ChatID: adminID,
+			Text:   s.t(s.adminLocale(), "admin.moderation_failed", moderation.Method(), moderation.Member(), moderation.Chat(), err.Error()),
+		}, s.SendResult)
+	}
+}
+
+// deadLetter stores a failed direct call as a failed outbox request, so it
+// is listed and can be retried with /failed like a failed message.
+func (s *Sender) deadLetter(dm DeferredMessage, err error) {
+	s.lgr.Error(fmt.Sprintf("%s for %d failed after %d attempts: %s", dm.Request.Method(), dm.Request.Chat(), dm.attempts, err.Error()))
+
+	dm.outboxID = s.persistOutbox(dm)
+	s.updateOutbox(dm, data.OutboxFailed, err.Error())
+}
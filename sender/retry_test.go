@@ -0,0 +1,176 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	conf "github.com/ad/telegram-delete-join-messages/config"
+	"github.com/ad/telegram-delete-join-messages/data"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"network", errors.New("error do request for method sendMessage, dial tcp: i/o timeout"), true},
+		{"server error", errors.New("error response from telegram for method sendMessage, 502 Bad Gateway"), true},
+		{"too many requests", &bot.TooManyRequestsError{Message: "too many requests", RetryAfter: 3}, true},
+		{"blocked", fmt.Errorf("%w, Forbidden: bot was blocked by the user", bot.ErrorForbidden), false},
+		{"not found", fmt.Errorf("%w, Bad Request: message to delete not found", bot.ErrorBadRequest), false},
+		{"migrated", &bot.MigrateError{Message: "bad request", MigrateToChatID: -100}, false},
+		{"unknown method", fmt.Errorf("%w %q", errUnknownMethod, "sendPigeon"), false},
+		{"canceled", context.Canceled, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err); got != tt.want {
+				t.Errorf("isRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	network := errors.New("timeout")
+
+	for attempt, want := range map[int]time.Duration{
+		1:  time.Second,
+		2:  2 * time.Second,
+		3:  4 * time.Second,
+		10: retryMaxDelay,
+	} {
+		if got := retryDelay(network, attempt); got != want {
+			t.Errorf("retryDelay after %d attempts = %s, want %s", attempt, got, want)
+		}
+	}
+
+	if got := retryDelay(&bot.TooManyRequestsError{RetryAfter: 7}, 1); got != 7*time.Second {
+		t.Errorf("Expected retry_after to be used, got %s", got)
+	}
+}
+
+func TestDeadLetterAndRetryFailed(t *testing.T) {
+	s := newTestSender(t, &conf.Config{})
+
+	s.deadLetter(DeferredMessage{
+		Request:  &DeleteMessage{ChatID: -100, MessageID: 7},
+		attempts: retryAttempts,
+	}, errors.New("error response from telegram for method deleteMessage, 502 Bad Gateway"))
+
+	failed, err := s.Store.ListOutbox(data.OutboxFailed)
+	if err != nil || len(failed) != 1 || failed[0].Attempts != retryAttempts {
+		t.Fatalf("Expected the call in the dead-letter list, got %+v, %v", failed, err)
+	}
+
+	if list := s.failedList("en"); !strings.Contains(list, "deleteMessage → -100") {
+		t.Errorf("Expected the call to be listed, got %q", list)
+	}
+
+	if count, err := s.retryFailed(failed[0].ID + 1); err != nil || count != 0 {
+		t.Fatalf("Expected no retry of an unknown ID, got %d, %v", count, err)
+	}
+
+	if count, err := s.retryFailed(0); err != nil || count != 1 {
+		t.Fatalf("Expected 1 retried call, got %d, %v", count, err)
+	}
+
+	queue := s.dispatcher.queued(-100)
+	if len(queue) != 1 {
+		t.Fatalf("Expected the call to be queued, got %d", len(queue))
+	}
+
+	if deleteMessage, ok := queue[0].Request.(*DeleteMessage); !ok || deleteMessage.MessageID != 7 {
+		t.Errorf("Unexpected retried call: %#v", queue[0].Request)
+	}
+
+	if queue[0].attempts != 0 || queue[0].callback == nil {
+		t.Errorf("Expected the retried call to start over, got %+v", queue[0])
+	}
+
+	if pending, err := s.Store.ListOutbox(data.OutboxPending); err != nil || len(pending) != 1 {
+		t.Errorf("Expected the retried call to be pending, got %+v, %v", pending, err)
+	}
+
+	if list := s.failedList("en"); list != s.t("en", "admin.failed_empty") {
+		t.Errorf("Expected no failed requests left, got %q", list)
+	}
+}
+
+func TestRetryFailedDropsModeration(t *testing.T) {
+	s := newTestSender(t, &conf.Config{})
+
+	// a restriction that ended long ago must not become a permanent one
+	s.deadLetter(DeferredMessage{
+		Request: &RestrictChatMember{
+			ChatID:      -100,
+			UserID:      100,
+			Permissions: &models.ChatPermissions{CanSendMessages: false},
+			UntilDate:   1700000000,
+		},
+		attempts: retryAttempts,
+	}, fmt.Errorf("%w, Bad Request: not enough rights", bot.ErrorBadRequest))
+
+	if count, err := s.retryFailed(0); err != nil || count != 0 {
+		t.Fatalf("Expected no retried call, got %d, %v", count, err)
+	}
+
+	if queue := s.dispatcher.queued(-100); len(queue) != 0 {
+		t.Errorf("Expected the restriction not to be queued, got %+v", queue)
+	}
+
+	if list := s.failedList("en"); list != s.t("en", "admin.failed_empty") {
+		t.Errorf("Expected the restriction to be dropped, got %q", list)
+	}
+}
+
+func TestCallWithRetryReportsModeration(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok": false, "error_code": 429, "description": "Too Many Requests: retry after 30", "parameters": {"retry_after": 30}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	b, err := bot.New("123:token", bot.WithSkipGetMe(), bot.WithServerURL(server.URL))
+	if err != nil {
+		t.Fatalf("bot.New error: %v", err)
+	}
+
+	s := newTestSender(t, &conf.Config{TelegramAdminIDsList: []int64{1}})
+	s.Bot = b
+
+	started := time.Now()
+
+	err = s.callWithRetry(context.Background(), &RestrictChatMember{ChatID: -100, UserID: 100, UntilDate: int(time.Now().Add(time.Minute).Unix())})
+	if err == nil {
+		t.Fatal("Expected the call to fail")
+	}
+
+	if elapsed := time.Since(started); elapsed > directRetryWait {
+		t.Errorf("Expected the handler not to wait longer than %s, waited %s", directRetryWait, elapsed)
+	}
+
+	if failed, _ := s.Store.ListOutbox(data.OutboxFailed); len(failed) != 0 {
+		t.Errorf("Expected the restriction not to be dead-lettered, got %+v", failed)
+	}
+
+	queued := s.dispatcher.queued(1)
+	if len(queued) != 1 {
+		t.Fatalf("Expected the admin to be told, got %+v", queued)
+	}
+
+	if message, ok := queued[0].Request.(*SendMessage); !ok || !strings.Contains(message.Text, "restrictChatMember") {
+		t.Errorf("Expected the failed restriction in the report, got %+v", queued[0].Request)
+	}
+}
@@ -0,0 +1,103 @@
+package sender
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// scheduler holds requests until their SendAt and then hands them to
+// enqueue. Scheduled requests stay pending in the outbox, so they are
+// scheduled again when the bot restarts.
+type scheduler struct {
+	mu    sync.Mutex
+	items []DeferredMessage // ordered by SendAt
+
+	wake    chan struct{}
+	enqueue func(DeferredMessage)
+	now     func() time.Time
+}
+
+func newScheduler(enqueue func(DeferredMessage)) *scheduler {
+	return &scheduler{
+		wake:    make(chan struct{}, 1),
+		enqueue: enqueue,
+		now:     time.Now,
+	}
+}
+
+// add schedules the request, keeping requests with the same SendAt in the
+// order they were added.
+func (sc *scheduler) add(dm DeferredMessage) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	index, _ := slices.BinarySearchFunc(sc.items, dm.SendAt, func(item DeferredMessage, sendAt time.Time) int {
+		if item.SendAt.After(sendAt) {
+			return 1
+		}
+
+		return -1
+	})
+
+	sc.items = slices.Insert(sc.items, index, dm)
+
+	select {
+	case sc.wake <- struct{}{}:
+	default:
+	}
+}
+
+// due removes and returns the requests to send now, and how long to wait
+// for the next one.
+func (sc *scheduler) due() ([]DeferredMessage, time.Duration) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	now := sc.now()
+
+	count := 0
+	for count < len(sc.items) && !sc.items[count].SendAt.After(now) {
+		count++
+	}
+
+	due := slices.Clone(sc.items[:count])
+	sc.items = slices.Delete(sc.items, 0, count)
+
+	wait := dispatcherIdle
+	if len(sc.items) > 0 {
+		wait = sc.items[0].SendAt.Sub(now)
+	}
+
+	return due, wait
+}
+
+// scheduled returns a copy of the requests waiting for their time.
+func (sc *scheduler) scheduled() []DeferredMessage {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	return slices.Clone(sc.items)
+}
+
+// run queues requests as they become due until ctx is done.
+func (sc *scheduler) run(ctx context.Context) {
+	for {
+		due, wait := sc.due()
+		for _, dm := range due {
+			sc.enqueue(dm)
+		}
+
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-sc.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
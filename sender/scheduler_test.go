@@ -0,0 +1,119 @@
+package sender
+
+import (
+	"testing"
+	"time"
+
+	conf "github.com/ad/telegram-delete-join-messages/config"
+	"github.com/ad/telegram-delete-join-messages/data"
+)
+
+func TestSchedulerDue(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	sc := newScheduler(func(DeferredMessage) {})
+	sc.now = func() time.Time { return now }
+
+	for _, item := range []struct {
+		text  string
+		delay time.Duration
+	}{
+		{"b", 2 * time.Minute},
+		{"a", time.Minute},
+		{"c", 2 * time.Minute},
+	} {
+		sc.add(DeferredMessage{Request: &SendMessage{ChatID: 1, Text: item.text}, SendAt: now.Add(item.delay)})
+	}
+
+	if due, wait := sc.due(); len(due) != 0 || wait != time.Minute {
+		t.Fatalf("Expected nothing due for a minute, got %d, %s", len(due), wait)
+	}
+
+	now = now.Add(time.Minute)
+
+	if due, wait := sc.due(); len(due) != 1 || due[0].Request.(*SendMessage).Text != "a" || wait != time.Minute {
+		t.Fatalf("Expected a to be due, got %+v, %s", due, wait)
+	}
+
+	now = now.Add(time.Hour)
+
+	due, wait := sc.due()
+	if len(due) != 2 || due[0].Request.(*SendMessage).Text != "b" || due[1].Request.(*SendMessage).Text != "c" {
+		t.Fatalf("Expected b and c in the order they were added, got %+v", due)
+	}
+
+	if wait != dispatcherIdle || len(sc.scheduled()) != 0 {
+		t.Errorf("Expected the scheduler to be empty, got %s, %d", wait, len(sc.scheduled()))
+	}
+}
+
+func TestScheduleDeletionAndReplay(t *testing.T) {
+	s := newTestSender(t, &conf.Config{})
+
+	s.scheduleDeletion(SendResult{ChatID: -100, MessageID: 10}, time.Hour)
+	s.scheduleDeletion(SendResult{ChatID: -100, MessageIDs: []int64{11, 12}}, time.Hour)
+	s.scheduleDeletion(SendResult{ChatID: -100}, time.Hour)
+
+	s.MakeDeferred(DeferredMessage{
+		Request:     &SendMessage{ChatID: -100, Text: "now"},
+		DeleteAfter: time.Minute,
+	}, s.SendResult)
+
+	scheduled := s.scheduler.scheduled()
+	if len(scheduled) != 2 || s.dispatcher.pending(-100) != 1 {
+		t.Fatalf("Expected 2 scheduled deletions and 1 queued message, got %d, %d", len(scheduled), s.dispatcher.pending(-100))
+	}
+
+	if remove, ok := scheduled[0].Request.(*DeleteMessage); !ok || remove.MessageID != 10 || time.Until(scheduled[0].SendAt) < 59*time.Minute {
+		t.Errorf("Unexpected deletion: %#v at %s", scheduled[0].Request, scheduled[0].SendAt)
+	}
+
+	if remove, ok := scheduled[1].Request.(*DeleteMessages); !ok || len(remove.MessageIDs) != 2 {
+		t.Errorf("Unexpected deletion: %#v", scheduled[1].Request)
+	}
+
+	pending, err := s.Store.ListOutbox(data.OutboxPending)
+	if err != nil || len(pending) != 3 {
+		t.Fatalf("Expected scheduled messages to be pending, got %+v, %v", pending, err)
+	}
+
+	replayed := newTestSender(t, &conf.Config{})
+	replayed.Store = s.Store
+	replayed.replayOutbox()
+
+	if got := replayed.scheduler.scheduled(); len(got) != 2 || !got[0].SendAt.Equal(scheduled[0].SendAt) {
+		t.Fatalf("Expected deletions to be scheduled again, got %+v", got)
+	}
+
+	queue := replayed.dispatcher.queued(-100)
+	if len(queue) != 1 || queue[0].DeleteAfter != time.Minute {
+		t.Errorf("Expected DeleteAfter to survive a restart, got %+v", queue)
+	}
+}
+
+func TestParseAnnouncement(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+
+	a, err := parseAnnouncement("/announce -100 1h30m Hello\nworld", now)
+	if err != nil || a.chatID != -100 || !a.sendAt.Equal(now.Add(90*time.Minute)) || a.text != "Hello\nworld" {
+		t.Fatalf("Unexpected announcement: %+v, %v", a, err)
+	}
+
+	a, err = parseAnnouncement("/announce@bot -100 2024-05-02T09:30 Hi", now)
+	if err != nil || !a.sendAt.Equal(time.Date(2024, 5, 2, 9, 30, 0, 0, time.Local)) {
+		t.Fatalf("Unexpected announcement: %+v, %v", a, err)
+	}
+
+	for _, text := range []string{
+		"/announce",
+		"/announce -100 1h",
+		"/announce chat 1h Hi",
+		"/announce -100 soon Hi",
+		"/announce -100 -1h Hi",
+		"/announce -100 2024-04-30T09:30 Hi",
+	} {
+		if _, err := parseAnnouncement(text, now); err == nil {
+			t.Errorf("Expected %q to be rejected", text)
+		}
+	}
+}
@@ -4,11 +4,11 @@ import "fmt"
 
 func (sender *Sender) SendResult(s SendResult) error {
 	if s.Error != nil {
-		sender.lgr.Error(fmt.Sprintf("message id %d sent to %d error %q: %s", s.MessageID, s.ChatID, s.Error, s.Msg))
+		sender.lgr.Error(fmt.Sprintf("%s message id %d to %d error %q: %s", s.Method, s.MessageID, s.ChatID, s.Error, s.Msg))
 		return s.Error
 	}
 
-	sender.lgr.Info(fmt.Sprintf("message id %d sent to %d: %s", s.MessageID, s.ChatID, s.Msg))
+	sender.lgr.Info(fmt.Sprintf("%s message id %d to %d: %s", s.Method, s.MessageID, s.ChatID, s.Msg))
 
 	return nil
 }
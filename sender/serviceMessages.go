@@ -0,0 +1,60 @@
+package sender
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	conf "github.com/ad/telegram-delete-join-messages/config"
+	"github.com/go-telegram/bot/models"
+)
+
+// serviceMessageKind returns the DELETE_SERVICE_MESSAGES kind of message,
+// or "" if it is not one of them.
+func serviceMessageKind(message *models.Message) string {
+	switch {
+	case message.PinnedMessage != nil:
+		return conf.ServicePinned
+	case message.NewChatTitle != "":
+		return conf.ServiceTitle
+	case len(message.NewChatPhoto) > 0, message.DeleteChatPhoto:
+		return conf.ServicePhoto
+	case message.VoiceChatScheduled != nil, message.VoiceChatStarted != nil,
+		message.VoiceChatEnded != nil, message.VoiceChatParticipantsInvited != nil:
+		return conf.ServiceVideoChat
+	case message.ForumTopicCreated != nil, message.ForumTopicEdited != nil,
+		message.ForumTopicClosed != nil, message.ForumTopicReopened != nil,
+		message.GeneralForumTopicHidden != nil, message.GeneralForumTopicUnhidden != nil:
+		return conf.ServiceForumTopic
+	case message.BoostAdded != nil:
+		return conf.ServiceBoost
+	case message.MessageAutoDeleteTimerChanged != nil:
+		return conf.ServiceAutoDelete
+	case message.ChatBackgroundSet != nil:
+		return conf.ServiceBackground
+	default:
+		return ""
+	}
+}
+
+// deleteServiceMessage deletes message right away, or schedules the deletion
+// when the chat policy has a delay.
+func (s *Sender) deleteServiceMessage(ctx context.Context, message *models.Message, policy conf.Policy) {
+	request := &DeleteMessage{
+		ChatID:    message.Chat.ID,
+		MessageID: message.ID,
+	}
+
+	if policy.DeleteServiceDelay > 0 {
+		s.MakeDeferred(DeferredMessage{
+			Request: request,
+			SendAt:  time.Now().Add(time.Duration(policy.DeleteServiceDelay) * time.Second),
+		}, s.SendResult)
+
+		return
+	}
+
+	if err := s.callWithRetry(ctx, request); err != nil {
+		s.lgr.Error(fmt.Sprintf("Error deleting message %d, %d: %s", message.Chat.ID, message.ID, err.Error()))
+	}
+}
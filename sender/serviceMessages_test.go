@@ -0,0 +1,47 @@
+package sender
+
+import (
+	"testing"
+
+	conf "github.com/ad/telegram-delete-join-messages/config"
+	"github.com/go-telegram/bot/models"
+)
+
+func TestServiceMessageKind(t *testing.T) {
+	tests := []struct {
+		message models.Message
+		want    string
+	}{
+		{models.Message{PinnedMessage: &models.MaybeInaccessibleMessage{}}, conf.ServicePinned},
+		{models.Message{NewChatTitle: "New title"}, conf.ServiceTitle},
+		{models.Message{DeleteChatPhoto: true}, conf.ServicePhoto},
+		{models.Message{VoiceChatEnded: &models.VoiceChatEnded{Duration: 60}}, conf.ServiceVideoChat},
+		{models.Message{ForumTopicClosed: &models.ForumTopicClosed{}}, conf.ServiceForumTopic},
+		{models.Message{BoostAdded: &models.ChatBoostAdded{BoostCount: 1}}, conf.ServiceBoost},
+		{models.Message{Text: "hello"}, ""},
+		{models.Message{NewChatMembers: []models.User{{ID: 1}}}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := serviceMessageKind(&tt.message); got != tt.want {
+			t.Errorf("serviceMessageKind(%+v) = %q, want %q", tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestDeleteServiceMessageWithDelay(t *testing.T) {
+	s := newTestSender(t, &conf.Config{})
+
+	message := &models.Message{ID: 10, Chat: models.Chat{ID: -100}, PinnedMessage: &models.MaybeInaccessibleMessage{}}
+
+	s.deleteServiceMessage(t.Context(), message, conf.Policy{DeleteServiceDelay: 60})
+
+	scheduled := s.scheduler.scheduled()
+	if len(scheduled) != 1 {
+		t.Fatalf("Expected the deletion to be scheduled, got %d", len(scheduled))
+	}
+
+	if remove, ok := scheduled[0].Request.(*DeleteMessage); !ok || remove.ChatID != -100 || remove.MessageID != 10 {
+		t.Errorf("Unexpected deletion: %#v", scheduled[0].Request)
+	}
+}
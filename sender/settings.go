@@ -0,0 +1,401 @@
+package sender
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	conf "github.com/ad/telegram-delete-join-messages/config"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const settingsCallbackPrefix = "settings:"
+
+var restrictTimePresets = []int{60, 300, 600, 3600, 86400}
+
+var serviceDelayPresets = []int{0, 10, 60, 300, 3600}
+
+// getPolicy returns the effective policy of a chat: config defaults with
+// the runtime overrides from the settings table applied on top.
+func (s *Sender) getPolicy(chatID int64) conf.Policy {
+	policy := s.config.Load().GetPolicy(chatID)
+
+	overrides, err := s.chatSettings(chatID)
+	if err != nil {
+		s.lgr.Error(fmt.Sprintf("getPolicy GetSettings error for %d: %s", chatID, err.Error()))
+		return policy
+	}
+
+	return policy.WithOverrides(overrides)
+}
+
+// chatSettings returns the runtime overrides of a chat. getPolicy runs for
+// every group message, so they are loaded once and kept until
+// updateSettings changes them.
+func (s *Sender) chatSettings(chatID int64) (map[string]string, error) {
+	s.overridesMu.RLock()
+	overrides, ok := s.overrides[chatID]
+	s.overridesMu.RUnlock()
+
+	if ok {
+		return overrides, nil
+	}
+
+	s.overridesMu.Lock()
+	defer s.overridesMu.Unlock()
+
+	if overrides, ok := s.overrides[chatID]; ok {
+		return overrides, nil
+	}
+
+	overrides, err := s.Store.GetSettings(chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.overrides == nil {
+		s.overrides = make(map[int64]map[string]string)
+	}
+
+	s.overrides[chatID] = overrides
+
+	return overrides, nil
+}
+
+// updateSettings changes the stored overrides of a chat with update and
+// forgets the cached ones. Holding overridesMu meanwhile keeps a concurrent
+// chatSettings from caching the overrides from before the change.
+func (s *Sender) updateSettings(chatID int64, update func() error) error {
+	s.overridesMu.Lock()
+	defer s.overridesMu.Unlock()
+
+	delete(s.overrides, chatID)
+
+	return update()
+}
+
+// Handle /settings command to show runtime settings of the allowed chats
+func (s *Sender) settings(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.Message == nil || update.Message.From == nil {
+		return
+	}
+
+	config := s.config.Load()
+
+	if !slices.Contains(config.TelegramAdminIDsList, update.Message.From.ID) {
+		return
+	}
+
+	var (
+		text   string
+		markup models.ReplyMarkup
+	)
+
+	switch {
+	case slices.Contains(config.AllowedChatIDsList, update.Message.Chat.ID):
+		text, markup = s.settingsForChat(ctx, b, update.Message.Chat.ID, false)
+	case len(config.AllowedChatIDsList) == 1:
+		text, markup = s.settingsForChat(ctx, b, config.AllowedChatIDsList[0], false)
+	default:
+		text, markup = s.settingsChatList(config)
+	}
+
+	_, errSendMessage := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      update.Message.Chat.ID,
+		Text:        text,
+		ReplyMarkup: markup,
+	})
+
+	if errSendMessage != nil {
+		fmt.Println("errSendMessage (/settings): ", errSendMessage)
+	}
+}
+
+// Handle inline keyboard presses of the /settings message
+func (s *Sender) settingsCallback(ctx context.Context, b *bot.Bot, update *models.Update) {
+	query := update.CallbackQuery
+	if query == nil {
+		return
+	}
+
+	config := s.config.Load()
+	locale := s.adminLocale()
+
+	answer := ""
+
+	defer func() {
+		_, errAnswer := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: query.ID,
+			Text:            answer,
+		})
+
+		if errAnswer != nil {
+			fmt.Println("errAnswerCallbackQuery (/settings): ", errAnswer)
+		}
+	}()
+
+	if !slices.Contains(config.TelegramAdminIDsList, query.From.ID) {
+		answer = s.t(locale, "settings.admins_only")
+		return
+	}
+
+	if query.Message.Message == nil {
+		return
+	}
+
+	message := query.Message.Message
+
+	action, err := parseSettingsCallback(query.Data)
+	if err != nil {
+		s.lgr.Error(fmt.Sprintf("settingsCallback parse error %q: %s", query.Data, err.Error()))
+		return
+	}
+
+	var (
+		text   string
+		markup models.ReplyMarkup
+	)
+
+	if action.chatID == 0 {
+		text, markup = s.settingsChatList(config)
+	} else {
+		if !slices.Contains(config.AllowedChatIDsList, action.chatID) {
+			answer = s.t(locale, "settings.chat_not_allowed")
+			return
+		}
+
+		if errApply := s.applySettingsAction(action); errApply != nil {
+			s.lgr.Error(fmt.Sprintf("settingsCallback apply error %q: %s", query.Data, errApply.Error()))
+			answer = s.t(locale, "settings.save_failed")
+			return
+		}
+
+		if action.key != "" {
+			answer = s.t(locale, "settings.saved")
+		}
+
+		text, markup = s.settingsForChat(ctx, b, action.chatID, len(config.AllowedChatIDsList) > 1 && message.Chat.Type == models.ChatTypePrivate)
+	}
+
+	_, errEdit := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      message.Chat.ID,
+		MessageID:   message.ID,
+		Text:        text,
+		ReplyMarkup: markup,
+	})
+
+	if errEdit != nil && !strings.Contains(errEdit.Error(), "message is not modified") {
+		fmt.Println("errEditMessageText (/settings): ", errEdit)
+	}
+}
+
+type settingsAction struct {
+	chatID int64
+	key    string
+	value  string
+}
+
+// parseSettingsCallback parses callback data of the following forms:
+//
+//	settings:list
+//	settings:<chat>
+//	settings:<chat>:<key>
+//	settings:<chat>:<key>:<value>
+func parseSettingsCallback(raw string) (settingsAction, error) {
+	parts := strings.Split(strings.TrimPrefix(raw, settingsCallbackPrefix), ":")
+
+	if len(parts) == 0 || parts[0] == "" {
+		return settingsAction{}, fmt.Errorf("empty settings callback")
+	}
+
+	if parts[0] == "list" {
+		return settingsAction{}, nil
+	}
+
+	chatID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || chatID == 0 {
+		return settingsAction{}, fmt.Errorf("invalid chat id %q", parts[0])
+	}
+
+	action := settingsAction{chatID: chatID}
+
+	if len(parts) > 1 {
+		action.key = parts[1]
+	}
+
+	if len(parts) > 2 {
+		action.value = parts[2]
+	}
+
+	switch action.key {
+	case "", "reset", conf.SettingDeleteJoin, conf.SettingDeleteLeave, conf.SettingRestrictOnJoin, conf.SettingCaptcha, conf.SettingManualApproval:
+	case conf.SettingRestrictOnJoinTime:
+		if seconds, err := strconv.Atoi(action.value); err != nil || seconds < 0 {
+			return settingsAction{}, fmt.Errorf("invalid restrict time %q", action.value)
+		}
+	case conf.SettingDeleteService:
+		if !slices.Contains(conf.ServiceKinds, action.value) {
+			return settingsAction{}, fmt.Errorf("invalid service message kind %q", action.value)
+		}
+	case conf.SettingDeleteServiceDelay:
+		if seconds, err := strconv.Atoi(action.value); err != nil || seconds < 0 || seconds > conf.MaxEphemeralMessagesTTL {
+			return settingsAction{}, fmt.Errorf("invalid service messages delay %q", action.value)
+		}
+	default:
+		return settingsAction{}, fmt.Errorf("unknown setting %q", action.key)
+	}
+
+	return action, nil
+}
+
+func (s *Sender) applySettingsAction(action settingsAction) error {
+	policy := s.getPolicy(action.chatID)
+
+	var value string
+
+	switch action.key {
+	case "":
+		return nil
+	case "reset":
+		return s.updateSettings(action.chatID, func() error {
+			return s.Store.DeleteSettings(action.chatID)
+		})
+	case conf.SettingDeleteJoin:
+		value = strconv.FormatBool(!policy.DeleteJoinMessages)
+	case conf.SettingDeleteLeave:
+		value = strconv.FormatBool(!policy.DeleteLeaveMessages)
+	case conf.SettingRestrictOnJoin:
+		value = strconv.FormatBool(!policy.RestictOnJoin)
+	case conf.SettingCaptcha:
+		value = strconv.FormatBool(!policy.Captcha)
+	case conf.SettingManualApproval:
+		value = strconv.FormatBool(!policy.ManualApproval)
+	case conf.SettingDeleteService:
+		value = policy.DeleteServiceMessages.Toggle(action.value).String()
+	default:
+		value = action.value
+	}
+
+	return s.updateSettings(action.chatID, func() error {
+		return s.Store.SetSetting(action.chatID, action.key, value)
+	})
+}
+
+func (s *Sender) settingsChatList(config *conf.Config) (string, models.ReplyMarkup) {
+	locale := s.adminLocale()
+
+	if len(config.AllowedChatIDsList) == 0 {
+		return s.t(locale, "settings.chat_list_empty"), nil
+	}
+
+	keyboard := [][]models.InlineKeyboardButton{}
+	for _, chatID := range config.AllowedChatIDsList {
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{
+			Text:         strconv.FormatInt(chatID, 10),
+			CallbackData: fmt.Sprintf("%s%d", settingsCallbackPrefix, chatID),
+		}})
+	}
+
+	return s.t(locale, "settings.choose_chat"), &models.InlineKeyboardMarkup{InlineKeyboard: keyboard}
+}
+
+func (s *Sender) settingsForChat(ctx context.Context, b *bot.Bot, chatID int64, withBack bool) (string, models.ReplyMarkup) {
+	policy := s.getPolicy(chatID)
+	locale := s.adminLocale()
+
+	title := strconv.FormatInt(chatID, 10)
+	if chat, err := b.GetChat(ctx, &bot.GetChatParams{ChatID: chatID}); err == nil && chat.Title != "" {
+		title = fmt.Sprintf("%s (%d)", chat.Title, chatID)
+	}
+
+	text := s.t(locale, "settings.title", title, s.formatSeconds(locale, policy.RestrictOnJoinTime), s.formatSeconds(locale, policy.DeleteServiceDelay))
+
+	callback := func(parts ...string) string {
+		return fmt.Sprintf("%s%d:%s", settingsCallbackPrefix, chatID, strings.Join(parts, ":"))
+	}
+
+	timeRow := []models.InlineKeyboardButton{}
+	for _, seconds := range restrictTimePresets {
+		label := s.formatSeconds(locale, seconds)
+		if seconds == policy.RestrictOnJoinTime {
+			label = "• " + label
+		}
+
+		timeRow = append(timeRow, models.InlineKeyboardButton{
+			Text:         label,
+			CallbackData: callback(conf.SettingRestrictOnJoinTime, strconv.Itoa(seconds)),
+		})
+	}
+
+	serviceRows := [][]models.InlineKeyboardButton{}
+	for index, kind := range conf.ServiceKinds {
+		button := models.InlineKeyboardButton{
+			Text:         checkMark(policy.DeleteServiceMessages.Has(kind)) + " " + s.t(locale, "settings.service."+kind),
+			CallbackData: callback(conf.SettingDeleteService, kind),
+		}
+
+		if index%2 == 0 {
+			serviceRows = append(serviceRows, []models.InlineKeyboardButton{button})
+		} else {
+			serviceRows[len(serviceRows)-1] = append(serviceRows[len(serviceRows)-1], button)
+		}
+	}
+
+	delayRow := []models.InlineKeyboardButton{}
+	for _, seconds := range serviceDelayPresets {
+		label := s.formatSeconds(locale, seconds)
+		if seconds == policy.DeleteServiceDelay {
+			label = "• " + label
+		}
+
+		delayRow = append(delayRow, models.InlineKeyboardButton{
+			Text:         label,
+			CallbackData: callback(conf.SettingDeleteServiceDelay, strconv.Itoa(seconds)),
+		})
+	}
+
+	keyboard := [][]models.InlineKeyboardButton{
+		{{Text: checkMark(policy.DeleteJoinMessages) + " " + s.t(locale, "settings.delete_join"), CallbackData: callback(conf.SettingDeleteJoin)}},
+		{{Text: checkMark(policy.DeleteLeaveMessages) + " " + s.t(locale, "settings.delete_leave"), CallbackData: callback(conf.SettingDeleteLeave)}},
+		{{Text: checkMark(policy.RestictOnJoin) + " " + s.t(locale, "settings.restrict_on_join"), CallbackData: callback(conf.SettingRestrictOnJoin)}},
+		timeRow,
+		{{Text: checkMark(policy.Captcha) + " " + s.t(locale, "settings.captcha"), CallbackData: callback(conf.SettingCaptcha)}},
+		{{Text: checkMark(policy.ManualApproval) + " " + s.t(locale, "settings.manual_approval"), CallbackData: callback(conf.SettingManualApproval)}},
+	}
+
+	keyboard = append(keyboard, serviceRows...)
+	keyboard = append(keyboard,
+		delayRow,
+		[]models.InlineKeyboardButton{{Text: s.t(locale, "settings.reset"), CallbackData: callback("reset")}},
+	)
+
+	if withBack {
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: s.t(locale, "settings.back"), CallbackData: settingsCallbackPrefix + "list"}})
+	}
+
+	return text, &models.InlineKeyboardMarkup{InlineKeyboard: keyboard}
+}
+
+func checkMark(enabled bool) string {
+	if enabled {
+		return "✅"
+	}
+
+	return "❌"
+}
+
+func (s *Sender) formatSeconds(locale string, seconds int) string {
+	switch {
+	case seconds >= 86400 && seconds%86400 == 0:
+		return s.t(locale, "unit.days", seconds/86400)
+	case seconds >= 3600 && seconds%3600 == 0:
+		return s.t(locale, "unit.hours", seconds/3600)
+	case seconds >= 60 && seconds%60 == 0:
+		return s.t(locale, "unit.minutes", seconds/60)
+	default:
+		return s.t(locale, "unit.seconds", seconds)
+	}
+}
@@ -0,0 +1,155 @@
+package sender
+
+import (
+	"testing"
+
+	conf "github.com/ad/telegram-delete-join-messages/config"
+)
+
+func TestParseSettingsCallback(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    settingsAction
+		wantErr bool
+	}{
+		{
+			name: "chat list",
+			data: "settings:list",
+			want: settingsAction{},
+		},
+		{
+			name: "open chat",
+			data: "settings:-1001234",
+			want: settingsAction{chatID: -1001234},
+		},
+		{
+			name: "toggle",
+			data: "settings:-1001234:delete_join",
+			want: settingsAction{chatID: -1001234, key: "delete_join"},
+		},
+		{
+			name: "toggle captcha",
+			data: "settings:-1001234:captcha",
+			want: settingsAction{chatID: -1001234, key: "captcha"},
+		},
+		{
+			name: "restrict time",
+			data: "settings:-1001234:restrict_on_join_time:600",
+			want: settingsAction{chatID: -1001234, key: "restrict_on_join_time", value: "600"},
+		},
+		{
+			name:    "invalid restrict time",
+			data:    "settings:-1001234:restrict_on_join_time:abc",
+			wantErr: true,
+		},
+		{
+			name: "service message kind",
+			data: "settings:-1001234:delete_service:pinned",
+			want: settingsAction{chatID: -1001234, key: "delete_service", value: "pinned"},
+		},
+		{
+			name:    "unknown service message kind",
+			data:    "settings:-1001234:delete_service:everything",
+			wantErr: true,
+		},
+		{
+			name:    "unknown key",
+			data:    "settings:-1001234:drop_table",
+			wantErr: true,
+		},
+		{
+			name:    "invalid chat",
+			data:    "settings:abc",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSettingsCallback(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got != tt.want {
+				t.Fatalf("parseSettingsCallback() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatSeconds(t *testing.T) {
+	tests := map[int]string{
+		45:    "45 с",
+		60:    "1 мин",
+		90:    "90 с",
+		3600:  "1 ч",
+		86400: "1 д",
+	}
+
+	s := &Sender{}
+
+	for seconds, want := range tests {
+		if got := s.formatSeconds("ru", seconds); got != want {
+			t.Errorf("formatSeconds(%d) = %q, want %q", seconds, got, want)
+		}
+	}
+}
+
+func TestGetPolicyOverrides(t *testing.T) {
+	s := newTestSender(t, &conf.Config{RestrictOnJoinTime: 600})
+
+	if policy := s.getPolicy(-100); policy.DeleteJoinMessages || policy.RestrictOnJoinTime != 600 {
+		t.Fatalf("Expected config defaults, got %+v", policy)
+	}
+
+	for _, action := range []settingsAction{
+		{chatID: -100, key: conf.SettingDeleteJoin},
+		{chatID: -100, key: conf.SettingRestrictOnJoinTime, value: "60"},
+		{chatID: -100, key: conf.SettingDeleteService, value: conf.ServicePinned},
+		{chatID: -100, key: conf.SettingDeleteService, value: conf.ServiceBoost},
+		{chatID: -100, key: conf.SettingDeleteService, value: conf.ServicePinned},
+		{chatID: -100, key: conf.SettingDeleteServiceDelay, value: "10"},
+	} {
+		if err := s.applySettingsAction(action); err != nil {
+			t.Fatalf("applySettingsAction(%+v) error: %v", action, err)
+		}
+	}
+
+	if policy := s.getPolicy(-100); !policy.DeleteJoinMessages || policy.RestrictOnJoinTime != 60 {
+		t.Fatalf("Expected overrides to apply, got %+v", policy)
+	}
+
+	if policy := s.getPolicy(-100); policy.DeleteServiceMessages.String() != conf.ServiceBoost || policy.DeleteServiceDelay != 10 {
+		t.Fatalf("Expected service message kinds to toggle, got %q after %d s", policy.DeleteServiceMessages, policy.DeleteServiceDelay)
+	}
+
+	if policy := s.getPolicy(-200); policy.DeleteJoinMessages {
+		t.Fatalf("Expected overrides to be per chat, got %+v", policy)
+	}
+
+	// loaded once per chat, not for every message
+	if err := s.Store.SetSetting(-200, conf.SettingDeleteJoin, "true"); err != nil {
+		t.Fatalf("SetSetting error: %v", err)
+	}
+
+	if policy := s.getPolicy(-200); policy.DeleteJoinMessages {
+		t.Fatalf("Expected the overrides to be cached, got %+v", policy)
+	}
+
+	if err := s.applySettingsAction(settingsAction{chatID: -100, key: "reset"}); err != nil {
+		t.Fatalf("reset error: %v", err)
+	}
+
+	if policy := s.getPolicy(-100); policy.DeleteJoinMessages || policy.RestrictOnJoinTime != 600 {
+		t.Fatalf("Expected reset to restore defaults, got %+v", policy)
+	}
+}
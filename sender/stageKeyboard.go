@@ -0,0 +1,184 @@
+package sender
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ad/telegram-delete-join-messages/config"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	stageCallbackPrefix = "stage:"
+
+	variantsPerRow = 2
+)
+
+// stageMarkup returns the keyboard with the variants of a stage, nil if the
+// stage is answered with free text only.
+func stageMarkup(stage int, conversation *config.Conversation) models.ReplyMarkup {
+	switch conversation.Keyboard {
+	case config.KeyboardReply:
+		keyboard := [][]models.KeyboardButton{}
+
+		for _, variant := range conversation.VariantList() {
+			if variant == "" {
+				continue
+			}
+
+			keyboard = appendToRow(keyboard, models.KeyboardButton{Text: variant})
+		}
+
+		return &models.ReplyKeyboardMarkup{Keyboard: keyboard, ResizeKeyboard: true, OneTimeKeyboard: true}
+	case config.KeyboardInline:
+		keyboard := [][]models.InlineKeyboardButton{}
+
+		for index, variant := range conversation.VariantList() {
+			if variant == "" {
+				continue
+			}
+
+			keyboard = appendToRow(keyboard, models.InlineKeyboardButton{
+				Text:         variant,
+				CallbackData: fmt.Sprintf("%s%d:%d", stageCallbackPrefix, stage, index),
+			})
+		}
+
+		return &models.InlineKeyboardMarkup{InlineKeyboard: keyboard}
+	default:
+		return nil
+	}
+}
+
+// appendToRow adds a button to the last row, or starts a new one when it
+// already holds variantsPerRow buttons.
+func appendToRow[T any](keyboard [][]T, button T) [][]T {
+	if len(keyboard) == 0 || len(keyboard[len(keyboard)-1]) >= variantsPerRow {
+		return append(keyboard, []T{button})
+	}
+
+	keyboard[len(keyboard)-1] = append(keyboard[len(keyboard)-1], button)
+
+	return keyboard
+}
+
+// answerMarkup removes the reply keyboard of an answered stage.
+func answerMarkup(conversation *config.Conversation) models.ReplyMarkup {
+	if conversation.Keyboard != config.KeyboardReply {
+		return nil
+	}
+
+	return &models.ReplyKeyboardRemove{RemoveKeyboard: true}
+}
+
+// askStage sends the question of a stage with its variants.
+func (s *Sender) askStage(ctx context.Context, b *bot.Bot, chatID int64, stage int, conversation *config.Conversation) {
+	s.askStageAfter(ctx, b, chatID, "", stage, conversation)
+}
+
+// askStageAfter sends the question of a stage with its variants, preceded
+// by intro unless it is empty.
+func (s *Sender) askStageAfter(ctx context.Context, b *bot.Bot, chatID int64, intro string, stage int, conversation *config.Conversation) {
+	text := conversation.Question
+	if intro != "" {
+		text = intro + "\n\n" + text
+	}
+
+	message, errSendMessage := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        text,
+		ReplyMarkup: stageMarkup(stage, conversation),
+	})
+
+	if errSendMessage != nil {
+		fmt.Println("errSendMessage (question): ", errSendMessage)
+		return
+	}
+
+	if conversation.Keyboard == config.KeyboardInline {
+		s.convHandler.SetKeyboardMessage(int(chatID), message.ID)
+	}
+}
+
+// removeInlineVariants removes the inline variants of the answered question.
+func (s *Sender) removeInlineVariants(ctx context.Context, b *bot.Bot, userID int64) {
+	messageID := s.convHandler.TakeKeyboardMessage(int(userID))
+	if messageID == 0 {
+		return
+	}
+
+	_, errEdit := b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
+		ChatID:    userID,
+		MessageID: messageID,
+	})
+
+	if errEdit != nil {
+		fmt.Println("errEditMessageReplyMarkup (stage): ", errEdit)
+	}
+}
+
+// parseStageCallback parses callback data of the form stage:<stage>:<variant>.
+func parseStageCallback(raw string) (int, int, error) {
+	stagePart, variantPart, ok := strings.Cut(strings.TrimPrefix(raw, stageCallbackPrefix), ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid stage callback %q", raw)
+	}
+
+	stage, err := strconv.Atoi(stagePart)
+	if err != nil || stage < 0 {
+		return 0, 0, fmt.Errorf("invalid stage %q", stagePart)
+	}
+
+	variant, err := strconv.Atoi(variantPart)
+	if err != nil || variant < 0 {
+		return 0, 0, fmt.Errorf("invalid variant %q", variantPart)
+	}
+
+	return stage, variant, nil
+}
+
+// Handle a press of an inline variant: it is answered like typed text.
+// Variants of a question that is no longer active are removed.
+func (s *Sender) stageCallback(ctx context.Context, b *bot.Bot, update *models.Update) {
+	query := update.CallbackQuery
+	if query == nil || query.Message.Message == nil || query.Message.Message.Chat.Type != models.ChatTypePrivate {
+		return
+	}
+
+	answer := ""
+
+	defer func() {
+		_, errAnswer := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: query.ID,
+			Text:            answer,
+		})
+
+		if errAnswer != nil {
+			fmt.Println("errAnswerCallbackQuery (stage): ", errAnswer)
+		}
+	}()
+
+	userID := query.From.ID
+
+	// the pressed question loses its variants once answered
+	s.convHandler.SetKeyboardMessage(int(userID), query.Message.Message.ID)
+
+	stage, variant, err := parseStageCallback(query.Data)
+	if err != nil {
+		s.lgr.Error(fmt.Sprintf("stageCallback parse error: %s", err.Error()))
+		return
+	}
+
+	conversation, err := s.GetConversationById(s.verificationGroup(userID), stage)
+	if err != nil || !s.convHandler.IsActive(int(userID)) || s.convHandler.GetActiveStage(int(userID)) != stage || variant >= len(conversation.VariantList()) {
+		answer = s.t(s.userLocale(&query.From), "user.stage_expired")
+		s.removeInlineVariants(ctx, b, userID)
+
+		return
+	}
+
+	s.answerStage(ctx, b, &query.From, conversation.VariantList()[variant])
+}
@@ -0,0 +1,60 @@
+package sender
+
+import (
+	"testing"
+
+	"github.com/ad/telegram-delete-join-messages/config"
+	"github.com/go-telegram/bot/models"
+)
+
+func TestStageMarkup(t *testing.T) {
+	conversation := &config.Conversation{Question: "Tower?", Variants: "Башня А, Башня Б,,Башня В"}
+
+	if markup := stageMarkup(1, conversation); markup != nil {
+		t.Errorf("Expected no keyboard for free text, got %#v", markup)
+	}
+
+	if markup := answerMarkup(conversation); markup != nil {
+		t.Errorf("Expected nothing to remove for free text, got %#v", markup)
+	}
+
+	conversation.Keyboard = config.KeyboardReply
+
+	reply, ok := stageMarkup(1, conversation).(*models.ReplyKeyboardMarkup)
+	if !ok {
+		t.Fatalf("Expected a reply keyboard, got %#v", stageMarkup(1, conversation))
+	}
+
+	if len(reply.Keyboard) != 2 || len(reply.Keyboard[0]) != 2 || reply.Keyboard[0][1].Text != "Башня Б" || reply.Keyboard[1][0].Text != "Башня В" {
+		t.Errorf("Expected the variants two per row without empty ones, got %+v", reply.Keyboard)
+	}
+
+	if remove, ok := answerMarkup(conversation).(*models.ReplyKeyboardRemove); !ok || !remove.RemoveKeyboard {
+		t.Errorf("Expected the reply keyboard to be removed after the answer, got %#v", answerMarkup(conversation))
+	}
+
+	conversation.Keyboard = config.KeyboardInline
+
+	inline, ok := stageMarkup(1, conversation).(*models.InlineKeyboardMarkup)
+	if !ok {
+		t.Fatalf("Expected an inline keyboard, got %#v", stageMarkup(1, conversation))
+	}
+
+	last := inline.InlineKeyboard[len(inline.InlineKeyboard)-1][0]
+	if last.Text != "Башня В" || last.CallbackData != "stage:1:3" {
+		t.Errorf("Expected the last button to keep its variant index, got %+v", last)
+	}
+
+	stage, variant, err := parseStageCallback(last.CallbackData)
+	if err != nil || stage != 1 || variant != 3 || conversation.VariantList()[variant] != "Башня В" {
+		t.Errorf("Expected stage 1 variant 3, got %d, %d, %v", stage, variant, err)
+	}
+}
+
+func TestParseStageCallback(t *testing.T) {
+	for _, raw := range []string{"stage:", "stage:1", "stage:x:1", "stage:1:x", "stage:-1:0", "stage:0:-1"} {
+		if _, _, err := parseStageCallback(raw); err == nil {
+			t.Errorf("Expected error for %q", raw)
+		}
+	}
+}
@@ -2,68 +2,103 @@ package sender
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"log/slog"
 	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ad/telegram-delete-join-messages/commands"
 	conf "github.com/ad/telegram-delete-join-messages/config"
+	"github.com/ad/telegram-delete-join-messages/data"
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
 )
 
 type Sender struct {
 	sync.RWMutex
-	lgr              *slog.Logger
-	config           *conf.Config
-	DB               *sql.DB
-	Bot              *bot.Bot
-	Config           *conf.Config
-	deferredMessages map[int64]chan DeferredMessage
-	lastMessageTimes map[int64]int64
-	forwardTargets   map[int64]map[int64]int64
-	convHandler      *ConversationHandler
+	lgr            *slog.Logger
+	config         atomic.Pointer[conf.Config]
+	Store          data.Store
+	Bot            *bot.Bot
+	commands       *commands.Commands
+	dispatcher     *dispatcher
+	scheduler      *scheduler
+	forwardTargets map[int64]map[int64]int64
+	approvedJoins  map[chatUser]time.Time // join requests approved by the bot, see approvedJoinTTL
+	convHandler    *ConversationHandler
+	decisions      decisionLocks               // admins decide on one join request at a time
+	overrides      map[int64]map[string]string // runtime settings per chat, see chatSettings
+	overridesMu    sync.RWMutex
+
+	stop              context.CancelFunc
+	done              <-chan struct{}
+	updates           *updatePool
+	running           sync.WaitGroup // receiving updates and scheduling
+	workers           sync.WaitGroup // handling updates
+	stopWorkers       context.CancelFunc
+	dispatcherStopped chan struct{}
 }
 
-func InitSender(lgr *slog.Logger, config *conf.Config, db *sql.DB) (*Sender, error) {
-	command := commands.InitCommands(config)
+// allowedUpdates lists the updates the bot receives
+// https://core.telegram.org/bots/api#update
+var allowedUpdates = bot.AllowedUpdates{
+	"callback_query",
+	// "channel_post",
+	// "chat_boost",
+	"chat_join_request",
+	"chat_member",
+	// "chat_migration",
+	// "chosen_inline_result",
+	// "edited_channel_post",
+	"edited_message",
+	// "inline_query",
+	"message",
+	// "message_reaction",
+	// "message_reaction_count",
+	"my_chat_member",
+	// "poll",
+	// "poll_answer",
+	// "removed_chat_boost",
+}
+
+// InitSender starts the bot. It runs until ctx is done or /exit is used,
+// see Done and Shutdown.
+func InitSender(ctx context.Context, lgr *slog.Logger, config *conf.Config, store data.Store) (*Sender, error) {
+	return initSender(ctx, lgr, config, store)
+}
+
+// initSender is InitSender with extra bot options, e.g. a test server URL.
+func initSender(ctx context.Context, lgr *slog.Logger, config *conf.Config, store data.Store, extraOpts ...bot.Option) (*Sender, error) {
 	sender := &Sender{
-		lgr:              lgr,
-		config:           config,
-		DB:               db,
-		deferredMessages: make(map[int64]chan DeferredMessage),
-		lastMessageTimes: make(map[int64]int64),
-		forwardTargets:   make(map[int64]map[int64]int64),
+		lgr:            lgr,
+		Store:          store,
+		forwardTargets: make(map[int64]map[int64]int64),
+	}
+
+	ctx, sender.stop = context.WithCancel(ctx)
+	sender.done = ctx.Done()
+
+	command := commands.InitCommands(config, sender.replyEphemeral, sender.Stop)
+	sender.commands = command
+	sender.config.Store(config)
+	sender.dispatcher = newDispatcher(sender.deliver)
+	sender.scheduler = newScheduler(sender.enqueue)
+	sender.updates = newUpdatePool()
+	sender.updates.onFull = func() {
+		lgr.Warn(fmt.Sprintf("update queue is full (%d), waiting for the workers", updateQueueSize))
 	}
 
 	opts := []bot.Option{
 		bot.WithDefaultHandler(sender.handler),
 		bot.WithSkipGetMe(),
-		// list of alloweed updates
-		// https://core.telegram.org/bots/api#update
-		bot.WithAllowedUpdates(bot.AllowedUpdates{
-			// "callback_query",
-			// "channel_post",
-			// "chat_boost",
-			"chat_join_request",
-			"chat_member",
-			// "chat_migration",
-			// "chosen_inline_result",
-			// "edited_channel_post",
-			"edited_message",
-			// "inline_query",
-			"message",
-			// "message_reaction",
-			// "message_reaction_count",
-			"my_chat_member",
-			// "poll",
-			// "poll_answer",
-			// "removed_chat_boost",
-		}),
+		bot.WithAllowedUpdates(allowedUpdates),
+		bot.WithNotAsyncHandlers(),
+		bot.WithMiddlewares(sender.queueUpdate),
+		bot.WithHTTPClient(pollTimeout, newVideoChatClient()),
 	}
+	opts = append(opts, extraOpts...)
 
 	// if config.Debug {
 	// 	opts = append(opts, bot.WithDebug())
@@ -74,21 +109,18 @@ func InitSender(lgr *slog.Logger, config *conf.Config, db *sql.DB) (*Sender, err
 		return nil, fmt.Errorf("start bot error: %s", newBotError)
 	}
 
-	// Create a conversation handler and add stages
-	convHandler := NewConversationHandler()
+	// replayed and resumed requests are sent with it as soon as the queue starts
+	sender.Bot = b
 
-	// create handler
-	conversations := sender.config.Conversations
-	for index := range conversations {
-		convHandler.AddStage(index, sender.stageHandler)
-	}
+	// Create a conversation handler and add stages
+	convHandler := NewConversationHandler(store)
 
 	sender.convHandler = convHandler
+	sender.addConversationStages(config)
+	sender.replayOutbox()
+	sender.resumeConversations()
 
-	go b.Start(context.Background())
-	go sender.sendDeferredMessages()
-
-	sender.Bot = b
+	sender.startQueue(ctx)
 
 	b.RegisterHandler(bot.HandlerTypeMessageText, "/kick", bot.MatchTypePrefix, command.Kick)
 	b.RegisterHandler(bot.HandlerTypeMessageText, "/id", bot.MatchTypePrefix, command.Id)
@@ -101,24 +133,61 @@ func InitSender(lgr *slog.Logger, config *conf.Config, db *sql.DB) (*Sender, err
 
 	b.RegisterHandler(bot.HandlerTypeMessageText, "/start", bot.MatchTypeExact, sender.start)
 	b.RegisterHandler(bot.HandlerTypeMessageText, "/cancel", bot.MatchTypeExact, sender.cancelConversation)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "settings", bot.MatchTypeCommand, sender.settings)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "failed", bot.MatchTypeCommand, sender.failed)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "announce", bot.MatchTypeCommand, sender.announce)
+
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, settingsCallbackPrefix, bot.MatchTypePrefix, sender.settingsCallback)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, captchaCallbackPrefix, bot.MatchTypePrefix, sender.captchaCallback)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, stageCallbackPrefix, bot.MatchTypePrefix, sender.stageCallback)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, joinDecisionCallbackPrefix, bot.MatchTypePrefix, sender.joinDecisionCallback)
+
+	if config.WebhookURL != "" {
+		if err := sender.startWebhook(ctx, b, config); err != nil {
+			sender.Shutdown(0)
+			return nil, err
+		}
+	} else {
+		sender.startPolling(ctx, b)
+	}
 
 	return sender, nil
 }
 
+// GetConfig returns the config currently in use.
+func (s *Sender) GetConfig() *conf.Config {
+	return s.config.Load()
+}
+
+// UpdateConfig atomically swaps the config used by the sender and its commands.
+// Conversation state of users is kept, only the stage handlers are rebuilt.
+func (s *Sender) UpdateConfig(config *conf.Config) {
+	s.config.Store(config)
+	s.commands.UpdateConfig(config)
+	s.addConversationStages(config)
+}
+
+func (s *Sender) addConversationStages(config *conf.Config) {
+	s.convHandler.ResetStages()
+
+	// create handler
+	for index := range config.Conversations {
+		s.convHandler.AddStage(index, s.stageHandler)
+	}
+}
+
 func (s *Sender) handler(ctx context.Context, b *bot.Bot, update *models.Update) {
-	if s.config.Debug {
+	if s.config.Load().Debug {
 		s.lgr.Debug(formatUpdateForLog(update))
-
-		// call stage
-		s.convHandler.CallStage(ctx, b, update)
 	}
 
+	// call stage
+	s.convHandler.CallStage(ctx, b, update)
+
 	if update.ChatJoinRequest != nil {
 		s.lgr.Debug(formatUpdateForLog(update))
 
-		go func() {
-			s.HandleChatJoinRequest(ctx, b, update)
-		}()
+		s.HandleChatJoinRequest(ctx, b, update)
 
 		return
 	}
@@ -129,7 +198,7 @@ func (s *Sender) handler(ctx context.Context, b *bot.Bot, update *models.Update)
 			(update.MyChatMember.OldChatMember.Type == models.ChatMemberTypeLeft ||
 				update.MyChatMember.OldChatMember.Type == models.ChatMemberTypeBanned) {
 			s.lgr.Info(fmt.Sprintf("Bot added to group: %d", update.MyChatMember.Chat.ID))
-			go s.notifyAdminsBotAddedToGroup(ctx, &update.MyChatMember.Chat)
+			s.notifyAdminsBotAddedToGroup(ctx, &update.MyChatMember.Chat)
 		}
 	}
 
@@ -141,7 +210,7 @@ func (s *Sender) handler(ctx context.Context, b *bot.Bot, update *models.Update)
 			}
 			if user != nil {
 				s.lgr.Info(fmt.Sprintf("User joined the group: %d", user.ID))
-				go s.notifyAdminsUserJoined(ctx, user, update.ChatMember.Chat.ID)
+				s.notifyAdminsUserJoined(ctx, user, update.ChatMember.Chat.ID)
 			}
 		}
 
@@ -152,7 +221,7 @@ func (s *Sender) handler(ctx context.Context, b *bot.Bot, update *models.Update)
 			}
 			if user != nil {
 				s.lgr.Info(fmt.Sprintf("User left the group: %d", user.ID))
-				go s.notifyAdminsUserLeft(ctx, user, update.ChatMember.Chat.ID)
+				s.notifyAdminsUserLeft(ctx, user, update.ChatMember.Chat.ID)
 			}
 		}
 	}
@@ -163,77 +232,82 @@ func (s *Sender) handler(ctx context.Context, b *bot.Bot, update *models.Update)
 
 	s.relayVerifiedPrivateMessageToAdmins(update)
 
-	if s.config.RestictOnJoin && update.Message != nil && update.Message.NewChatMembers != nil {
+	if update.Message == nil {
+		return
+	}
+
+	config := s.config.Load()
+	policy := s.getPolicy(update.Message.Chat.ID)
+
+	if policy.Captcha && update.Message.NewChatMembers != nil && slices.Contains(config.AllowedChatIDsList, update.Message.Chat.ID) {
+		for _, member := range update.Message.NewChatMembers {
+			if !s.needsCaptcha(update.Message, member) {
+				continue
+			}
+
+			s.lgr.Info(fmt.Sprintf("Captcha for member %d, chat ID %d", member.ID, update.Message.Chat.ID))
+
+			s.sendCaptcha(ctx, update.Message.Chat.ID, member, policy)
+		}
+	} else if policy.RestictOnJoin && update.Message.NewChatMembers != nil {
 		s.lgr.Info(fmt.Sprintf("Restrict users %#v", update.Message.NewChatMembers))
 
-		if !slices.Contains(s.config.AllowedChatIDsList, update.Message.Chat.ID) {
+		if !slices.Contains(config.AllowedChatIDsList, update.Message.Chat.ID) {
 			s.lgr.Info(fmt.Sprintf("Chat ID %d is not in allowed list", update.Message.Chat.ID))
 
 			return
 		}
 
 		for _, member := range update.Message.NewChatMembers {
-			_, err := s.Bot.RestrictChatMember(
-				context.Background(),
-				&bot.RestrictChatMemberParams{
-					ChatID: update.Message.Chat.ID,
-					UserID: member.ID,
-					Permissions: &models.ChatPermissions{
-						CanSendMessages: false,
-					},
-					UntilDate: int(time.Now().Add(time.Second * time.Duration(s.config.RestrictOnJoinTime)).Unix()),
+			err := s.callWithRetry(ctx, &RestrictChatMember{
+				ChatID: update.Message.Chat.ID,
+				UserID: member.ID,
+				Permissions: &models.ChatPermissions{
+					CanSendMessages: false,
 				},
-			)
+				UntilDate: int(time.Now().Add(time.Second * time.Duration(policy.RestrictOnJoinTime)).Unix()),
+			})
 			if err != nil {
 				s.lgr.Error(fmt.Sprintf("Error restricting member %d: %s", member.ID, err.Error()))
 			}
 		}
 	}
 
-	if s.config.DeleteJoinMessages && update.Message != nil && update.Message.NewChatMembers != nil {
+	if policy.DeleteJoinMessages && update.Message.NewChatMembers != nil {
 		s.lgr.Info(fmt.Sprintf("Member joined %+v, chat ID %d", update.Message.NewChatMembers, update.Message.Chat.ID))
 
-		if !slices.Contains(s.config.AllowedChatIDsList, update.Message.Chat.ID) {
+		if !slices.Contains(config.AllowedChatIDsList, update.Message.Chat.ID) {
 			s.lgr.Info(fmt.Sprintf("Chat ID %d is not in allowed list", update.Message.Chat.ID))
 			return
 		}
 
-		_, err := s.Bot.DeleteMessage(
-			context.Background(),
-			&bot.DeleteMessageParams{
-				ChatID:    update.Message.Chat.ID,
-				MessageID: update.Message.ID,
-			},
-		)
-
-		if err != nil {
-			s.lgr.Error(fmt.Sprintf("Error deleting message: %d, %d %s", update.Message.Chat.ID, update.Message.ID, err.Error()))
-		}
+		s.deleteServiceMessage(ctx, update.Message, policy)
 
 		return
 	}
 
-	if s.config.DeleteLeaveMessages && update.Message != nil && update.Message.LeftChatMember != nil {
+	if policy.DeleteLeaveMessages && update.Message.LeftChatMember != nil {
 		s.lgr.Info(fmt.Sprintf("Member has left %+v, chat ID %d", update.Message.LeftChatMember, update.Message.Chat.ID))
 
-		if !slices.Contains(s.config.AllowedChatIDsList, update.Message.Chat.ID) {
+		if !slices.Contains(config.AllowedChatIDsList, update.Message.Chat.ID) {
 			s.lgr.Info(fmt.Sprintf("Chat ID %d is not in allowed list", update.Message.Chat.ID))
 			return
 		}
 
-		_, err := s.Bot.DeleteMessage(
-			context.Background(),
-			&bot.DeleteMessageParams{
-				ChatID:    update.Message.Chat.ID,
-				MessageID: update.Message.ID,
-			},
-		)
+		s.deleteServiceMessage(ctx, update.Message, policy)
 
-		if err != nil {
-			s.lgr.Error(fmt.Sprintf("Error deleting message %d, %d: %s", update.Message.Chat.ID, update.Message.ID, err.Error()))
+		return
+	}
+
+	if kind := serviceMessageKind(update.Message); kind != "" && policy.DeleteServiceMessages.Has(kind) {
+		s.lgr.Info(fmt.Sprintf("Service message %s, chat ID %d", kind, update.Message.Chat.ID))
+
+		if !slices.Contains(config.AllowedChatIDsList, update.Message.Chat.ID) {
+			s.lgr.Info(fmt.Sprintf("Chat ID %d is not in allowed list", update.Message.Chat.ID))
+			return
 		}
 
-		return
+		s.deleteServiceMessage(ctx, update.Message, policy)
 	}
 }
 
@@ -0,0 +1,192 @@
+package sender
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	updateWorkers   = 16
+	updateQueueSize = 1000
+)
+
+// updateKey identifies whose updates must be handled in order.
+type updateKey struct {
+	chatID int64
+	userID int64
+}
+
+// updatePool handles updates with updateWorkers workers. Updates with the
+// same key are handled one at a time in the order they came, updates of
+// other chats and users run in parallel. At most updateQueueSize updates
+// wait in the queue, push blocks when it is full.
+type updatePool struct {
+	mu     sync.Mutex
+	queues map[updateKey][]func()
+	queued int
+
+	ready   chan updateKey // keys with queued updates and no update in flight
+	slots   chan struct{}  // one per queued or running update
+	pending sync.WaitGroup
+
+	onFull func()
+}
+
+func newUpdatePool() *updatePool {
+	return &updatePool{
+		queues: make(map[updateKey][]func()),
+		ready:  make(chan updateKey, updateQueueSize),
+		slots:  make(chan struct{}, updateQueueSize),
+		onFull: func() {},
+	}
+}
+
+// push queues handle under key. It waits for a free slot while the queue
+// is full and gives up when ctx is done.
+func (p *updatePool) push(ctx context.Context, key updateKey, handle func()) bool {
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		p.onFull()
+
+		select {
+		case p.slots <- struct{}{}:
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pending.Add(1)
+	p.queued++
+
+	queue, known := p.queues[key]
+	p.queues[key] = append(queue, handle)
+
+	// a known key is either in ready or in flight and is picked up again
+	if !known {
+		p.ready <- key
+	}
+
+	return true
+}
+
+// take removes the next update of key from the queue.
+func (p *updatePool) take(key updateKey) func() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	handle := p.queues[key][0]
+	p.queues[key] = p.queues[key][1:]
+	p.queued--
+
+	return handle
+}
+
+// finish releases the slot of a handled update and puts the key back in
+// line if it has more updates.
+func (p *updatePool) finish(key updateKey) {
+	p.mu.Lock()
+
+	if len(p.queues[key]) > 0 {
+		p.ready <- key
+	} else {
+		delete(p.queues, key)
+	}
+
+	p.mu.Unlock()
+
+	<-p.slots
+	p.pending.Done()
+}
+
+// depth returns the number of updates waiting to be handled.
+func (p *updatePool) depth() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.queued
+}
+
+// run handles queued updates until ctx is done.
+func (p *updatePool) run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for range updateWorkers {
+		wg.Go(func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case key := <-p.ready:
+					p.take(key)()
+					p.finish(key)
+				}
+			}
+		})
+	}
+
+	wg.Wait()
+}
+
+// keyOf returns the chat and user an update belongs to.
+func keyOf(update *models.Update) updateKey {
+	switch {
+	case update.Message != nil:
+		return messageKey(update.Message)
+	case update.EditedMessage != nil:
+		return messageKey(update.EditedMessage)
+	case update.CallbackQuery != nil:
+		key := updateKey{userID: update.CallbackQuery.From.ID}
+		if update.CallbackQuery.Message.Message != nil {
+			key.chatID = update.CallbackQuery.Message.Message.Chat.ID
+		}
+
+		return key
+	case update.ChatJoinRequest != nil:
+		return updateKey{chatID: update.ChatJoinRequest.Chat.ID, userID: update.ChatJoinRequest.From.ID}
+	case update.ChatMember != nil:
+		key := updateKey{chatID: update.ChatMember.Chat.ID}
+		if user := userFromChatMember(update.ChatMember.NewChatMember); user != nil {
+			key.userID = user.ID
+		}
+
+		return key
+	case update.MyChatMember != nil:
+		return updateKey{chatID: update.MyChatMember.Chat.ID, userID: update.MyChatMember.From.ID}
+	default:
+		return updateKey{}
+	}
+}
+
+func messageKey(message *models.Message) updateKey {
+	key := updateKey{chatID: message.Chat.ID}
+
+	switch {
+	case message.From != nil:
+		key.userID = message.From.ID
+	case message.SenderChat != nil:
+		key.userID = message.SenderChat.ID
+	}
+
+	return key
+}
+
+// queueUpdate is the bot middleware that hands every update to the pool.
+// ctx of the bot is cancelled on shutdown before the pool is drained, so
+// the handlers run without its cancellation.
+func (s *Sender) queueUpdate(next bot.HandlerFunc) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		handlerCtx := context.WithoutCancel(ctx)
+
+		if !s.updates.push(ctx, keyOf(update), func() { next(handlerCtx, b, update) }) {
+			s.lgr.Warn(fmt.Sprintf("update %d dropped on shutdown", update.ID))
+		}
+	}
+}
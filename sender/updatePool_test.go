@@ -0,0 +1,145 @@
+package sender
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+)
+
+func TestUpdatePoolOrderAndParallelism(t *testing.T) {
+	p := newUpdatePool()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go p.run(ctx)
+
+	var (
+		mu    sync.Mutex
+		order []int
+	)
+
+	first := updateKey{chatID: 100, userID: 100}
+	other := updateKey{chatID: -100, userID: 200}
+
+	// the first update of a key blocks until an update of another key runs
+	otherRan := make(chan struct{})
+
+	for i := range 5 {
+		p.push(ctx, first, func() {
+			if i == 0 {
+				select {
+				case <-otherRan:
+				case <-time.After(5 * time.Second):
+					t.Error("Expected other keys to run in parallel")
+				}
+			}
+
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+		})
+	}
+
+	p.push(ctx, other, func() { close(otherRan) })
+
+	select {
+	case <-waitChan(&p.pending):
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected all updates to be handled")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for i, got := range order {
+		if got != i {
+			t.Fatalf("Expected updates of a key in order, got %v", order)
+		}
+	}
+
+	if len(order) != 5 || p.depth() != 0 {
+		t.Errorf("Expected every update to be handled once, got %v, depth %d", order, p.depth())
+	}
+}
+
+func TestUpdatePoolBounded(t *testing.T) {
+	p := newUpdatePool()
+
+	full := false
+	p.onFull = func() { full = true }
+
+	key := updateKey{chatID: 1, userID: 1}
+
+	for range updateQueueSize {
+		if !p.push(context.Background(), key, func() {}) {
+			t.Fatal("Expected a free slot")
+		}
+	}
+
+	if p.depth() != updateQueueSize || full {
+		t.Fatalf("Expected %d queued updates, got %d", updateQueueSize, p.depth())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if p.push(ctx, key, func() {}) {
+		t.Fatal("Expected push to give up when the queue is full")
+	}
+
+	if !full {
+		t.Error("Expected the full queue to be reported")
+	}
+}
+
+func TestKeyOf(t *testing.T) {
+	tests := []struct {
+		name   string
+		update models.Update
+		want   updateKey
+	}{
+		{
+			name:   "message",
+			update: models.Update{Message: &models.Message{Chat: models.Chat{ID: -100}, From: &models.User{ID: 1}}},
+			want:   updateKey{chatID: -100, userID: 1},
+		},
+		{
+			name:   "channel message",
+			update: models.Update{Message: &models.Message{Chat: models.Chat{ID: -100}, SenderChat: &models.Chat{ID: -200}}},
+			want:   updateKey{chatID: -100, userID: -200},
+		},
+		{
+			name:   "join request",
+			update: models.Update{ChatJoinRequest: &models.ChatJoinRequest{Chat: models.Chat{ID: -100}, From: models.User{ID: 2}}},
+			want:   updateKey{chatID: -100, userID: 2},
+		},
+		{
+			name: "callback query",
+			update: models.Update{CallbackQuery: &models.CallbackQuery{
+				From:    models.User{ID: 3},
+				Message: models.MaybeInaccessibleMessage{Message: &models.Message{Chat: models.Chat{ID: 3}}},
+			}},
+			want: updateKey{chatID: 3, userID: 3},
+		},
+		{
+			name: "chat member",
+			update: models.Update{ChatMember: &models.ChatMemberUpdated{
+				Chat:          models.Chat{ID: -100},
+				NewChatMember: models.ChatMember{Type: models.ChatMemberTypeMember, Member: &models.ChatMemberMember{User: &models.User{ID: 4}}},
+			}},
+			want: updateKey{chatID: -100, userID: 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := keyOf(&tt.update); got != tt.want {
+				t.Errorf("keyOf() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package sender
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+)
+
+// The Bot API renamed the voice_chat_* service fields of a message to
+// video_chat_*, but go-telegram/bot only decodes the old keys. Updates from
+// getUpdates and from the webhook get the old keys added before the library
+// decodes them, so video chat service messages are recognized.
+
+// pollTimeout is the default poll timeout and HTTP client timeout of the bot.
+const pollTimeout = time.Minute
+
+var videoChatFields = []string{
+	"video_chat_scheduled",
+	"video_chat_started",
+	"video_chat_ended",
+	"video_chat_participants_invited",
+}
+
+// withVoiceChatFields returns the update with the video_chat_* fields of its
+// message also stored as voice_chat_*. An update without them, or one that
+// can't be parsed, is returned as it is.
+func withVoiceChatFields(update []byte) []byte {
+	if !bytes.Contains(update, []byte(`"video_chat_`)) {
+		return update
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(update, &fields); err != nil {
+		return update
+	}
+
+	changed := false
+
+	for _, name := range []string{"message", "channel_post"} {
+		raw, ok := fields[name]
+		if !ok {
+			continue
+		}
+
+		message := map[string]json.RawMessage{}
+		if err := json.Unmarshal(raw, &message); err != nil {
+			continue
+		}
+
+		found := false
+
+		for _, field := range videoChatFields {
+			if value, ok := message[field]; ok {
+				message["voice_"+strings.TrimPrefix(field, "video_")] = value
+				found = true
+			}
+		}
+
+		if !found {
+			continue
+		}
+
+		encoded, err := json.Marshal(message)
+		if err != nil {
+			return update
+		}
+
+		fields[name] = encoded
+		changed = true
+	}
+
+	if !changed {
+		return update
+	}
+
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return update
+	}
+
+	return encoded
+}
+
+// withVoiceChatUpdates applies withVoiceChatFields to every update of a
+// getUpdates response.
+func withVoiceChatUpdates(body []byte) []byte {
+	if !bytes.Contains(body, []byte(`"video_chat_`)) {
+		return body
+	}
+
+	response := map[string]json.RawMessage{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return body
+	}
+
+	var updates []json.RawMessage
+	if err := json.Unmarshal(response["result"], &updates); err != nil {
+		return body
+	}
+
+	for i := range updates {
+		updates[i] = withVoiceChatFields(updates[i])
+	}
+
+	result, err := json.Marshal(updates)
+	if err != nil {
+		return body
+	}
+
+	response["result"] = result
+
+	encoded, err := json.Marshal(response)
+	if err != nil {
+		return body
+	}
+
+	return encoded
+}
+
+// videoChatClient is the HTTP client of the bot. It adds the old video chat
+// keys to the updates returned by getUpdates.
+type videoChatClient struct {
+	client bot.HttpClient
+}
+
+func newVideoChatClient() *videoChatClient {
+	return &videoChatClient{client: &http.Client{Timeout: pollTimeout}}
+}
+
+func (c *videoChatClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := c.client.Do(req)
+	if err != nil || !strings.HasSuffix(req.URL.Path, "/getUpdates") {
+		return resp, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	body = withVoiceChatUpdates(body)
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+
+	return resp, nil
+}
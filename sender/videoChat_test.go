@@ -0,0 +1,91 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	conf "github.com/ad/telegram-delete-join-messages/config"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// videoChatUpdates are service messages as the Bot API sends them.
+var videoChatUpdates = []string{
+	`{"update_id": 1, "message": {"message_id": 10, "date": 1760000000, "chat": {"id": -100, "type": "supergroup", "title": "Chat"}, "from": {"id": 1, "is_bot": false, "first_name": "A"}, "video_chat_scheduled": {"start_date": 1760003600}}}`,
+	`{"update_id": 2, "message": {"message_id": 11, "date": 1760000000, "chat": {"id": -100, "type": "supergroup", "title": "Chat"}, "from": {"id": 1, "is_bot": false, "first_name": "A"}, "video_chat_started": {}}}`,
+	`{"update_id": 3, "message": {"message_id": 12, "date": 1760000000, "chat": {"id": -100, "type": "supergroup", "title": "Chat"}, "from": {"id": 1, "is_bot": false, "first_name": "A"}, "video_chat_ended": {"duration": 60}}}`,
+	`{"update_id": 4, "message": {"message_id": 13, "date": 1760000000, "chat": {"id": -100, "type": "supergroup", "title": "Chat"}, "from": {"id": 1, "is_bot": false, "first_name": "A"}, "video_chat_participants_invited": {"users": [{"id": 2, "is_bot": false, "first_name": "B"}]}}}`,
+	`{"update_id": 5, "channel_post": {"message_id": 14, "date": 1760000000, "chat": {"id": -200, "type": "channel", "title": "Channel"}, "video_chat_started": {}}}`,
+}
+
+func TestWithVoiceChatFields(t *testing.T) {
+	for _, raw := range videoChatUpdates {
+		var update models.Update
+		if err := json.Unmarshal(withVoiceChatFields([]byte(raw)), &update); err != nil {
+			t.Fatalf("Unmarshal error for %s: %v", raw, err)
+		}
+
+		message := update.Message
+		if message == nil {
+			message = update.ChannelPost
+		}
+
+		if message == nil || serviceMessageKind(message) != conf.ServiceVideoChat {
+			t.Errorf("Expected a video chat service message in %s, got %+v", raw, message)
+		}
+	}
+
+	text := `{"update_id": 6, "message": {"message_id": 15, "chat": {"id": -100, "type": "supergroup"}, "text": "\"video_chat_started\": {}"}}`
+	if got := string(withVoiceChatFields([]byte(text))); got != text {
+		t.Errorf("Expected a message only mentioning the field to stay as it is, got %s", got)
+	}
+}
+
+func TestVideoChatClient(t *testing.T) {
+	var served atomic.Bool
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if served.Swap(true) {
+			_, _ = w.Write([]byte(`{"ok": true, "result": []}`))
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"ok": true, "result": [` + videoChatUpdates[2] + `]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	received := make(chan *models.Update, 1)
+
+	b, err := bot.New("123:token",
+		bot.WithSkipGetMe(),
+		bot.WithServerURL(server.URL),
+		bot.WithHTTPClient(pollTimeout, newVideoChatClient()),
+		bot.WithDefaultHandler(func(_ context.Context, _ *bot.Bot, update *models.Update) {
+			received <- update
+		}),
+	)
+	if err != nil {
+		t.Fatalf("bot.New error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go b.Start(ctx)
+
+	select {
+	case update := <-received:
+		if update.Message == nil || serviceMessageKind(update.Message) != conf.ServiceVideoChat {
+			t.Errorf("Expected a video chat service message, got %+v", update.Message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the update to be handled")
+	}
+}
@@ -0,0 +1,133 @@
+package sender
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	conf "github.com/ad/telegram-delete-join-messages/config"
+	"github.com/go-telegram/bot"
+)
+
+// webhookShutdownTimeout bounds deleteWebhook and the listener shutdown
+// when the bot stops.
+const webhookShutdownTimeout = 10 * time.Second
+
+// webhookHandler serves Telegram updates on path and the health check with
+// the queue depths from stats. Updates without the right
+// X-Telegram-Bot-Api-Secret-Token are rejected.
+func webhookHandler(b *bot.Bot, path, secret string, stats func() QueueStats) http.Handler {
+	updates := b.WebhookHandler()
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET "+conf.HealthPath, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"status": "ok",
+			"queues": stats(),
+		})
+	})
+
+	mux.HandleFunc("POST "+path, func(w http.ResponseWriter, req *http.Request) {
+		token := req.Header.Get("X-Telegram-Bot-Api-Secret-Token")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		req.Body = io.NopCloser(bytes.NewReader(withVoiceChatFields(body)))
+
+		updates(w, req)
+	})
+
+	return mux
+}
+
+// startWebhook listens for updates on WEBHOOK_PORT and registers the
+// webhook with Telegram. When ctx is done the webhook is deleted and the
+// listener is shut down.
+func (s *Sender) startWebhook(ctx context.Context, b *bot.Bot, config *conf.Config) error {
+	secret := config.WebhookSecret
+	if secret == "" {
+		random := make([]byte, 32)
+		if _, err := rand.Read(random); err != nil {
+			return fmt.Errorf("webhook secret error: %w", err)
+		}
+
+		secret = hex.EncodeToString(random)
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", config.WebhookPort))
+	if err != nil {
+		return fmt.Errorf("webhook listen error: %w", err)
+	}
+
+	server := &http.Server{
+		Handler:           webhookHandler(b, config.WebhookPath, secret, s.QueueStats),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.lgr.Error(fmt.Sprintf("webhook server error: %s", err.Error()))
+		}
+	}()
+
+	_, err = b.SetWebhook(ctx, &bot.SetWebhookParams{
+		URL:            strings.TrimRight(config.WebhookURL, "/") + config.WebhookPath,
+		AllowedUpdates: allowedUpdates,
+		SecretToken:    secret,
+	})
+	if err != nil {
+		_ = server.Close()
+		return fmt.Errorf("setWebhook error: %w", err)
+	}
+
+	s.lgr.Info(fmt.Sprintf("Receiving updates by webhook on port %d, path %s", config.WebhookPort, config.WebhookPath))
+
+	s.running.Go(func() { b.StartWebhook(ctx) })
+
+	s.running.Go(func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), webhookShutdownTimeout)
+		defer cancel()
+
+		if _, err := b.DeleteWebhook(shutdownCtx, &bot.DeleteWebhookParams{}); err != nil {
+			s.lgr.Error(fmt.Sprintf("deleteWebhook error: %s", err.Error()))
+		}
+
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			s.lgr.Error(fmt.Sprintf("webhook server shutdown error: %s", err.Error()))
+		}
+	})
+
+	return nil
+}
+
+// startPolling receives updates by long polling. A webhook left over from
+// a previous run would make getUpdates fail, so it is deleted first.
+func (s *Sender) startPolling(ctx context.Context, b *bot.Bot) {
+	if _, err := b.DeleteWebhook(ctx, &bot.DeleteWebhookParams{}); err != nil {
+		s.lgr.Error(fmt.Sprintf("deleteWebhook error: %s", err.Error()))
+	}
+
+	s.running.Go(func() { b.Start(ctx) })
+}
@@ -0,0 +1,108 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	conf "github.com/ad/telegram-delete-join-messages/config"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	received := make(chan *models.Update, 1)
+
+	b, err := bot.New("123:token", bot.WithSkipGetMe(), bot.WithDefaultHandler(func(_ context.Context, _ *bot.Bot, update *models.Update) {
+		received <- update
+	}))
+	if err != nil {
+		t.Fatalf("bot.New error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go b.StartWebhook(ctx)
+
+	server := httptest.NewServer(webhookHandler(b, "/hook", "secret", func() QueueStats { return QueueStats{Updates: 2} }))
+	defer server.Close()
+
+	const hello = `{"update_id": 1, "message": {"message_id": 10, "chat": {"id": -100}, "text": "hello"}}`
+
+	post := func(path, secret, body string) int {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+path, strings.NewReader(body))
+		req.Header.Set("X-Telegram-Bot-Api-Secret-Token", secret)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST %s error: %v", path, err)
+		}
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	if code := post("/hook", "wrong", hello); code != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong secret to be rejected, got %d", code)
+	}
+
+	if code := post("/other", "secret", hello); code != http.StatusNotFound {
+		t.Errorf("Expected an unknown path to be not found, got %d", code)
+	}
+
+	if code := post("/hook", "secret", hello); code != http.StatusOK {
+		t.Fatalf("Expected the update to be accepted, got %d", code)
+	}
+
+	select {
+	case update := <-received:
+		if update.Message == nil || update.Message.Text != "hello" || update.Message.Chat.ID != -100 {
+			t.Errorf("Unexpected update: %+v", update)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the update to be handled")
+	}
+
+	select {
+	case update := <-received:
+		t.Errorf("Expected rejected updates not to be handled, got %+v", update)
+	default:
+	}
+
+	if code := post("/hook", "secret", videoChatUpdates[1]); code != http.StatusOK {
+		t.Fatalf("Expected the video chat update to be accepted, got %d", code)
+	}
+
+	select {
+	case update := <-received:
+		if update.Message == nil || serviceMessageKind(update.Message) != conf.ServiceVideoChat {
+			t.Errorf("Expected a video chat service message, got %+v", update.Message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the video chat update to be handled")
+	}
+
+	resp, err := http.Get(server.URL + "/health")
+	if err != nil {
+		t.Fatalf("GET /health error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var health struct {
+		Status string     `json:"status"`
+		Queues QueueStats `json:"queues"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the health check to pass, got %d, %v", resp.StatusCode, err)
+	}
+
+	if health.Status != "ok" || health.Queues.Updates != 2 {
+		t.Errorf("Expected the queue depth in the health check, got %+v", health)
+	}
+}
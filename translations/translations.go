@@ -0,0 +1,153 @@
+package translations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FallbackLocale is used when neither the requested nor the default locale has a message.
+const FallbackLocale = "ru"
+
+// The en.yaml and ru.yaml next to this file describe the Home Assistant
+// add-on options, the messages of the bot are in catalog/.
+//
+//go:embed catalog/*.yaml
+var files embed.FS
+
+// Catalog holds user and admin facing messages for every shipped locale.
+type Catalog struct {
+	messages map[string]map[string]string
+}
+
+var (
+	defaultCatalog     *Catalog
+	defaultCatalogOnce sync.Once
+)
+
+// Default returns the catalog built from the embedded translations/catalog/*.yaml files.
+func Default() *Catalog {
+	defaultCatalogOnce.Do(func() {
+		catalogFiles, err := fs.Sub(files, "catalog")
+		if err != nil {
+			panic(fmt.Sprintf("translations: %s", err))
+		}
+
+		catalog, err := Load(catalogFiles)
+		if err != nil {
+			panic(fmt.Sprintf("translations: %s", err))
+		}
+
+		defaultCatalog = catalog
+	})
+
+	return defaultCatalog
+}
+
+// Load reads the messages of every *.yaml file in fsys, using the file name
+// as the locale.
+func Load(fsys fs.FS) (*Catalog, error) {
+	names, err := fs.Glob(fsys, "*.yaml")
+	if err != nil {
+		return nil, err
+	}
+
+	catalog := &Catalog{messages: map[string]map[string]string{}}
+
+	for _, name := range names {
+		raw, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+
+		var messages map[string]string
+		if err := yaml.Unmarshal(raw, &messages); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		if len(messages) == 0 {
+			continue
+		}
+
+		catalog.messages[strings.TrimSuffix(path.Base(name), ".yaml")] = messages
+	}
+
+	return catalog, nil
+}
+
+// Locales returns the sorted list of available locales.
+func (c *Catalog) Locales() []string {
+	locales := make([]string, 0, len(c.messages))
+	for locale := range c.messages {
+		locales = append(locales, locale)
+	}
+
+	slices.Sort(locales)
+
+	return locales
+}
+
+// HasLocale reports whether locale has a catalog.
+func (c *Catalog) HasLocale(locale string) bool {
+	_, ok := c.messages[locale]
+
+	return ok
+}
+
+// Resolve maps a Telegram language code (e.g. "en-US") to an available
+// locale, falling back to defaultLocale.
+func (c *Catalog) Resolve(languageCode, defaultLocale string) string {
+	locale := strings.ToLower(languageCode)
+	if i := strings.IndexAny(locale, "-_"); i >= 0 {
+		locale = locale[:i]
+	}
+
+	if c.HasLocale(locale) {
+		return locale
+	}
+
+	if c.HasLocale(defaultLocale) {
+		return defaultLocale
+	}
+
+	return FallbackLocale
+}
+
+// T returns the message for key in locale formatted with args.
+// Missing messages fall back to FallbackLocale and then to the key itself.
+func (c *Catalog) T(locale, key string, args ...any) string {
+	message, ok := c.messages[locale][key]
+	if !ok {
+		message, ok = c.messages[FallbackLocale][key]
+	}
+
+	if !ok {
+		message = key
+	}
+
+	if len(args) == 0 {
+		return message
+	}
+
+	return fmt.Sprintf(message, args...)
+}
+
+// All returns the message for key in every locale, e.g. to recognize
+// notifications sent before the admin locale was changed.
+func (c *Catalog) All(key string) []string {
+	result := []string{}
+
+	for _, locale := range c.Locales() {
+		if message, ok := c.messages[locale][key]; ok && !slices.Contains(result, message) {
+			result = append(result, message)
+		}
+	}
+
+	return result
+}
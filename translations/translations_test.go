@@ -0,0 +1,81 @@
+package translations
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+)
+
+var verbPattern = regexp.MustCompile(`%[a-z]`)
+
+func TestCatalogsAreComplete(t *testing.T) {
+	catalog := Default()
+
+	locales := catalog.Locales()
+	if !slices.Contains(locales, "ru") || !slices.Contains(locales, "en") {
+		t.Fatalf("Expected ru and en catalogs, got %v", locales)
+	}
+
+	reference := catalog.messages[FallbackLocale]
+
+	for _, locale := range locales {
+		messages := catalog.messages[locale]
+
+		for key, message := range reference {
+			translated, ok := messages[key]
+			if !ok {
+				t.Errorf("%s: missing key %q", locale, key)
+				continue
+			}
+
+			if !slices.Equal(verbPattern.FindAllString(message, -1), verbPattern.FindAllString(translated, -1)) {
+				t.Errorf("%s: key %q has different format verbs than %s", locale, key, FallbackLocale)
+			}
+		}
+
+		for key := range messages {
+			if _, ok := reference[key]; !ok {
+				t.Errorf("%s: unknown key %q", locale, key)
+			}
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	catalog := Default()
+
+	tests := []struct {
+		languageCode  string
+		defaultLocale string
+		want          string
+	}{
+		{"en", "ru", "en"},
+		{"en-US", "ru", "en"},
+		{"RU", "en", "ru"},
+		{"de", "en", "en"},
+		{"", "ru", "ru"},
+		{"de", "xx", FallbackLocale},
+	}
+
+	for _, tt := range tests {
+		if got := catalog.Resolve(tt.languageCode, tt.defaultLocale); got != tt.want {
+			t.Errorf("Resolve(%q, %q) = %q, want %q", tt.languageCode, tt.defaultLocale, got, tt.want)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	catalog := Default()
+
+	if got := catalog.T("en", "command.id", 1, 2); got != "Your ID is 1, chat id is 2" {
+		t.Errorf("unexpected message: %q", got)
+	}
+
+	if got := catalog.T("xx", "common.yes"); got != "Да" {
+		t.Errorf("Expected fallback to %s, got %q", FallbackLocale, got)
+	}
+
+	if got := catalog.T("en", "missing.key"); got != "missing.key" {
+		t.Errorf("Expected key for missing message, got %q", got)
+	}
+}